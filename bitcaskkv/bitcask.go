@@ -0,0 +1,458 @@
+// Package bitcaskkv implements an embedded, disk-backed kv.KV in the style
+// of Bitcask: every write is appended to a log of segment files, and an
+// in-memory index maps each key to the position of its latest value.
+package bitcaskkv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	kv "github.com/chenyanchen/kv"
+)
+
+const (
+	maxKeySize   = 1 << 16
+	maxValueSize = 1 << 30
+
+	defaultMaxSegmentSize      = 64 << 20
+	defaultCompactionThreshold = 0.5
+)
+
+// ErrClosed is returned by operations on a closed store.
+var ErrClosed = errors.New("store is closed")
+
+// Option configures a bitcaskKV.
+type Option func(*options)
+
+type options struct {
+	syncAlways          bool
+	syncInterval        time.Duration
+	maxSegmentSize      int64
+	compactionInterval  time.Duration
+	compactionThreshold float64
+	onError             func(error)
+}
+
+// WithSyncAlways returns an Option that fsyncs the log after every write.
+// Without a sync option, flushing is left to the operating system, and
+// the latest writes may be lost on a machine crash, but not on a process crash.
+func WithSyncAlways() Option {
+	return func(o *options) {
+		o.syncAlways = true
+	}
+}
+
+// WithSyncInterval returns an Option that fsyncs the log every interval,
+// bounding the writes lost on a machine crash.
+func WithSyncInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.syncInterval = interval
+	}
+}
+
+// WithMaxSegmentSize returns an Option that sets the size in bytes after
+// which the active segment is closed and a new one is started. Defaults to 64 MiB.
+func WithMaxSegmentSize(size int64) Option {
+	return func(o *options) {
+		o.maxSegmentSize = size
+	}
+}
+
+// WithCompaction returns an Option that checks every interval whether
+// stale records, overwritten or deleted, make up at least threshold of the
+// log, and compacts it if so. The threshold defaults to 0.5 if not in (0, 1].
+func WithCompaction(interval time.Duration, threshold float64) Option {
+	return func(o *options) {
+		o.compactionInterval = interval
+		if threshold > 0 && threshold <= 1 {
+			o.compactionThreshold = threshold
+		}
+	}
+}
+
+// WithErrorHandler returns an Option that reports errors of the background
+// sync and compaction, which are otherwise ignored and retried on the next run.
+func WithErrorHandler(fn func(error)) Option {
+	return func(o *options) {
+		o.onError = fn
+	}
+}
+
+// location is the position of a record in the log.
+type location struct {
+	segment uint64
+	offset  int64
+	size    int64
+	seq     uint64
+}
+
+type bitcaskKV struct {
+	dir  string
+	opts options
+
+	mu       sync.RWMutex
+	index    map[string]location
+	segments map[uint64]*segment
+	active   *segment
+	nextID   uint64
+	seq      uint64
+	closed   bool
+
+	// totalBytes is the size of all segments, liveBytes the size of the
+	// records referenced by the index. The difference is reclaimable.
+	totalBytes int64
+	liveBytes  int64
+
+	// compactMu serializes compactions.
+	compactMu sync.Mutex
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Open opens the store in dir, creating it if needed, and rebuilds the
+// index by replaying the log. A partial or corrupt record at the end of
+// the last segment, as left by a crash, is truncated away.
+//
+// Close must be called to stop the background work and release the files.
+func Open(dir string, opts ...Option) (*bitcaskKV, error) {
+	o := options{
+		maxSegmentSize:      defaultMaxSegmentSize,
+		compactionThreshold: defaultCompactionThreshold,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.maxSegmentSize <= 0 {
+		return nil, errors.New("max segment size must be positive")
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	s := &bitcaskKV{
+		dir:      dir,
+		opts:     o,
+		index:    make(map[string]location),
+		segments: make(map[uint64]*segment),
+		stop:     make(chan struct{}),
+	}
+	if err := s.load(); err != nil {
+		_ = s.closeFiles()
+		return nil, err
+	}
+
+	active, err := createSegment(dir, s.nextID)
+	if err != nil {
+		_ = s.closeFiles()
+		return nil, err
+	}
+	s.nextID++
+	s.active = active
+	s.segments[active.id] = active
+
+	if o.syncInterval > 0 {
+		s.runEvery(o.syncInterval, s.Sync)
+	}
+	if o.compactionInterval > 0 {
+		s.runEvery(o.compactionInterval, s.maybeCompact)
+	}
+	return s, nil
+}
+
+// load replays the segments in dir in order and builds the index.
+func (s *bitcaskKV) load() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	var ids []uint64
+	for _, e := range entries {
+		// Leftovers of an interrupted compaction.
+		if strings.HasSuffix(e.Name(), tempExt) {
+			if err = os.Remove(filepath.Join(s.dir, e.Name())); err != nil {
+				return err
+			}
+			continue
+		}
+		if id, ok := parseSegmentID(e.Name()); ok {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+
+	// deleted keeps the sequence of the tombstones, so that an older record
+	// in a later segment, as written by compaction, does not resurrect a key.
+	deleted := make(map[string]uint64)
+
+	for i, id := range ids {
+		seg, err := openSegment(s.dir, id)
+		if err != nil {
+			return err
+		}
+		s.segments[id] = seg
+		s.nextID = id + 1
+
+		if err = s.replay(seg, i == len(ids)-1, deleted); err != nil {
+			return err
+		}
+		s.totalBytes += seg.size
+	}
+	return nil
+}
+
+// replay adds the records of seg to the index. A corrupt tail is truncated
+// when seg is the last segment, and is an error otherwise.
+func (s *bitcaskKV) replay(seg *segment, last bool, deleted map[string]uint64) error {
+	var off int64
+	for off < seg.size {
+		r, err := readRecord(seg.f, off)
+		if errors.Is(err, ErrCorrupt) && last {
+			if err = seg.f.Truncate(off); err != nil {
+				return err
+			}
+			seg.size = off
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("segment %d: %w", seg.id, err)
+		}
+
+		s.seq = max(s.seq, r.seq)
+		s.apply(r, location{segment: seg.id, offset: off, size: r.size(), seq: r.seq}, deleted)
+		off += r.size()
+	}
+	return nil
+}
+
+// apply replays r, found at loc, unless a newer record for its key is known.
+func (s *bitcaskKV) apply(r *record, loc location, deleted map[string]uint64) {
+	if seq, ok := deleted[r.key]; ok && seq > r.seq {
+		return
+	}
+
+	old, ok := s.index[r.key]
+	if ok && old.seq > r.seq {
+		return
+	}
+	if ok {
+		s.liveBytes -= old.size
+	}
+
+	if r.tombstone {
+		delete(s.index, r.key)
+		deleted[r.key] = r.seq
+		return
+	}
+	s.index[r.key] = loc
+	s.liveBytes += loc.size
+}
+
+func (s *bitcaskKV) Get(ctx context.Context, k string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return nil, ErrClosed
+	}
+
+	loc, ok := s.index[k]
+	if !ok {
+		return nil, kv.ErrNotFound
+	}
+
+	r, err := readRecord(s.segments[loc.segment].f, loc.offset)
+	if err != nil {
+		return nil, err
+	}
+	return r.value, nil
+}
+
+func (s *bitcaskKV) Set(ctx context.Context, k string, v []byte) error {
+	if len(k) > maxKeySize {
+		return errors.New("key too large")
+	}
+	if len(v) > maxValueSize {
+		return errors.New("value too large")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	loc, err := s.write(&record{key: k, value: v})
+	if err != nil {
+		return err
+	}
+
+	if old, ok := s.index[k]; ok {
+		s.liveBytes -= old.size
+	}
+	s.index[k] = loc
+	s.liveBytes += loc.size
+	return nil
+}
+
+func (s *bitcaskKV) Del(ctx context.Context, k string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+
+	old, ok := s.index[k]
+	if !ok {
+		return nil
+	}
+
+	if _, err := s.write(&record{key: k, tombstone: true}); err != nil {
+		return err
+	}
+
+	delete(s.index, k)
+	s.liveBytes -= old.size
+	return nil
+}
+
+// write appends r to the active segment with the next sequence number,
+// rotating the segment when it is full. It must be called with s.mu held.
+func (s *bitcaskKV) write(r *record) (location, error) {
+	if s.closed {
+		return location{}, ErrClosed
+	}
+
+	r.seq = s.seq + 1
+	off, err := s.active.append(appendRecord(nil, r))
+	if err != nil {
+		return location{}, err
+	}
+	s.seq = r.seq
+	s.totalBytes += r.size()
+
+	if s.opts.syncAlways {
+		if err = s.active.f.Sync(); err != nil {
+			return location{}, err
+		}
+	}
+
+	loc := location{segment: s.active.id, offset: off, size: r.size(), seq: r.seq}
+	if s.active.size >= s.opts.maxSegmentSize {
+		if err = s.rotate(); err != nil {
+			return location{}, err
+		}
+	}
+	return loc, nil
+}
+
+// rotate starts a new active segment. It must be called with s.mu held.
+func (s *bitcaskKV) rotate() error {
+	if err := s.active.f.Sync(); err != nil {
+		return err
+	}
+
+	active, err := createSegment(s.dir, s.nextID)
+	if err != nil {
+		return err
+	}
+	s.nextID++
+	s.active = active
+	s.segments[active.id] = active
+	return nil
+}
+
+// Sync flushes the active segment to stable storage.
+func (s *bitcaskKV) Sync() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+	return s.active.f.Sync()
+}
+
+// Close stops the background work, syncs the log and closes its files.
+func (s *bitcaskKV) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	close(s.stop)
+	s.wg.Wait()
+
+	// Wait for a compaction started before Close.
+	s.compactMu.Lock()
+	defer s.compactMu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.active.f.Sync()
+	if closeErr := s.closeFiles(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (s *bitcaskKV) closeFiles() error {
+	var errs []error
+	for _, seg := range s.segments {
+		errs = append(errs, seg.f.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// runEvery calls fn every interval until the store is closed.
+func (s *bitcaskKV) runEvery(interval time.Duration, fn func() error) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				if err := fn(); err != nil && !errors.Is(err, ErrClosed) && s.opts.onError != nil {
+					s.opts.onError(err)
+				}
+			}
+		}
+	}()
+}
+
+// readAll calls fn for every record of seg, in order.
+func readAll(seg *segment, fn func(r *record, off int64) error) error {
+	var off int64
+	for off < seg.size {
+		r, err := readRecord(seg.f, off)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err = fn(r, off); err != nil {
+			return err
+		}
+		off += r.size()
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+package bitcaskkv
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	kv "github.com/chenyanchen/kv"
+)
+
+func openT(t *testing.T, dir string, opts ...Option) *bitcaskKV {
+	t.Helper()
+	s, err := Open(dir, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+func segmentFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	names, err := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	require.NoError(t, err)
+	return names
+}
+
+func TestBitcaskKV(t *testing.T) {
+	ctx := context.Background()
+	s := openT(t, t.TempDir())
+
+	_, err := s.Get(ctx, "a")
+	require.ErrorIs(t, err, kv.ErrNotFound)
+
+	require.NoError(t, s.Set(ctx, "a", []byte("1")))
+	require.NoError(t, s.Set(ctx, "b", nil))
+	require.NoError(t, s.Set(ctx, "a", []byte("2")))
+
+	v, err := s.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("2"), v)
+
+	v, err = s.Get(ctx, "b")
+	require.NoError(t, err)
+	assert.Empty(t, v)
+
+	require.NoError(t, s.Del(ctx, "a"))
+	require.NoError(t, s.Del(ctx, "missing"))
+	_, err = s.Get(ctx, "a")
+	require.ErrorIs(t, err, kv.ErrNotFound)
+}
+
+func TestBitcaskKV_Reopen(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s, err := Open(dir, WithMaxSegmentSize(64))
+	require.NoError(t, err)
+	for i := range 10 {
+		require.NoError(t, s.Set(ctx, fmt.Sprint(i), []byte(fmt.Sprint("v", i))))
+	}
+	require.NoError(t, s.Set(ctx, "0", []byte("new")))
+	require.NoError(t, s.Del(ctx, "1"))
+	require.NoError(t, s.Close())
+	require.Greater(t, len(segmentFiles(t, dir)), 2, "small segments must rotate")
+
+	s = openT(t, dir)
+	v, err := s.Get(ctx, "0")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("new"), v)
+
+	_, err = s.Get(ctx, "1")
+	require.ErrorIs(t, err, kv.ErrNotFound, "tombstone must survive reopen")
+
+	v, err = s.Get(ctx, "9")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("v9"), v)
+}
+
+func TestBitcaskKV_TruncatedTail(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s, err := Open(dir)
+	require.NoError(t, err)
+	require.NoError(t, s.Set(ctx, "a", []byte("1")))
+	require.NoError(t, s.Set(ctx, "b", []byte("2")))
+	path := segmentPath(dir, s.active.id)
+	require.NoError(t, s.Close())
+
+	// Cut the last record in half, as a crash during a write would.
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(path, info.Size()-3))
+
+	s = openT(t, dir)
+	v, err := s.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("1"), v)
+
+	_, err = s.Get(ctx, "b")
+	require.ErrorIs(t, err, kv.ErrNotFound)
+
+	// The store keeps working after the recovery.
+	require.NoError(t, s.Set(ctx, "b", []byte("3")))
+	require.NoError(t, s.Close())
+
+	s = openT(t, dir)
+	v, err = s.Get(ctx, "b")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("3"), v)
+}
+
+func TestBitcaskKV_Corrupt(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s, err := Open(dir)
+	require.NoError(t, err)
+	require.NoError(t, s.Set(ctx, "a", []byte("value")))
+	path := segmentPath(dir, s.active.id)
+	require.NoError(t, s.Close())
+
+	// Damage a sealed segment, which is followed by the empty active one
+	// created by the reopen below.
+	s = openT(t, dir)
+	require.NoError(t, s.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[len(data)-1] ^= 0xff
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+
+	_, err = Open(dir)
+	require.ErrorIs(t, err, ErrCorrupt)
+}
+
+func TestBitcaskKV_Compact(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s, err := Open(dir, WithMaxSegmentSize(256))
+	require.NoError(t, err)
+	for round := range 5 {
+		for i := range 20 {
+			require.NoError(t, s.Set(ctx, fmt.Sprint(i), []byte(fmt.Sprint(round))))
+		}
+	}
+	for i := range 10 {
+		require.NoError(t, s.Del(ctx, fmt.Sprint(i)))
+	}
+
+	before := s.totalBytes
+	require.NoError(t, s.Compact())
+	assert.Less(t, s.totalBytes, before/4)
+	assert.Equal(t, s.liveBytes, s.totalBytes)
+
+	check := func(s *bitcaskKV) {
+		for i := range 20 {
+			v, err := s.Get(ctx, fmt.Sprint(i))
+			if i < 10 {
+				require.ErrorIs(t, err, kv.ErrNotFound, i)
+				continue
+			}
+			require.NoError(t, err, i)
+			assert.Equal(t, []byte("4"), v)
+		}
+	}
+	check(s)
+	require.NoError(t, s.Close())
+
+	s = openT(t, dir)
+	check(s)
+}
+
+func TestBitcaskKV_CompactConcurrentWrites(t *testing.T) {
+	ctx := context.Background()
+	s := openT(t, t.TempDir(), WithMaxSegmentSize(512))
+
+	for i := range 100 {
+		require.NoError(t, s.Set(ctx, fmt.Sprint(i), []byte("old")))
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := range 100 {
+			assert.NoError(t, s.Set(ctx, fmt.Sprint(i), []byte("new")))
+		}
+	}()
+	require.NoError(t, s.Compact())
+	wg.Wait()
+
+	// Writes during the compaction are never replaced by the copied records.
+	for i := range 100 {
+		v, err := s.Get(ctx, fmt.Sprint(i))
+		require.NoError(t, err)
+		assert.Equal(t, []byte("new"), v)
+	}
+}
+
+func TestBitcaskKV_BackgroundCompaction(t *testing.T) {
+	ctx := context.Background()
+	s := openT(t, t.TempDir(), WithCompaction(10*time.Millisecond, 0.5))
+
+	for range 10 {
+		require.NoError(t, s.Set(ctx, "a", []byte("value")))
+	}
+
+	require.Eventually(t, func() bool {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		return s.totalBytes == s.liveBytes
+	}, time.Second, 10*time.Millisecond)
+
+	v, err := s.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("value"), v)
+}
+
+func TestBitcaskKV_Sync(t *testing.T) {
+	ctx := context.Background()
+
+	for name, opt := range map[string]Option{
+		"always":   WithSyncAlways(),
+		"interval": WithSyncInterval(time.Millisecond),
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := openT(t, t.TempDir(), opt)
+			require.NoError(t, s.Set(ctx, "a", []byte("1")))
+			require.NoError(t, s.Sync())
+		})
+	}
+}
+
+func TestBitcaskKV_Closed(t *testing.T) {
+	ctx := context.Background()
+
+	s, err := Open(t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+	require.NoError(t, s.Close(), "Close may be called again")
+
+	_, err = s.Get(ctx, "a")
+	require.ErrorIs(t, err, ErrClosed)
+	require.ErrorIs(t, s.Set(ctx, "a", nil), ErrClosed)
+	require.ErrorIs(t, s.Del(ctx, "a"), ErrClosed)
+	require.ErrorIs(t, s.Compact(), ErrClosed)
+}
+
+func TestBitcaskKV_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	s := openT(t, t.TempDir(), WithMaxSegmentSize(1024))
+
+	var wg sync.WaitGroup
+	for g := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 200 {
+				k := fmt.Sprint(i % 20)
+				switch (g + i) % 3 {
+				case 0:
+					assert.NoError(t, s.Set(ctx, k, []byte(k)))
+				case 1:
+					if v, err := s.Get(ctx, k); err == nil {
+						assert.Equal(t, []byte(k), v)
+					}
+				default:
+					assert.NoError(t, s.Del(ctx, k))
+				}
+				if i%50 == 0 {
+					assert.NoError(t, s.Compact())
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,208 @@
+package bitcaskkv
+
+import (
+	"errors"
+	"os"
+	"slices"
+)
+
+// Compact rewrites the segments that are not being written to, keeping only
+// the records still referenced by the index, and removes the old segments.
+// Reads and writes go on while the live records are copied.
+func (s *bitcaskKV) Compact() error {
+	s.compactMu.Lock()
+	defer s.compactMu.Unlock()
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrClosed
+	}
+	// Seal the active segment so that all existing records are compacted.
+	if s.active.size > 0 {
+		if err := s.rotate(); err != nil {
+			s.mu.Unlock()
+			return err
+		}
+	}
+	var olds []*segment
+	for id, seg := range s.segments {
+		if id != s.active.id {
+			olds = append(olds, seg)
+		}
+	}
+	s.mu.Unlock()
+
+	if len(olds) == 0 {
+		return nil
+	}
+	slices.SortFunc(olds, func(a, b *segment) int { return compareIDs(a.id, b.id) })
+
+	w := &mergeWriter{s: s}
+	moves, err := s.copyLive(w, olds)
+	if err != nil {
+		w.abort()
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Commit under the lock, so that no write is in progress, and move the
+	// writes after the compacted segments: the segment with the highest id
+	// must be the one written to when the process crashes.
+	if err = w.commit(); err != nil {
+		w.abort()
+		return err
+	}
+
+	for _, m := range moves {
+		// Skip the records overwritten or deleted during the copy.
+		if cur, ok := s.index[m.key]; ok && cur == m.from {
+			s.index[m.key] = m.to
+		}
+	}
+	for _, seg := range w.segments {
+		s.segments[seg.id] = seg
+		s.totalBytes += seg.size
+	}
+
+	// Remove the old segments oldest first: a tombstone is always in a
+	// later segment than the records it deletes, so a crash in between
+	// cannot resurrect a key.
+	errs := []error{s.rotate()}
+	for _, seg := range olds {
+		delete(s.segments, seg.id)
+		s.totalBytes -= seg.size
+		errs = append(errs, seg.f.Close(), os.Remove(segmentPath(s.dir, seg.id)))
+	}
+	return errors.Join(errs...)
+}
+
+// move records that the live record of key was copied from one location to another.
+type move struct {
+	key      string
+	from, to location
+}
+
+// copyLive copies the records of segs still referenced by the index to w.
+func (s *bitcaskKV) copyLive(w *mergeWriter, segs []*segment) ([]move, error) {
+	var moves []move
+	for _, seg := range segs {
+		err := readAll(seg, func(r *record, off int64) error {
+			s.mu.RLock()
+			loc, ok := s.index[r.key]
+			s.mu.RUnlock()
+
+			if !ok || loc.segment != seg.id || loc.offset != off {
+				return nil
+			}
+
+			to, err := w.write(r)
+			if err != nil {
+				return err
+			}
+			moves = append(moves, move{key: r.key, from: loc, to: to})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return moves, nil
+}
+
+// maybeCompact compacts the log if enough of it is stale.
+func (s *bitcaskKV) maybeCompact() error {
+	s.mu.RLock()
+	total, live := s.totalBytes, s.liveBytes
+	s.mu.RUnlock()
+
+	if total == 0 || float64(total-live)/float64(total) < s.opts.compactionThreshold {
+		return nil
+	}
+	return s.Compact()
+}
+
+// mergeWriter writes compacted records to new segments. Segments are
+// written under a temporary name, so that a crash during compaction
+// leaves no partial segment behind.
+type mergeWriter struct {
+	s        *bitcaskKV
+	segments []*segment
+}
+
+func (w *mergeWriter) write(r *record) (location, error) {
+	n := len(w.segments)
+	if n == 0 || w.segments[n-1].size >= w.s.opts.maxSegmentSize {
+		if err := w.next(); err != nil {
+			return location{}, err
+		}
+		n++
+	}
+
+	seg := w.segments[n-1]
+	off, err := seg.append(appendRecord(nil, r))
+	if err != nil {
+		return location{}, err
+	}
+	return location{segment: seg.id, offset: off, size: r.size(), seq: r.seq}, nil
+}
+
+func (w *mergeWriter) next() error {
+	w.s.mu.Lock()
+	id := w.s.nextID
+	w.s.nextID++
+	w.s.mu.Unlock()
+
+	f, err := os.OpenFile(segmentPath(w.s.dir, id)+tempExt, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	w.segments = append(w.segments, &segment{id: id, f: f})
+	return nil
+}
+
+// commit syncs the new segments and moves them to their final names.
+func (w *mergeWriter) commit() error {
+	for _, seg := range w.segments {
+		if err := seg.f.Sync(); err != nil {
+			return err
+		}
+		if err := os.Rename(seg.f.Name(), segmentPath(w.s.dir, seg.id)); err != nil {
+			return err
+		}
+	}
+	return syncDir(w.s.dir)
+}
+
+// abort removes the new segments.
+func (w *mergeWriter) abort() {
+	for _, seg := range w.segments {
+		name := seg.f.Name()
+		_ = seg.f.Close()
+		_ = os.Remove(name)
+		_ = os.Remove(segmentPath(w.s.dir, seg.id))
+	}
+}
+
+// syncDir makes renames and removals in dir durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+func compareIDs(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
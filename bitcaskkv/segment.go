@@ -0,0 +1,71 @@
+package bitcaskkv
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	segmentExt = ".log"
+	tempExt    = ".tmp"
+)
+
+// segment is a log file. Only the active segment is appended to,
+// the others are immutable until compaction removes them.
+type segment struct {
+	id   uint64
+	f    *os.File
+	size int64
+}
+
+func segmentPath(dir string, id uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%020d%s", id, segmentExt))
+}
+
+// parseSegmentID returns the id of a segment file name.
+func parseSegmentID(name string) (uint64, bool) {
+	base, ok := strings.CutSuffix(name, segmentExt)
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(base, 10, 64)
+	return id, err == nil
+}
+
+// createSegment creates an empty segment file for appending.
+func createSegment(dir string, id uint64) (*segment, error) {
+	f, err := os.OpenFile(segmentPath(dir, id), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &segment{id: id, f: f}, nil
+}
+
+// openSegment opens an existing segment file.
+func openSegment(dir string, id uint64) (*segment, error) {
+	f, err := os.OpenFile(segmentPath(dir, id), os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return &segment{id: id, f: f, size: info.Size()}, nil
+}
+
+// append writes p at the end of the segment. On a failed write, the
+// segment is truncated back so that no partial record is left behind.
+func (s *segment) append(p []byte) (int64, error) {
+	off := s.size
+	if _, err := s.f.WriteAt(p, off); err != nil {
+		_ = s.f.Truncate(off)
+		return 0, err
+	}
+	s.size += int64(len(p))
+	return off, nil
+}
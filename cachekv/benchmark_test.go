@@ -2,8 +2,11 @@ package cachekv
 
 import (
 	"context"
+	"math/rand"
 	"strconv"
 	"testing"
+
+	kvpkg "github.com/chenyanchen/kv"
 )
 
 const benchKeyCount = 10000
@@ -136,3 +139,208 @@ func BenchmarkLRU_Mixed(b *testing.B) {
 		}
 	})
 }
+
+// BenchmarkClock_Get benchmarks CLOCK cache Get under parallel access.
+func BenchmarkClock_Get(b *testing.B) {
+	kv, err := NewClock[string, string](benchKeyCount)
+	if err != nil {
+		b.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// Pre-populate
+	for i := range benchKeyCount {
+		_ = kv.Set(ctx, strconv.Itoa(i), "value")
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			_, _ = kv.Get(ctx, strconv.Itoa(i%benchKeyCount))
+			i++
+		}
+	})
+}
+
+// BenchmarkClock_Mixed benchmarks 80% read / 20% write under parallel access.
+func BenchmarkClock_Mixed(b *testing.B) {
+	kv, err := NewClock[string, string](benchKeyCount)
+	if err != nil {
+		b.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// Pre-populate
+	for i := range benchKeyCount {
+		_ = kv.Set(ctx, strconv.Itoa(i), "value")
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			key := strconv.Itoa(i % benchKeyCount)
+			if i%5 == 0 {
+				_ = kv.Set(ctx, key, "value")
+			} else {
+				_, _ = kv.Get(ctx, key)
+			}
+			i++
+		}
+	})
+}
+
+// BenchmarkS3FIFO_Get benchmarks S3-FIFO cache Get under parallel access.
+func BenchmarkS3FIFO_Get(b *testing.B) {
+	kv, err := NewS3FIFO[string, string](benchKeyCount)
+	if err != nil {
+		b.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// Pre-populate
+	for i := range benchKeyCount {
+		_ = kv.Set(ctx, strconv.Itoa(i), "value")
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			_, _ = kv.Get(ctx, strconv.Itoa(i%benchKeyCount))
+			i++
+		}
+	})
+}
+
+// BenchmarkS3FIFO_Mixed benchmarks 80% read / 20% write under parallel access.
+func BenchmarkS3FIFO_Mixed(b *testing.B) {
+	kv, err := NewS3FIFO[string, string](benchKeyCount)
+	if err != nil {
+		b.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// Pre-populate
+	for i := range benchKeyCount {
+		_ = kv.Set(ctx, strconv.Itoa(i), "value")
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			key := strconv.Itoa(i % benchKeyCount)
+			if i%5 == 0 {
+				_ = kv.Set(ctx, key, "value")
+			} else {
+				_, _ = kv.Get(ctx, key)
+			}
+			i++
+		}
+	})
+}
+
+const (
+	traceLength   = 100_000
+	traceKeySpace = 100_000
+	traceCacheCap = 1_000
+)
+
+// zipfTrace returns a trace of keys following a Zipf distribution,
+// where a small set of keys receives most of the accesses.
+func zipfTrace(n int) []int {
+	r := rand.New(rand.NewSource(1))
+	z := rand.NewZipf(r, 1.01, 1, traceKeySpace-1)
+
+	trace := make([]int, n)
+	for i := range trace {
+		trace[i] = int(z.Uint64())
+	}
+	return trace
+}
+
+// scanTrace returns a Zipf trace interleaved with long sequential scans
+// over keys outside the Zipf key space, as done by batch jobs.
+func scanTrace(n int) []int {
+	trace := zipfTrace(n)
+
+	scanKey := traceKeySpace
+	for i := range trace {
+		// Every other block of traceCacheCap accesses is a scan.
+		if (i/traceCacheCap)%2 == 1 {
+			trace[i] = scanKey
+			scanKey++
+		}
+	}
+	return trace
+}
+
+// replay runs a cache-aside access pattern over trace and returns the hit ratio.
+func replay(c kvpkg.KV[int, int], trace []int) float64 {
+	ctx := context.Background()
+
+	hits := 0
+	for _, k := range trace {
+		if _, err := c.Get(ctx, k); err == nil {
+			hits++
+			continue
+		}
+		_ = c.Set(ctx, k, k)
+	}
+	return float64(hits) / float64(len(trace))
+}
+
+// fixedHash is the splitmix64 finalizer of k.
+func fixedHash(k int) uint64 {
+	x := uint64(k) + 0x9e3779b97f4a7c15
+	x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+	x = (x ^ x>>27) * 0x94d049bb133111eb
+	return x ^ x>>31
+}
+
+// benchmarkHitRatio replays trace against each cache and reports the hit ratio.
+func benchmarkHitRatio(b *testing.B, trace []int) {
+	caches := []struct {
+		name  string
+		build func() (kvpkg.KV[int, int], error)
+	}{
+		{"LRU", func() (kvpkg.KV[int, int], error) { return NewLRU[int, int](traceCacheCap, nil, 0) }},
+		{"TinyLFU", func() (kvpkg.KV[int, int], error) {
+			c, err := NewTinyLFU[int, int](traceCacheCap)
+			if err != nil {
+				return nil, err
+			}
+			// A fixed hash, not a random seed, for the same ratio every run.
+			c.hashKey = fixedHash
+			return c, nil
+		}},
+		{"S3FIFO", func() (kvpkg.KV[int, int], error) { return NewS3FIFO[int, int](traceCacheCap) }},
+		{"Clock", func() (kvpkg.KV[int, int], error) { return NewClock[int, int](traceCacheCap) }},
+	}
+
+	for _, c := range caches {
+		b.Run(c.name, func(b *testing.B) {
+			var ratio float64
+			for range b.N {
+				cache, err := c.build()
+				if err != nil {
+					b.Fatal(err)
+				}
+				ratio = replay(cache, trace)
+			}
+			b.ReportMetric(ratio*100, "hit%")
+		})
+	}
+}
+
+// BenchmarkHitRatio_Zipf compares hit ratios on a skewed workload.
+func BenchmarkHitRatio_Zipf(b *testing.B) {
+	benchmarkHitRatio(b, zipfTrace(traceLength))
+}
+
+// BenchmarkHitRatio_Scan compares hit ratios on a skewed workload polluted by scans.
+func BenchmarkHitRatio_Scan(b *testing.B) {
+	benchmarkHitRatio(b, scanTrace(traceLength))
+}
@@ -0,0 +1,171 @@
+package cachekv
+
+import (
+	"context"
+	"time"
+
+	kv "github.com/chenyanchen/kv"
+)
+
+// The stores of NewRWMutexCAS, NewShardedCAS and NewLRU implement
+// kv.CASKV. Their versions only live in memory: they start over when the
+// store is restored.
+
+type casRWMutexKV[K comparable, V any] struct {
+	*rwMutexKV[K, V]
+}
+
+// NewRWMutexCAS creates a store like NewRWMutex, versioning its values to
+// implement kv.CASKV. Its writes also keep the versions, which those of
+// NewRWMutex do not pay for.
+func NewRWMutexCAS[K comparable, V any](opts ...Option[K, V]) *casRWMutexKV[K, V] {
+	s := NewRWMutex(opts...)
+	s.versions = make(map[K]uint64)
+	return &casRWMutexKV[K, V]{rwMutexKV: s}
+}
+
+// GetVersion returns the value of k and its version.
+func (s *casRWMutexKV[K, V]) GetVersion(ctx context.Context, k K) (V, uint64, error) {
+	return s.getVersion(k)
+}
+
+// CompareAndSet sets the value of k if its version is version, see kv.CASKV.
+func (s *casRWMutexKV[K, V]) CompareAndSet(ctx context.Context, k K, v V, version uint64) error {
+	old, ok, err := s.compareAndSet(k, v, version)
+	if ok {
+		s.listeners.notify(k, old, Replaced)
+	}
+	return err
+}
+
+// SetIfAbsent sets the value of k if k is not found, see kv.CASKV.
+func (s *casRWMutexKV[K, V]) SetIfAbsent(ctx context.Context, k K, v V) error {
+	_, _, err := s.compareAndSet(k, v, 0)
+	return err
+}
+
+// getVersion returns the value of k and its version.
+func (s *rwMutexKV[K, V]) getVersion(k K) (V, uint64, error) {
+	s.mu.RLock()
+	v, ok := s.m[k]
+	version := s.versions[k]
+	s.mu.RUnlock()
+
+	if !ok {
+		return v, 0, kv.ErrNotFound
+	}
+	return v, version, nil
+}
+
+// compareAndSet sets the value of k if its version is version, and
+// returns the value replaced.
+func (s *rwMutexKV[K, V]) compareAndSet(k K, v V, version uint64) (V, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.versions[k] != version {
+		var old V
+		return old, false, kv.ErrVersionMismatch
+	}
+	old, ok := s.put(k, v)
+	return old, ok, nil
+}
+
+type casShardedKV[K comparable, V any] struct {
+	*shardedKV[K, V]
+}
+
+// NewShardedCAS creates a store like NewSharded, versioning its values to
+// implement kv.CASKV, see NewRWMutexCAS.
+func NewShardedCAS[K comparable, V any](numShards int, opts ...Option[K, V]) *casShardedKV[K, V] {
+	s := NewSharded(numShards, opts...)
+	for _, shard := range s.shards {
+		shard.versions = make(map[K]uint64)
+	}
+	return &casShardedKV[K, V]{shardedKV: s}
+}
+
+// GetVersion returns the value of k and its version.
+func (s *casShardedKV[K, V]) GetVersion(ctx context.Context, k K) (V, uint64, error) {
+	return s.getShard(k).getVersion(k)
+}
+
+// CompareAndSet sets the value of k if its version is version, see kv.CASKV.
+func (s *casShardedKV[K, V]) CompareAndSet(ctx context.Context, k K, v V, version uint64) error {
+	old, ok, err := s.getShard(k).compareAndSet(k, v, version)
+	if ok {
+		s.listeners.notify(k, old, Replaced)
+	}
+	return err
+}
+
+// SetIfAbsent sets the value of k if k is not found, see kv.CASKV.
+func (s *casShardedKV[K, V]) SetIfAbsent(ctx context.Context, k K, v V) error {
+	_, _, err := s.getShard(k).compareAndSet(k, v, 0)
+	return err
+}
+
+// GetVersion returns the value of k and its version, and makes k the most
+// recently used.
+func (c *lruKV[K, V]) GetVersion(ctx context.Context, k K) (V, uint64, error) {
+	c.mu.Lock()
+	e, removals := c.lookup(k, time.Now())
+	var v V
+	var version uint64
+	if e != nil {
+		c.ll.moveToFront(e)
+		v, version = e.value, e.version
+	}
+	c.mu.Unlock()
+
+	c.notify(removals)
+	if e == nil {
+		return v, 0, kv.ErrNotFound
+	}
+	return v, version, nil
+}
+
+// CompareAndSet sets the value of k if its version is version, see kv.CASKV.
+func (c *lruKV[K, V]) CompareAndSet(ctx context.Context, k K, v V, version uint64) error {
+	now := time.Now()
+	var expiresAt int64
+	if c.ttl > 0 {
+		expiresAt = now.Add(c.ttl).UnixNano()
+	}
+
+	c.mu.Lock()
+	e, removals := c.lookup(k, now)
+	var current uint64
+	if e != nil {
+		current = e.version
+	}
+	if current != version {
+		c.mu.Unlock()
+		c.notify(removals)
+		return kv.ErrVersionMismatch
+	}
+	removals = c.set(removals, k, v, expiresAt, now)
+	c.mu.Unlock()
+
+	c.notify(removals)
+	return nil
+}
+
+// SetIfAbsent sets the value of k if k is not found, see kv.CASKV.
+func (c *lruKV[K, V]) SetIfAbsent(ctx context.Context, k K, v V) error {
+	return c.CompareAndSet(ctx, k, v, 0)
+}
+
+// lookup returns the entry of k, or nil if k is not found or expired, in
+// which case its entry is removed. It must be called with c.mu held.
+func (c *lruKV[K, V]) lookup(k K, now time.Time) (*entry[K, V], []removal[K, V]) {
+	e, ok := c.items[k]
+	if !ok {
+		return nil, nil
+	}
+	if e.expired(now) {
+		c.removeEntry(e)
+		return nil, []removal[K, V]{{e.key, e.value, Expired}}
+	}
+	return e, nil
+}
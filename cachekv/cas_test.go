@@ -0,0 +1,108 @@
+package cachekv
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	kvpkg "github.com/chenyanchen/kv"
+)
+
+func casStores(t *testing.T) map[string]kvpkg.CASKV[string, int] {
+	lru, err := NewLRU[string, int](100, nil, 0)
+	require.NoError(t, err)
+	return map[string]kvpkg.CASKV[string, int]{
+		"RWMutex": NewRWMutexCAS[string, int](),
+		"Sharded": NewShardedCAS[string, int](4),
+		"LRU":     lru,
+	}
+}
+
+func TestCASKV(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range casStores(t) {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := s.GetVersion(ctx, "a")
+			require.ErrorIs(t, err, kvpkg.ErrNotFound)
+
+			require.NoError(t, s.SetIfAbsent(ctx, "a", 1))
+			require.ErrorIs(t, s.SetIfAbsent(ctx, "a", 2), kvpkg.ErrVersionMismatch)
+			v, version, err := s.GetVersion(ctx, "a")
+			require.NoError(t, err)
+			assert.Equal(t, 1, v)
+			assert.NotZero(t, version)
+
+			require.NoError(t, s.CompareAndSet(ctx, "a", 2, version))
+			require.ErrorIs(t, s.CompareAndSet(ctx, "a", 3, version), kvpkg.ErrVersionMismatch, "stale version")
+			require.ErrorIs(t, s.CompareAndSet(ctx, "a", 3, 0), kvpkg.ErrVersionMismatch, "not absent")
+
+			// Plain writes change the version too.
+			_, version, err = s.GetVersion(ctx, "a")
+			require.NoError(t, err)
+			require.NoError(t, s.Set(ctx, "a", 3))
+			require.ErrorIs(t, s.CompareAndSet(ctx, "a", 4, version), kvpkg.ErrVersionMismatch)
+
+			// So do deletes: the key is absent, and its old version stale.
+			_, version, err = s.GetVersion(ctx, "a")
+			require.NoError(t, err)
+			require.NoError(t, s.Del(ctx, "a"))
+			require.ErrorIs(t, s.CompareAndSet(ctx, "a", 4, version), kvpkg.ErrVersionMismatch)
+			require.NoError(t, s.CompareAndSet(ctx, "a", 4, 0))
+			_, newVersion, err := s.GetVersion(ctx, "a")
+			require.NoError(t, err)
+			assert.NotEqual(t, version, newVersion)
+		})
+	}
+}
+
+func TestCASKV_Listener(t *testing.T) {
+	ctx := context.Background()
+	var replaced []int
+	s := NewRWMutexCAS(WithListener[string, int](func(k string, v int, reason RemovalReason) {
+		if reason == Replaced {
+			replaced = append(replaced, v)
+		}
+	}))
+
+	require.NoError(t, s.SetIfAbsent(ctx, "a", 1))
+	_, version, err := s.GetVersion(ctx, "a")
+	require.NoError(t, err)
+	require.NoError(t, s.CompareAndSet(ctx, "a", 2, version))
+	require.Error(t, s.CompareAndSet(ctx, "a", 3, version))
+	assert.Equal(t, []int{1}, replaced)
+}
+
+func TestUpdate(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range casStores(t) {
+		t.Run(name, func(t *testing.T) {
+			const writers, increments = 8, 50
+			var wg sync.WaitGroup
+			for range writers {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for range increments {
+						for {
+							_, err := kvpkg.Update(ctx, s, "counter", func(old int) (int, error) { return old + 1, nil })
+							if err == nil {
+								break
+							}
+							if !assert.ErrorIs(t, err, kvpkg.ErrVersionMismatch) {
+								return
+							}
+						}
+					}
+				}()
+			}
+			wg.Wait()
+
+			v, err := s.Get(ctx, "counter")
+			require.NoError(t, err)
+			assert.Equal(t, writers*increments, v, "no increment is lost")
+		})
+	}
+}
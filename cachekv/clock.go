@@ -0,0 +1,164 @@
+package cachekv
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	kv "github.com/chenyanchen/kv"
+)
+
+// clockSlot is a slot of the clock ring.
+type clockSlot[K comparable, V any] struct {
+	key   K
+	value V
+
+	// referenced is the second-chance bit, set by Get without the write lock.
+	referenced atomic.Bool
+}
+
+// clockKV is a CLOCK (second-chance) cache.
+//
+// Entries live in a fixed ring of slots. A hit only sets the referenced bit
+// of the slot, so Get runs under a read lock. On insert into a full ring, the
+// hand sweeps the slots, clearing referenced bits, and evicts the first slot
+// that was not referenced since the last sweep.
+type clockKV[K comparable, V any] struct {
+	mu    sync.RWMutex
+	slots []clockSlot[K, V]
+	index map[K]int
+	free  []int
+	hand  int
+
+	listeners listeners[K, V]
+}
+
+// NewClock creates a CLOCK cache holding at most size entries.
+func NewClock[K comparable, V any](size int, opts ...Option[K, V]) (*clockKV[K, V], error) {
+	if size <= 0 {
+		return nil, errors.New("must provide a positive size")
+	}
+
+	free := make([]int, size)
+	for i := range free {
+		free[i] = size - 1 - i
+	}
+
+	o := newOptions(opts)
+	return &clockKV[K, V]{
+		slots:     make([]clockSlot[K, V], size),
+		index:     make(map[K]int, size),
+		free:      free,
+		listeners: o.listeners,
+	}, nil
+}
+
+func (c *clockKV[K, V]) Get(ctx context.Context, k K) (V, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	i, ok := c.index[k]
+	if !ok {
+		var v V
+		return v, kv.ErrNotFound
+	}
+
+	slot := &c.slots[i]
+	slot.referenced.Store(true)
+	return slot.value, nil
+}
+
+func (c *clockKV[K, V]) Set(ctx context.Context, k K, v V) error {
+	c.mu.Lock()
+
+	if i, ok := c.index[k]; ok {
+		old := c.slots[i].value
+		c.slots[i].value = v
+		c.slots[i].referenced.Store(true)
+		c.mu.Unlock()
+
+		c.listeners.notify(k, old, Replaced)
+		return nil
+	}
+
+	var (
+		i       int
+		evicted bool
+		oldKey  K
+		oldVal  V
+	)
+	if n := len(c.free); n > 0 {
+		i = c.free[n-1]
+		c.free = c.free[:n-1]
+	} else {
+		i = c.evict()
+		evicted = true
+		oldKey, oldVal = c.release(i)
+	}
+
+	slot := &c.slots[i]
+	slot.key = k
+	slot.value = v
+	slot.referenced.Store(false)
+	c.index[k] = i
+	c.mu.Unlock()
+
+	if evicted {
+		c.listeners.notify(oldKey, oldVal, Evicted)
+	}
+	return nil
+}
+
+func (c *clockKV[K, V]) Del(ctx context.Context, k K) error {
+	c.mu.Lock()
+	i, ok := c.index[k]
+	var old V
+	if ok {
+		_, old = c.release(i)
+		c.free = append(c.free, i)
+	}
+	c.mu.Unlock()
+
+	if ok {
+		c.listeners.notify(k, old, Deleted)
+	}
+	return nil
+}
+
+// Len returns the number of cached entries.
+func (c *clockKV[K, V]) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.index)
+}
+
+// evict advances the hand to the first unreferenced slot and returns its
+// index. It must only be called when all slots are used.
+func (c *clockKV[K, V]) evict() int {
+	for {
+		i := c.hand
+		c.hand = (c.hand + 1) % len(c.slots)
+
+		if !c.slots[i].referenced.CompareAndSwap(true, false) {
+			return i
+		}
+	}
+}
+
+// release empties slot i so that it holds no references to the old entry,
+// which is returned.
+func (c *clockKV[K, V]) release(i int) (K, V) {
+	slot := &c.slots[i]
+	k, v := slot.key, slot.value
+	delete(c.index, k)
+
+	var (
+		zeroK K
+		zeroV V
+	)
+	slot.key = zeroK
+	slot.value = zeroV
+	slot.referenced.Store(false)
+	return k, v
+}
@@ -0,0 +1,101 @@
+package cachekv
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	kvpkg "github.com/chenyanchen/kv"
+)
+
+func TestNewClock(t *testing.T) {
+	_, err := NewClock[string, string](0)
+	require.Error(t, err)
+}
+
+func TestClockKV_GetSetDel(t *testing.T) {
+	kv, err := NewClock[string, string](10)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	_, err = kv.Get(ctx, "missing")
+	require.ErrorIs(t, err, kvpkg.ErrNotFound)
+
+	require.NoError(t, kv.Set(ctx, "key1", "value1"))
+	v, err := kv.Get(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, "value1", v)
+
+	require.NoError(t, kv.Set(ctx, "key1", "value2"))
+	v, err = kv.Get(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, "value2", v)
+
+	require.NoError(t, kv.Del(ctx, "key1"))
+	_, err = kv.Get(ctx, "key1")
+	require.ErrorIs(t, err, kvpkg.ErrNotFound)
+	assert.Equal(t, 0, kv.Len())
+
+	// Deleted slots are reused.
+	for i := range 10 {
+		require.NoError(t, kv.Set(ctx, strconv.Itoa(i), "v"))
+	}
+	assert.Equal(t, 10, kv.Len())
+}
+
+func TestClockKV_SecondChance(t *testing.T) {
+	kv, err := NewClock[string, string](3)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, kv.Set(ctx, "a", "1"))
+	require.NoError(t, kv.Set(ctx, "b", "2"))
+	require.NoError(t, kv.Set(ctx, "c", "3"))
+
+	// "a" is referenced, so the hand skips it and evicts "b".
+	_, err = kv.Get(ctx, "a")
+	require.NoError(t, err)
+	require.NoError(t, kv.Set(ctx, "d", "4"))
+
+	_, err = kv.Get(ctx, "a")
+	require.NoError(t, err)
+	_, err = kv.Get(ctx, "b")
+	require.ErrorIs(t, err, kvpkg.ErrNotFound)
+	assert.Equal(t, 3, kv.Len())
+}
+
+func TestClockKV_Concurrent(t *testing.T) {
+	kv, err := NewClock[string, int](500)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	const numGoroutines = 100
+	const numOps = 1000
+
+	var wg sync.WaitGroup
+	wg.Add(numGoroutines)
+
+	for g := range numGoroutines {
+		go func(id int) {
+			defer wg.Done()
+			for i := range numOps {
+				key := strconv.Itoa((id*numOps + i) % 1000)
+				switch i % 3 {
+				case 0:
+					_ = kv.Set(ctx, key, i)
+				case 1:
+					_, _ = kv.Get(ctx, key)
+				case 2:
+					_ = kv.Del(ctx, key)
+				}
+			}
+		}(g)
+	}
+
+	wg.Wait()
+	assert.LessOrEqual(t, kv.Len(), 500)
+}
@@ -0,0 +1,227 @@
+package cachekv
+
+import (
+	"context"
+	"fmt"
+	"hash/maphash"
+	"math"
+	"reflect"
+	"sync"
+	"time"
+
+	kv "github.com/chenyanchen/kv"
+)
+
+// minSweep is the number of counters of a shard below which its expired
+// counters are not swept.
+const minSweep = 64
+
+// counter is an int64 value, expiring at expiresAt in Unix nanoseconds
+// unless it is zero.
+type counter struct {
+	n         int64
+	expiresAt int64
+}
+
+func (c counter) expired(now time.Time) bool {
+	return c.expiresAt != 0 && now.UnixNano() >= c.expiresAt
+}
+
+// counterShard is a partition of a counterKV.
+type counterShard[K comparable] struct {
+	mu sync.Mutex
+	m  map[K]counter
+
+	// sweepAt is the number of counters from which the expired ones are
+	// swept, doubling along with the shard to keep sweeps amortized.
+	sweepAt int
+}
+
+type counterKV[K comparable] struct {
+	shards []*counterShard[K]
+	seed   maphash.Seed
+
+	listeners listeners[K, int64]
+}
+
+// NewCounter creates a store of int64 counters implementing
+// kv.ExpiringCounter, with numShards partitions each incremented under its
+// own lock. If numShards <= 0, defaults to 32.
+//
+// Expired counters are removed when they are read, or swept as the store
+// grows. Listeners are told about the counters set over, deleted or
+// expired, but not about increments.
+//
+// Counters that never expire can be kept in the NewRWMutex and NewSharded
+// stores as well, which implement kv.Counter for integer values.
+func NewCounter[K comparable](numShards int, opts ...Option[K, int64]) *counterKV[K] {
+	if numShards <= 0 {
+		numShards = defaultShardCount
+	}
+
+	shards := make([]*counterShard[K], numShards)
+	for i := range shards {
+		shards[i] = &counterShard[K]{m: make(map[K]counter), sweepAt: minSweep}
+	}
+
+	o := newOptions(opts)
+	return &counterKV[K]{
+		shards:    shards,
+		seed:      maphash.MakeSeed(),
+		listeners: o.listeners,
+	}
+}
+
+func (s *counterKV[K]) getShard(k K) *counterShard[K] {
+	return s.shards[shardIndex(s.seed, k, len(s.shards))]
+}
+
+func (s *counterKV[K]) Get(ctx context.Context, k K) (int64, error) {
+	shard := s.getShard(k)
+	shard.mu.Lock()
+	c, ok := shard.m[k]
+	if ok && c.expired(time.Now()) {
+		delete(shard.m, k)
+		shard.mu.Unlock()
+
+		s.listeners.notify(k, c.n, Expired)
+		return 0, kv.ErrNotFound
+	}
+	shard.mu.Unlock()
+
+	if !ok {
+		return 0, kv.ErrNotFound
+	}
+	return c.n, nil
+}
+
+// Set sets the counter k to v, without expiration.
+func (s *counterKV[K]) Set(ctx context.Context, k K, v int64) error {
+	shard := s.getShard(k)
+	shard.mu.Lock()
+	old, ok := shard.m[k]
+	shard.m[k] = counter{n: v}
+	shard.mu.Unlock()
+
+	if ok {
+		reason := Replaced
+		if old.expired(time.Now()) {
+			reason = Expired
+		}
+		s.listeners.notify(k, old.n, reason)
+	}
+	return nil
+}
+
+func (s *counterKV[K]) Del(ctx context.Context, k K) error {
+	shard := s.getShard(k)
+	shard.mu.Lock()
+	old, ok := shard.m[k]
+	delete(shard.m, k)
+	shard.mu.Unlock()
+
+	if ok {
+		reason := Deleted
+		if old.expired(time.Now()) {
+			reason = Expired
+		}
+		s.listeners.notify(k, old.n, reason)
+	}
+	return nil
+}
+
+// Incr adds delta to the counter k, see kv.Counter.
+func (s *counterKV[K]) Incr(ctx context.Context, k K, delta int64) (int64, error) {
+	return s.IncrWithTTL(ctx, k, delta, 0)
+}
+
+// IncrWithTTL adds delta to the counter k, see kv.ExpiringCounter. A
+// non-positive ttl never expires the counters it creates.
+func (s *counterKV[K]) IncrWithTTL(ctx context.Context, k K, delta int64, ttl time.Duration) (int64, error) {
+	now := time.Now()
+	var removals []removal[K, int64]
+
+	shard := s.getShard(k)
+	shard.mu.Lock()
+	c, ok := shard.m[k]
+	if ok && c.expired(now) {
+		removals = append(removals, removal[K, int64]{k, c.n, Expired})
+		ok = false
+	}
+	if !ok {
+		c = counter{}
+		if ttl > 0 {
+			c.expiresAt = now.Add(ttl).UnixNano()
+		}
+	}
+	c.n += delta
+	shard.m[k] = c
+	removals = shard.sweep(removals, now)
+	shard.mu.Unlock()
+
+	s.listeners.dispatch(removals)
+	return c.n, nil
+}
+
+// sweep removes the expired counters once the shard doubled since the
+// last sweep, and appends them to removals. It must be called with
+// shard.mu held.
+func (shard *counterShard[K]) sweep(removals []removal[K, int64], now time.Time) []removal[K, int64] {
+	if len(shard.m) < shard.sweepAt {
+		return removals
+	}
+	for k, c := range shard.m {
+		if c.expired(now) {
+			delete(shard.m, k)
+			removals = append(removals, removal[K, int64]{k, c.n, Expired})
+		}
+	}
+	shard.sweepAt = max(2*len(shard.m), minSweep)
+	return removals
+}
+
+// Incr adds delta to the integer value of k, see kv.Counter. It fails if
+// the values are not integers, or if the value would overflow. Listeners
+// are not told about increments.
+func (s *rwMutexKV[K, V]) Incr(ctx context.Context, k K, delta int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, n, err := addInt(s.m[k], delta)
+	if err != nil {
+		return 0, fmt.Errorf("incr %v: %w", k, err)
+	}
+	s.put(k, v)
+	return n, nil
+}
+
+// Incr adds delta to the integer value of k, see rwMutexKV.Incr.
+func (s *shardedKV[K, V]) Incr(ctx context.Context, k K, delta int64) (int64, error) {
+	return s.getShard(k).Incr(ctx, k, delta)
+}
+
+// addInt returns v plus delta, as a V and as an int64, if V is of an
+// integer kind and the sum fits in both.
+func addInt[V any](v V, delta int64) (V, int64, error) {
+	rv := reflect.ValueOf(&v).Elem()
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		old := rv.Int()
+		n := old + delta
+		if (n > old) != (delta > 0) || rv.OverflowInt(n) {
+			return v, 0, fmt.Errorf("%d%+d is out of the range of %v", old, delta, rv.Type())
+		}
+		rv.SetInt(n)
+		return v, n, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		old := rv.Uint()
+		n := old + uint64(delta)
+		if (n > old) != (delta > 0) || rv.OverflowUint(n) || n > math.MaxInt64 {
+			return v, 0, fmt.Errorf("%d%+d is out of the range of %v", old, delta, rv.Type())
+		}
+		rv.SetUint(n)
+		return v, int64(n), nil
+	default:
+		return v, 0, fmt.Errorf("%v values are not integers", rv.Type())
+	}
+}
@@ -0,0 +1,140 @@
+package cachekv
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	kvpkg "github.com/chenyanchen/kv"
+)
+
+func TestCounter(t *testing.T) {
+	ctx := context.Background()
+	var s kvpkg.ExpiringCounter[string] = NewCounter[string](4)
+	c := s.(*counterKV[string])
+
+	const writers, increments = 8, 100
+	var wg sync.WaitGroup
+	for range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range increments {
+				_, _ = c.Incr(ctx, "views", 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	v, err := c.Get(ctx, "views")
+	require.NoError(t, err)
+	assert.Equal(t, int64(writers*increments), v)
+
+	n, err := c.Incr(ctx, "views", -1000)
+	require.NoError(t, err)
+	assert.Equal(t, int64(-200), n)
+
+	require.NoError(t, c.Set(ctx, "views", 7))
+	n, err = c.Incr(ctx, "views", 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), n)
+
+	require.NoError(t, c.Del(ctx, "views"))
+	_, err = c.Get(ctx, "views")
+	require.ErrorIs(t, err, kvpkg.ErrNotFound)
+}
+
+func TestCounter_TTL(t *testing.T) {
+	ctx := context.Background()
+	var reasons []RemovalReason
+	c := NewCounter(1, WithListener(func(_ string, _ int64, reason RemovalReason) {
+		reasons = append(reasons, reason)
+	}))
+
+	// The window starts with the first increment.
+	n, err := c.IncrWithTTL(ctx, "hits", 1, 50*time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	time.Sleep(30 * time.Millisecond)
+	n, err = c.IncrWithTTL(ctx, "hits", 1, 50*time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	time.Sleep(30 * time.Millisecond)
+	n, err = c.IncrWithTTL(ctx, "hits", 1, 50*time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n, "not extended by the second increment")
+	assert.Equal(t, []RemovalReason{Expired}, reasons)
+
+	// Expired counters are swept as the store grows.
+	for i := range minSweep {
+		_, err = c.IncrWithTTL(ctx, fmt.Sprint("k", i), 1, time.Millisecond)
+		require.NoError(t, err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	for i := range minSweep {
+		_, err = c.Incr(ctx, fmt.Sprint("new", i), 1)
+		require.NoError(t, err)
+	}
+	c.shards[0].mu.Lock()
+	size := len(c.shards[0].m)
+	c.shards[0].mu.Unlock()
+	assert.LessOrEqual(t, size, minSweep+1)
+}
+
+func TestIncr(t *testing.T) {
+	ctx := context.Background()
+	type count int32
+	for name, c := range map[string]kvpkg.Counter[string]{
+		"RWMutex": NewRWMutex[string, int](),
+		"Sharded": NewSharded[string, count](4),
+		"CAS":     NewShardedCAS[string, uint16](4),
+	} {
+		t.Run(name, func(t *testing.T) {
+			var wg sync.WaitGroup
+			for range 8 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for range 100 {
+						_, err := c.Incr(ctx, "views", 1)
+						assert.NoError(t, err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			n, err := c.Incr(ctx, "views", -100)
+			require.NoError(t, err)
+			assert.Equal(t, int64(700), n)
+
+			_, err = c.Incr(ctx, "views", math.MaxInt64)
+			require.Error(t, err, "out of range")
+			n, err = c.Incr(ctx, "views", 0)
+			require.NoError(t, err)
+			assert.Equal(t, int64(700), n, "unchanged by failed increments")
+		})
+	}
+
+	// Versioned stores give increments a version.
+	s := NewRWMutexCAS[string, int64]()
+	_, err := s.Incr(ctx, "views", 1)
+	require.NoError(t, err)
+	_, version, err := s.GetVersion(ctx, "views")
+	require.NoError(t, err)
+	_, err = s.Incr(ctx, "views", 1)
+	require.NoError(t, err)
+	require.ErrorIs(t, s.CompareAndSet(ctx, "views", 0, version), kvpkg.ErrVersionMismatch)
+
+	_, err = NewRWMutex[string, uint]().Incr(ctx, "views", -1)
+	require.Error(t, err, "below the range of unsigned values")
+	_, err = NewRWMutex[string, int8]().Incr(ctx, "views", 128)
+	require.Error(t, err, "above the range of int8")
+	_, err = NewRWMutex[string, string]().Incr(ctx, "name", 1)
+	require.Error(t, err)
+}
@@ -0,0 +1,94 @@
+package cachekv
+
+import (
+	"iter"
+	"maps"
+	"slices"
+	"time"
+)
+
+// The Keys methods return the keys of a store at the time of the call,
+// collected under its lock and yielded after it, so that the store may be
+// used while iterating.
+
+// unexpiredKeys returns the keys of the unexpired entries of items.
+func unexpiredKeys[K comparable, V any](items map[K]*entry[K, V], now time.Time) []K {
+	keys := make([]K, 0, len(items))
+	for k, e := range items {
+		if !e.expired(now) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// Keys returns the keys of the store.
+func (s *rwMutexKV[K, V]) Keys() iter.Seq[K] {
+	s.mu.RLock()
+	keys := slices.Collect(maps.Keys(s.m))
+	s.mu.RUnlock()
+	return slices.Values(keys)
+}
+
+// Keys returns the keys of the store.
+func (s *shardedKV[K, V]) Keys() iter.Seq[K] {
+	var keys []K
+	for _, shard := range s.shards {
+		shard.mu.RLock()
+		keys = slices.AppendSeq(keys, maps.Keys(shard.m))
+		shard.mu.RUnlock()
+	}
+	return slices.Values(keys)
+}
+
+// Keys returns the keys of the unexpired entries of the cache.
+func (c *lruKV[K, V]) Keys() iter.Seq[K] {
+	c.mu.Lock()
+	keys := unexpiredKeys(c.items, time.Now())
+	c.mu.Unlock()
+	return slices.Values(keys)
+}
+
+// Keys returns the keys of the unexpired entries of the cache.
+func (s *shardedLRUKV[K, V]) Keys() iter.Seq[K] {
+	now := time.Now()
+	var keys []K
+	for _, shard := range s.shards {
+		shard.mu.Lock()
+		keys = append(keys, unexpiredKeys(shard.items, now)...)
+		shard.mu.Unlock()
+	}
+	return slices.Values(keys)
+}
+
+// Keys returns the keys of the cache.
+func (c *clockKV[K, V]) Keys() iter.Seq[K] {
+	c.mu.RLock()
+	keys := slices.Collect(maps.Keys(c.index))
+	c.mu.RUnlock()
+	return slices.Values(keys)
+}
+
+// Keys returns the keys of the cache, not those of its ghost entries.
+func (c *s3FIFOKV[K, V]) Keys() iter.Seq[K] {
+	c.mu.RLock()
+	keys := slices.Collect(maps.Keys(c.items))
+	c.mu.RUnlock()
+	return slices.Values(keys)
+}
+
+// Keys returns the keys of the cache.
+func (c *tinyLFUKV[K, V]) Keys() iter.Seq[K] {
+	c.mu.Lock()
+	keys := slices.Collect(maps.Keys(c.items))
+	c.mu.Unlock()
+	return slices.Values(keys)
+}
+
+// Keys returns the keys of the cache.
+func (c *weightedKV[K, V]) Keys() iter.Seq[K] {
+	c.mu.Lock()
+	keys := slices.Collect(maps.Keys(c.items))
+	c.mu.Unlock()
+	return slices.Values(keys)
+}
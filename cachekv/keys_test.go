@@ -0,0 +1,70 @@
+package cachekv
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	kvpkg "github.com/chenyanchen/kv"
+)
+
+type keysKV interface {
+	kvpkg.KV[string, int]
+	Keys() iter.Seq[string]
+}
+
+func TestKeys(t *testing.T) {
+	must := func(c keysKV, err error) keysKV {
+		require.NoError(t, err)
+		return c
+	}
+	stores := map[string]keysKV{
+		"RWMutex":    NewRWMutex[string, int](),
+		"Sharded":    NewSharded[string, int](4),
+		"LRU":        must(NewLRU[string, int](100, nil, 0)),
+		"ShardedLRU": must(NewShardedLRU[string, int](100, 4, 0)),
+		"Clock":      must(NewClock[string, int](100)),
+		"S3FIFO":     must(NewS3FIFO[string, int](100)),
+		"TinyLFU":    must(NewTinyLFU[string, int](100)),
+		"Weighted":   must(NewWeighted[string, int](100, func(string, int) int64 { return 1 }, nil)),
+	}
+
+	ctx := context.Background()
+	for name, s := range stores {
+		t.Run(name, func(t *testing.T) {
+			var want []string
+			for i := range 10 {
+				k := fmt.Sprint("k", i)
+				require.NoError(t, s.Set(ctx, k, i))
+				want = append(want, k)
+			}
+			require.NoError(t, s.Del(ctx, "k0"))
+
+			// The store may be written while iterating.
+			var got []string
+			for k := range s.Keys() {
+				got = append(got, k)
+				require.NoError(t, s.Del(ctx, k))
+			}
+			assert.ElementsMatch(t, want[1:], got)
+			assert.Empty(t, slices.Collect(s.Keys()))
+		})
+	}
+}
+
+func TestKeys_Expired(t *testing.T) {
+	ctx := context.Background()
+	c, err := NewLRU[string, int](10, nil, 10*time.Millisecond)
+	require.NoError(t, err)
+	require.NoError(t, c.Set(ctx, "a", 1))
+	assert.Equal(t, []string{"a"}, slices.Collect(c.Keys()))
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Empty(t, slices.Collect(c.Keys()))
+}
@@ -0,0 +1,113 @@
+package cachekv
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// entry is an element of an entryList.
+//
+// Besides the key and value, it carries the bookkeeping fields of the
+// caches built on entryList. Each cache only uses the fields it needs.
+type entry[K comparable, V any] struct {
+	key   K
+	value V
+
+	// weight is the cost of the entry, used by cost-aware caches.
+	weight int64
+
+	// expiresAt is the expiration time in Unix nanoseconds, zero means never.
+	expiresAt int64
+
+	// version is the version of the value in caches implementing kv.CASKV.
+	version uint64
+
+	// segment identifies the list holding the entry in segmented caches.
+	segment uint8
+
+	// freq is the access frequency, updated by readers without the write lock.
+	freq atomic.Uint32
+
+	prev, next *entry[K, V]
+}
+
+// expired reports whether e has a TTL that is over at now.
+func (e *entry[K, V]) expired(now time.Time) bool {
+	return e.expiresAt != 0 && now.UnixNano() >= e.expiresAt
+}
+
+// entryList is an intrusive doubly linked list of entries.
+// The front of the list is the most recently pushed entry.
+//
+// Unlike container/list it is typed and does not allocate
+// an extra element per entry.
+type entryList[K comparable, V any] struct {
+	root entry[K, V]
+	len  int
+}
+
+func (l *entryList[K, V]) lazyInit() {
+	if l.root.next == nil {
+		l.root.next = &l.root
+		l.root.prev = &l.root
+	}
+}
+
+// front returns the first entry of the list or nil if the list is empty.
+func (l *entryList[K, V]) front() *entry[K, V] {
+	if l.len == 0 {
+		return nil
+	}
+	return l.root.next
+}
+
+// back returns the last entry of the list or nil if the list is empty.
+func (l *entryList[K, V]) back() *entry[K, V] {
+	if l.len == 0 {
+		return nil
+	}
+	return l.root.prev
+}
+
+// before returns the entry closer to the front than e, or nil if e is the front.
+func (l *entryList[K, V]) before(e *entry[K, V]) *entry[K, V] {
+	if e.prev == &l.root {
+		return nil
+	}
+	return e.prev
+}
+
+// pushFront inserts e at the front of the list.
+func (l *entryList[K, V]) pushFront(e *entry[K, V]) {
+	l.lazyInit()
+	l.insertAfter(e, &l.root)
+}
+
+// moveToFront moves e, which must be in the list, to the front of the list.
+func (l *entryList[K, V]) moveToFront(e *entry[K, V]) {
+	if l.root.next == e {
+		return
+	}
+	l.unlink(e)
+	l.insertAfter(e, &l.root)
+}
+
+// remove removes e, which must be in the list, from the list.
+func (l *entryList[K, V]) remove(e *entry[K, V]) {
+	l.unlink(e)
+	e.prev, e.next = nil, nil
+}
+
+func (l *entryList[K, V]) insertAfter(e, at *entry[K, V]) {
+	e.prev = at
+	e.next = at.next
+	at.next.prev = e
+	at.next = e
+	l.len++
+}
+
+func (l *entryList[K, V]) unlink(e *entry[K, V]) {
+	e.prev.next = e.next
+	e.next.prev = e.prev
+	l.len--
+}
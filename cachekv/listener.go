@@ -0,0 +1,62 @@
+package cachekv
+
+// RemovalReason tells why an entry left a cache.
+type RemovalReason uint8
+
+const (
+	// Evicted means the entry was removed to make room for other entries.
+	Evicted RemovalReason = iota + 1
+	// Expired means the entry outlived its TTL.
+	Expired
+	// Deleted means the entry was removed by Del.
+	Deleted
+	// Replaced means the entry value was overwritten by Set.
+	Replaced
+)
+
+func (r RemovalReason) String() string {
+	switch r {
+	case Evicted:
+		return "evicted"
+	case Expired:
+		return "expired"
+	case Deleted:
+		return "deleted"
+	case Replaced:
+		return "replaced"
+	default:
+		return "unknown"
+	}
+}
+
+// Listener is called with the key and the old value of every entry that
+// leaves a cache. For Replaced, the value is the one that was overwritten.
+//
+// Listeners are called synchronously after the cache has released its locks,
+// so they may call back into the cache, but a slow listener slows down the
+// operation that triggered it.
+type Listener[K comparable, V any] func(k K, v V, reason RemovalReason)
+
+// removal is a pending listener call, collected while a lock is held
+// and dispatched once it is released.
+type removal[K comparable, V any] struct {
+	key    K
+	value  V
+	reason RemovalReason
+}
+
+type listeners[K comparable, V any] []Listener[K, V]
+
+// notify calls every listener for a single removal.
+func (ls listeners[K, V]) notify(k K, v V, reason RemovalReason) {
+	for _, l := range ls {
+		l(k, v, reason)
+	}
+}
+
+// dispatch calls every listener for each removal, in order.
+func (ls listeners[K, V]) dispatch(removals []removal[K, V]) {
+	for _, r := range removals {
+		ls.notify(r.key, r.value, r.reason)
+	}
+}
@@ -0,0 +1,185 @@
+package cachekv
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	kvpkg "github.com/chenyanchen/kv"
+)
+
+type removalEvent struct {
+	key    string
+	value  int
+	reason RemovalReason
+}
+
+// recorder collects removals. Its listener calls back into the cache to
+// prove that listeners run outside the cache locks.
+type recorder struct {
+	cache  kvpkg.KV[string, int]
+	events []removalEvent
+}
+
+func (r *recorder) listen(k string, v int, reason RemovalReason) {
+	_, _ = r.cache.Get(context.Background(), k)
+	r.events = append(r.events, removalEvent{k, v, reason})
+}
+
+func TestListener_Stores(t *testing.T) {
+	tests := []struct {
+		name string
+		// build creates a store bounded to one entry when it is bounded at all.
+		build   func(Option[string, int]) kvpkg.KV[string, int]
+		bounded bool
+	}{
+		{
+			name:  "RWMutex",
+			build: func(o Option[string, int]) kvpkg.KV[string, int] { return NewRWMutex(o) },
+		}, {
+			name:  "Sharded",
+			build: func(o Option[string, int]) kvpkg.KV[string, int] { return NewSharded(4, o) },
+		}, {
+			name: "LRU",
+			build: func(o Option[string, int]) kvpkg.KV[string, int] {
+				c, err := NewLRU(1, nil, 0, o)
+				require.NoError(t, err)
+				return c
+			},
+			bounded: true,
+		}, {
+			name: "Weighted",
+			build: func(o Option[string, int]) kvpkg.KV[string, int] {
+				c, err := NewWeighted(1, func(string, int) int64 { return 1 }, nil, o)
+				require.NoError(t, err)
+				return c
+			},
+			bounded: true,
+		}, {
+			name: "TinyLFU",
+			build: func(o Option[string, int]) kvpkg.KV[string, int] {
+				c, err := NewTinyLFU(1, o)
+				require.NoError(t, err)
+				return c
+			},
+			bounded: true,
+		}, {
+			name: "ShardedLRU",
+			build: func(o Option[string, int]) kvpkg.KV[string, int] {
+				c, err := NewShardedLRU(1, 4, 0, o)
+				require.NoError(t, err)
+				return c
+			},
+			bounded: true,
+		}, {
+			name: "Clock",
+			build: func(o Option[string, int]) kvpkg.KV[string, int] {
+				c, err := NewClock(1, o)
+				require.NoError(t, err)
+				return c
+			},
+			bounded: true,
+		}, {
+			name: "S3FIFO",
+			build: func(o Option[string, int]) kvpkg.KV[string, int] {
+				c, err := NewS3FIFO(1, o)
+				require.NoError(t, err)
+				return c
+			},
+			bounded: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &recorder{}
+			r.cache = tt.build(WithListener(r.listen))
+			ctx := context.Background()
+
+			require.NoError(t, r.cache.Set(ctx, "a", 1))
+			require.NoError(t, r.cache.Set(ctx, "a", 2))
+			require.NoError(t, r.cache.Del(ctx, "a"))
+			require.NoError(t, r.cache.Del(ctx, "missing"))
+
+			want := []removalEvent{
+				{"a", 1, Replaced},
+				{"a", 2, Deleted},
+			}
+
+			if tt.bounded {
+				require.NoError(t, r.cache.Set(ctx, "b", 3))
+				require.NoError(t, r.cache.Set(ctx, "c", 4))
+				want = append(want, removalEvent{"b", 3, Evicted})
+			}
+
+			assert.Equal(t, want, r.events)
+		})
+	}
+}
+
+func TestListener_Expired(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(Option[string, int]) kvpkg.KV[string, int]
+	}{
+		{
+			name: "LRU",
+			build: func(o Option[string, int]) kvpkg.KV[string, int] {
+				c, err := NewLRU(10, nil, 10*time.Millisecond, o)
+				require.NoError(t, err)
+				return c
+			},
+		}, {
+			name: "ShardedLRU",
+			build: func(o Option[string, int]) kvpkg.KV[string, int] {
+				c, err := NewShardedLRU(10, 2, 10*time.Millisecond, o)
+				require.NoError(t, err)
+				return c
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &recorder{}
+			r.cache = tt.build(WithListener(r.listen))
+			ctx := context.Background()
+
+			require.NoError(t, r.cache.Set(ctx, "a", 1))
+			time.Sleep(20 * time.Millisecond)
+
+			_, err := r.cache.Get(ctx, "a")
+			require.ErrorIs(t, err, kvpkg.ErrNotFound)
+			assert.Equal(t, []removalEvent{{"a", 1, Expired}}, r.events)
+		})
+	}
+}
+
+func TestWithListener_Multiple(t *testing.T) {
+	var calls []string
+	kv := NewRWMutex(
+		WithListener(func(k string, _ int, _ RemovalReason) { calls = append(calls, "first "+k) }),
+		WithListener[string, int](nil),
+		WithListener(func(k string, _ int, _ RemovalReason) { calls = append(calls, "second "+k) }),
+	)
+	ctx := context.Background()
+
+	for i := range 2 {
+		require.NoError(t, kv.Set(ctx, "k", i))
+	}
+	assert.Equal(t, []string{"first k", "second k"}, calls)
+}
+
+func TestRemovalReason_String(t *testing.T) {
+	for reason, want := range map[RemovalReason]string{
+		Evicted:          "evicted",
+		Expired:          "expired",
+		Deleted:          "deleted",
+		Replaced:         "replaced",
+		RemovalReason(0): "unknown",
+	} {
+		assert.Equal(t, want, reason.String(), strconv.Itoa(int(reason)))
+	}
+}
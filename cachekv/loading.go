@@ -0,0 +1,226 @@
+package cachekv
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/chenyanchen/sync/singleflight"
+
+	kv "github.com/chenyanchen/kv"
+)
+
+// TTLSetter is implemented by the caches whose entries each expire after
+// their own TTL: the LRU and ShardedLRU caches.
+type TTLSetter[K comparable, V any] interface {
+	SetWithTTL(ctx context.Context, k K, v V, ttl time.Duration) error
+}
+
+// LoadOption configures a loading cache.
+type LoadOption[K comparable, V any] func(*loadOptions[K, V])
+
+type loadOptions[K comparable, V any] struct {
+	ttl       func(K, V) time.Duration
+	errorSize int
+	errorTTL  time.Duration
+}
+
+// WithLoadTTL expires the loaded values after ttl, instead of after the TTL
+// of the cache. The cache must implement TTLSetter.
+func WithLoadTTL[K comparable, V any](ttl time.Duration) LoadOption[K, V] {
+	return WithLoadTTLFunc(func(K, V) time.Duration { return ttl })
+}
+
+// WithLoadTTLFunc expires each loaded value after ttl of it, for values
+// knowing how long they are valid. The cache must implement TTLSetter.
+func WithLoadTTLFunc[K comparable, V any](ttl func(K, V) time.Duration) LoadOption[K, V] {
+	return func(o *loadOptions[K, V]) {
+		o.ttl = ttl
+	}
+}
+
+// WithErrorCaching caches the load errors of at most size keys for ttl, so
+// that a failing key is not loaded by every call. This includes
+// kv.ErrNotFound, for keys that do not exist. Both size and ttl must be
+// positive. Load errors are not cached by default.
+func WithErrorCaching[K comparable, V any](size int, ttl time.Duration) LoadOption[K, V] {
+	return func(o *loadOptions[K, V]) {
+		o.errorSize = size
+		o.errorTTL = ttl
+	}
+}
+
+type loadingKV[K comparable, V any] struct {
+	cache  kv.KV[K, V]
+	setTTL TTLSetter[K, V]
+	ttl    func(K, V) time.Duration
+
+	// errs caches the load errors, nil unless enabled.
+	errs *lruKV[K, error]
+
+	group singleflight.Group[K, V]
+
+	// gens are the generations of the keys being loaded or written, to
+	// not fill the cache with a load older than a write.
+	mu   sync.Mutex
+	gens map[K]*generation
+}
+
+// generation counts the writes of a key, while it is in use.
+type generation struct {
+	mu   sync.Mutex
+	n    uint64
+	refs int
+}
+
+// NewLoading wraps cache with GetOrLoad, to load the values missing from
+// the cache with a function. Get, Set and Del are those of the cache.
+func NewLoading[K comparable, V any](cache kv.KV[K, V], opts ...LoadOption[K, V]) (*loadingKV[K, V], error) {
+	if cache == nil {
+		return nil, errors.New("cache is nil")
+	}
+
+	o := &loadOptions[K, V]{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	l := &loadingKV[K, V]{cache: cache, ttl: o.ttl, gens: make(map[K]*generation)}
+	if o.ttl != nil {
+		setTTL, ok := cache.(TTLSetter[K, V])
+		if !ok {
+			return nil, errors.New("cache does not support per-entry TTL")
+		}
+		l.setTTL = setTTL
+	}
+	if o.errorSize != 0 || o.errorTTL != 0 {
+		if o.errorSize <= 0 {
+			return nil, errors.New("must provide a positive error cache size")
+		}
+		if o.errorTTL <= 0 {
+			return nil, errors.New("must provide a positive error TTL")
+		}
+		errs, err := NewLRU[K, error](o.errorSize, nil, o.errorTTL)
+		if err != nil {
+			return nil, err
+		}
+		l.errs = errs
+	}
+	return l, nil
+}
+
+func (l *loadingKV[K, V]) Get(ctx context.Context, k K) (V, error) {
+	return l.cache.Get(ctx, k)
+}
+
+func (l *loadingKV[K, V]) Set(ctx context.Context, k K, v V) error {
+	return l.write(ctx, k, func() error { return l.cache.Set(ctx, k, v) })
+}
+
+func (l *loadingKV[K, V]) Del(ctx context.Context, k K) error {
+	return l.write(ctx, k, func() error { return l.cache.Del(ctx, k) })
+}
+
+// write writes k with a new generation, so that the loads of k in flight
+// do not fill the cache over it.
+func (l *loadingKV[K, V]) write(ctx context.Context, k K, write func() error) error {
+	g := l.acquire(k)
+	defer l.release(k, g)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.n++
+	if err := l.forget(ctx, k); err != nil {
+		return err
+	}
+	return write()
+}
+
+// acquire returns the generation of k, to be released after use.
+func (l *loadingKV[K, V]) acquire(k K) *generation {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	g, ok := l.gens[k]
+	if !ok {
+		g = &generation{}
+		l.gens[k] = g
+	}
+	g.refs++
+	return g
+}
+
+// release releases the generation of k, dropping it once unused: the
+// generations only need to be compared while a load is in flight.
+func (l *loadingKV[K, V]) release(k K, g *generation) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if g.refs--; g.refs == 0 {
+		delete(l.gens, k)
+	}
+}
+
+// forget drops the cached load error of k.
+func (l *loadingKV[K, V]) forget(ctx context.Context, k K) error {
+	if l.errs == nil {
+		return nil
+	}
+	return l.errs.Del(ctx, k)
+}
+
+// GetOrLoad returns the value of k from the cache, or otherwise loads it
+// with load and caches it. Concurrent calls for k share a single load,
+// and get its result.
+func (l *loadingKV[K, V]) GetOrLoad(ctx context.Context, k K, load func(context.Context, K) (V, error)) (V, error) {
+	v, err := l.cache.Get(ctx, k)
+	if !errors.Is(err, kv.ErrNotFound) {
+		return v, err
+	}
+	if l.errs != nil {
+		if loadErr, err := l.errs.Get(ctx, k); err == nil {
+			return v, loadErr
+		}
+	}
+
+	v, err, _ = l.group.Do(k, func() (V, error) {
+		return l.load(ctx, k, load)
+	})
+	return v, err
+}
+
+// load loads k and caches the result, unless k was written meanwhile.
+func (l *loadingKV[K, V]) load(ctx context.Context, k K, load func(context.Context, K) (V, error)) (V, error) {
+	g := l.acquire(k)
+	defer l.release(k, g)
+	g.mu.Lock()
+	gen := g.n
+	g.mu.Unlock()
+
+	// The previous load of k, or a write, may have ended since the miss.
+	v, err := l.cache.Get(ctx, k)
+	if !errors.Is(err, kv.ErrNotFound) {
+		return v, err
+	}
+
+	v, err = load(ctx, k)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.n != gen {
+		return v, err
+	}
+	if err != nil {
+		// The context of the caller ending is not an error of k.
+		if l.errs != nil && ctx.Err() == nil {
+			_ = l.errs.Set(ctx, k, err)
+		}
+		return v, err
+	}
+
+	if l.setTTL != nil {
+		return v, l.setTTL.SetWithTTL(ctx, k, v, l.ttl(k, v))
+	}
+	return v, l.cache.Set(ctx, k, v)
+}
@@ -0,0 +1,203 @@
+package cachekv
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	kvpkg "github.com/chenyanchen/kv"
+)
+
+func TestLoading_GetOrLoad(t *testing.T) {
+	ctx := context.Background()
+	l, err := NewLoading[string, int](NewRWMutex[string, int]())
+	require.NoError(t, err)
+
+	// Concurrent calls share the load.
+	var loads atomic.Int32
+	release := make(chan struct{})
+	load := func(ctx context.Context, k string) (int, error) {
+		loads.Add(1)
+		<-release
+		return len(k), nil
+	}
+
+	const callers = 10
+	var wg sync.WaitGroup
+	results := make(chan int, callers)
+	for range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := l.GetOrLoad(ctx, "abc", load)
+			assert.NoError(t, err)
+			results <- v
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(results)
+
+	assert.Equal(t, int32(1), loads.Load())
+	for v := range results {
+		assert.Equal(t, 3, v)
+	}
+
+	// Then the value is cached.
+	v, err := l.Get(ctx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, 3, v)
+	v, err = l.GetOrLoad(ctx, "abc", load)
+	require.NoError(t, err)
+	assert.Equal(t, 3, v)
+	assert.Equal(t, int32(1), loads.Load())
+
+	require.NoError(t, l.Del(ctx, "abc"))
+	_, err = l.GetOrLoad(ctx, "abc", load)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), loads.Load())
+
+	_, err = NewLoading[string, int](nil)
+	require.Error(t, err)
+}
+
+func TestLoading_TTL(t *testing.T) {
+	ctx := context.Background()
+	load := func(ctx context.Context, k string) (int, error) { return len(k), nil }
+
+	cache, err := NewLRU[string, int](10, nil, time.Hour)
+	require.NoError(t, err)
+	l, err := NewLoading[string, int](cache, WithLoadTTLFunc(func(k string, v int) time.Duration {
+		if k == "short" {
+			return 20 * time.Millisecond
+		}
+		return 0
+	}))
+	require.NoError(t, err)
+
+	_, err = l.GetOrLoad(ctx, "short", load)
+	require.NoError(t, err)
+	_, err = l.GetOrLoad(ctx, "long", load)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		_, err := cache.Get(ctx, "short")
+		return errors.Is(err, kvpkg.ErrNotFound)
+	}, time.Second, 5*time.Millisecond)
+	_, err = cache.Get(ctx, "long")
+	require.NoError(t, err)
+
+	// The ShardedLRU cache supports it too, but not the others.
+	sharded, err := NewShardedLRU[string, int](10, 2, 0)
+	require.NoError(t, err)
+	_, err = NewLoading[string, int](sharded, WithLoadTTL[string, int](time.Minute))
+	require.NoError(t, err)
+	_, err = NewLoading[string, int](NewRWMutex[string, int](), WithLoadTTL[string, int](time.Minute))
+	require.Error(t, err)
+}
+
+func TestLoading_Errors(t *testing.T) {
+	ctx := context.Background()
+	errLoad := errors.New("backend down")
+	var loads atomic.Int32
+	load := func(ctx context.Context, k string) (int, error) {
+		loads.Add(1)
+		return 0, errLoad
+	}
+
+	// Not cached by default.
+	l, err := NewLoading[string, int](NewRWMutex[string, int]())
+	require.NoError(t, err)
+	for range 2 {
+		_, err = l.GetOrLoad(ctx, "a", load)
+		require.ErrorIs(t, err, errLoad)
+	}
+	assert.Equal(t, int32(2), loads.Load())
+	_, err = l.Get(ctx, "a")
+	require.ErrorIs(t, err, kvpkg.ErrNotFound)
+
+	// Cached when opted in, until they expire.
+	loads.Store(0)
+	l, err = NewLoading[string, int](NewRWMutex[string, int](), WithErrorCaching[string, int](10, 20*time.Millisecond))
+	require.NoError(t, err)
+	for range 2 {
+		_, err = l.GetOrLoad(ctx, "a", load)
+		require.ErrorIs(t, err, errLoad)
+	}
+	assert.Equal(t, int32(1), loads.Load())
+	time.Sleep(30 * time.Millisecond)
+	_, err = l.GetOrLoad(ctx, "a", load)
+	require.ErrorIs(t, err, errLoad)
+	assert.Equal(t, int32(2), loads.Load())
+
+	// Or the key is set.
+	require.NoError(t, l.Set(ctx, "a", 1))
+	v, err := l.GetOrLoad(ctx, "a", load)
+	require.NoError(t, err)
+	assert.Equal(t, 1, v)
+	require.NoError(t, l.Del(ctx, "a"))
+	_, err = l.GetOrLoad(ctx, "a", load)
+	require.ErrorIs(t, err, errLoad)
+	assert.Equal(t, int32(3), loads.Load())
+
+	// The callers giving up is not cached.
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = l.GetOrLoad(cctx, "b", func(ctx context.Context, k string) (int, error) { return 0, ctx.Err() })
+	require.ErrorIs(t, err, context.Canceled)
+	v, err = l.GetOrLoad(ctx, "b", func(ctx context.Context, k string) (int, error) { return 2, nil })
+	require.NoError(t, err)
+	assert.Equal(t, 2, v)
+
+	_, err = NewLoading[string, int](NewRWMutex[string, int](), WithErrorCaching[string, int](10, 0))
+	require.Error(t, err)
+	_, err = NewLoading[string, int](NewRWMutex[string, int](), WithErrorCaching[string, int](0, time.Second))
+	require.Error(t, err)
+}
+
+func TestLoading_WriteDuringLoad(t *testing.T) {
+	ctx := context.Background()
+	for name, write := range map[string]func(l *loadingKV[string, int]) error{
+		"Set": func(l *loadingKV[string, int]) error { return l.Set(ctx, "a", 2) },
+		"Del": func(l *loadingKV[string, int]) error { return l.Del(ctx, "a") },
+	} {
+		t.Run(name, func(t *testing.T) {
+			l, err := NewLoading[string, int](NewRWMutex[string, int]())
+			require.NoError(t, err)
+
+			loading, release := make(chan struct{}), make(chan struct{})
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				v, err := l.GetOrLoad(ctx, "a", func(ctx context.Context, k string) (int, error) {
+					close(loading)
+					<-release
+					return 1, nil
+				})
+				assert.NoError(t, err)
+				assert.Equal(t, 1, v, "the caller still gets its load")
+			}()
+
+			<-loading
+			require.NoError(t, write(l))
+			close(release)
+			<-done
+
+			// The load read before the write, it must not overwrite it.
+			v, err := l.Get(ctx, "a")
+			if name == "Del" {
+				require.ErrorIs(t, err, kvpkg.ErrNotFound)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, 2, v)
+			}
+			assert.Empty(t, l.gens)
+		})
+	}
+}
@@ -2,46 +2,254 @@ package cachekv
 
 import (
 	"context"
+	"errors"
+	"io"
+	"sync"
 	"time"
-
-	lru "github.com/hashicorp/golang-lru/v2"
-	"github.com/hashicorp/golang-lru/v2/expirable"
-	"github.com/hashicorp/golang-lru/v2/simplelru"
+	"weak"
 
 	kv "github.com/chenyanchen/kv"
 )
 
 type lruKV[K comparable, V any] struct {
-	cache simplelru.LRUCache[K, V]
-}
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	items map[K]*entry[K, V]
+	ll    entryList[K, V]
 
-func NewLRU[K comparable, V any](size int, onEvict func(K, V), ttl time.Duration) (*lruKV[K, V], error) {
-	var cache simplelru.LRUCache[K, V]
-	var err error
+	// version is the last version given to a value, see kv.CASKV.
+	version uint64
+	// sweeping is set once the expired entries are swept in the background.
+	sweeping bool
 
-	if ttl > 0 {
-		cache = expirable.NewLRU[K, V](size, onEvict, ttl)
-	} else {
-		cache, err = lru.NewWithEvict[K, V](size, onEvict)
+	onEvict   func(K, V)
+	listeners listeners[K, V]
+	codec     Codec
+}
+
+// NewLRU creates an LRU cache holding at most size entries. If ttl > 0,
+// entries expire ttl after they were last set, and a non-positive size
+// means the cache is only bounded by expiration. Expired entries are
+// removed when read, and by a background sweep for those never read again.
+//
+// onEvict, if not nil, is called for every entry that is evicted, expired
+// or deleted. Use WithListener to also tell these apart and observe replaced values.
+func NewLRU[K comparable, V any](size int, onEvict func(K, V), ttl time.Duration, opts ...Option[K, V]) (*lruKV[K, V], error) {
+	if size <= 0 && ttl <= 0 {
+		return nil, errors.New("must provide a positive size")
 	}
 
-	return &lruKV[K, V]{cache: cache}, err
+	o := newOptions(opts)
+	return &lruKV[K, V]{
+		size:      size,
+		ttl:       ttl,
+		items:     make(map[K]*entry[K, V]),
+		onEvict:   onEvict,
+		listeners: o.listeners,
+		codec:     o.codec,
+	}, nil
 }
 
 func (c *lruKV[K, V]) Get(ctx context.Context, k K) (V, error) {
-	v, ok := c.cache.Get(k)
-	if ok {
-		return v, nil
+	c.mu.Lock()
+	e, ok := c.items[k]
+	if !ok {
+		c.mu.Unlock()
+		var v V
+		return v, kv.ErrNotFound
 	}
-	return v, kv.ErrNotFound
+
+	if e.expired(time.Now()) {
+		c.removeEntry(e)
+		c.mu.Unlock()
+
+		c.notify([]removal[K, V]{{e.key, e.value, Expired}})
+		var v V
+		return v, kv.ErrNotFound
+	}
+
+	c.ll.moveToFront(e)
+	v := e.value
+	c.mu.Unlock()
+	return v, nil
 }
 
 func (c *lruKV[K, V]) Set(ctx context.Context, k K, v V) error {
-	c.cache.Add(k, v)
+	return c.SetWithTTL(ctx, k, v, c.ttl)
+}
+
+// SetWithTTL sets k like Set, but expiring ttl after instead of after the
+// TTL of the cache, never if ttl <= 0.
+func (c *lruKV[K, V]) SetWithTTL(ctx context.Context, k K, v V, ttl time.Duration) error {
+	now := time.Now()
+	var expiresAt int64
+	if ttl > 0 {
+		expiresAt = now.Add(ttl).UnixNano()
+	}
+
+	c.mu.Lock()
+	removals := c.set(nil, k, v, expiresAt, now)
+	c.mu.Unlock()
+
+	c.notify(removals)
 	return nil
 }
 
+// set stores k as the most recently used entry, evicting the least recently
+// used one if needed, and appends the resulting removals to removals.
+// It must be called with c.mu held.
+func (c *lruKV[K, V]) set(removals []removal[K, V], k K, v V, expiresAt int64, now time.Time) []removal[K, V] {
+	if expiresAt != 0 && !c.sweeping {
+		c.sweeping = true
+		interval := c.ttl
+		if interval <= 0 {
+			interval = time.Duration(expiresAt - now.UnixNano())
+		}
+		sweep(c, max(interval, minSweepInterval), (*lruKV[K, V]).removeExpired)
+	}
+
+	c.version++
+	if e, ok := c.items[k]; ok {
+		removals = append(removals, removal[K, V]{k, e.value, Replaced})
+		e.value = v
+		e.expiresAt = expiresAt
+		e.version = c.version
+		c.ll.moveToFront(e)
+		return removals
+	}
+
+	e := &entry[K, V]{key: k, value: v, expiresAt: expiresAt, version: c.version}
+	c.items[k] = e
+	c.ll.pushFront(e)
+
+	if c.size > 0 && c.ll.len > c.size {
+		oldest := c.ll.back()
+		c.removeEntry(oldest)
+
+		reason := Evicted
+		if oldest.expired(now) {
+			reason = Expired
+		}
+		removals = append(removals, removal[K, V]{oldest.key, oldest.value, reason})
+	}
+	return removals
+}
+
 func (c *lruKV[K, V]) Del(ctx context.Context, k K) error {
-	c.cache.Remove(k)
+	c.mu.Lock()
+	e, ok := c.items[k]
+	if ok {
+		c.removeEntry(e)
+	}
+	c.mu.Unlock()
+
+	if ok {
+		c.notify([]removal[K, V]{{e.key, e.value, Deleted}})
+	}
+	return nil
+}
+
+// Snapshot writes the unexpired entries of the cache to w, from the least
+// to the most recently used, with their expiration time.
+func (c *lruKV[K, V]) Snapshot(w io.Writer) error {
+	now := time.Now()
+
+	c.mu.Lock()
+	entries := make([]snapshotEntry[K, V], 0, c.ll.len)
+	for e := c.ll.back(); e != nil; e = c.ll.before(e) {
+		if e.expired(now) {
+			continue
+		}
+		entries = append(entries, snapshotEntry[K, V]{key: e.key, value: e.value, expiresAt: e.expiresAt})
+	}
+	c.mu.Unlock()
+
+	return writeSnapshot(w, c.codec, entries)
+}
+
+// Restore adds the unexpired entries of a snapshot read from r to the cache,
+// keeping their recency order and expiration time. Restored entries are more
+// recently used than the existing ones, and entries without an expiration time
+// get the TTL of the cache. Nothing is added if the snapshot is invalid.
+func (c *lruKV[K, V]) Restore(r io.Reader) error {
+	entries, err := readSnapshot[K, V](r, c.codec)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var removals []removal[K, V]
+
+	c.mu.Lock()
+	for _, e := range entries {
+		if e.expired(now) {
+			continue
+		}
+
+		expiresAt := e.expiresAt
+		if expiresAt == 0 && c.ttl > 0 {
+			expiresAt = now.Add(c.ttl).UnixNano()
+		}
+		removals = c.set(removals, e.key, e.value, expiresAt, now)
+	}
+	c.mu.Unlock()
+
+	c.notify(removals)
 	return nil
 }
+
+// minSweepInterval bounds how often the expired entries of an LRU cache
+// are swept, for short TTLs.
+const minSweepInterval = 100 * time.Millisecond
+
+// sweep calls removeExpired on c every interval, in the background, until
+// c is garbage collected.
+func sweep[T any](c *T, interval time.Duration, removeExpired func(*T)) {
+	ref := weak.Make(c)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			c := ref.Value()
+			if c == nil {
+				return
+			}
+			removeExpired(c)
+		}
+	}()
+}
+
+// removeExpired removes the expired entries.
+func (c *lruKV[K, V]) removeExpired() {
+	now := time.Now()
+	var removals []removal[K, V]
+
+	c.mu.Lock()
+	for e := c.ll.back(); e != nil; {
+		prev := c.ll.before(e)
+		if e.expired(now) {
+			c.removeEntry(e)
+			removals = append(removals, removal[K, V]{e.key, e.value, Expired})
+		}
+		e = prev
+	}
+	c.mu.Unlock()
+
+	c.notify(removals)
+}
+
+func (c *lruKV[K, V]) removeEntry(e *entry[K, V]) {
+	c.ll.remove(e)
+	delete(c.items, e.key)
+}
+
+// notify calls onEvict and the listeners for removals, outside the lock.
+func (c *lruKV[K, V]) notify(removals []removal[K, V]) {
+	for _, r := range removals {
+		if c.onEvict != nil && r.reason != Replaced {
+			c.onEvict(r.key, r.value)
+		}
+		c.listeners.notify(r.key, r.value, r.reason)
+	}
+}
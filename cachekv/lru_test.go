@@ -3,13 +3,14 @@ package cachekv
 import (
 	"context"
 	"fmt"
+	"sync/atomic"
 	"testing"
+	"time"
 
-	lru "github.com/hashicorp/golang-lru/v2"
-	"github.com/hashicorp/golang-lru/v2/expirable"
-	"github.com/hashicorp/golang-lru/v2/simplelru"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	kvpkg "github.com/chenyanchen/kv"
 )
 
 func Test_lruKV_Get(t *testing.T) {
@@ -19,7 +20,7 @@ func Test_lruKV_Get(t *testing.T) {
 	}
 	type testCase[K comparable, V any] struct {
 		name    string
-		c       lruKV[K, V]
+		c       *lruKV[K, V]
 		args    args[K]
 		want    V
 		wantErr assert.ErrorAssertionFunc
@@ -27,14 +28,12 @@ func Test_lruKV_Get(t *testing.T) {
 	tests := []testCase[string, string]{
 		{
 			name: "exist",
-			c: lruKV[string, string]{
-				cache: func() simplelru.LRUCache[string, string] {
-					cache, err := lru.New[string, string](2)
-					require.NoError(t, err)
-					cache.Add("key1", "value1")
-					return cache
-				}(),
-			},
+			c: func() *lruKV[string, string] {
+				c, err := NewLRU[string, string](2, nil, 0)
+				require.NoError(t, err)
+				require.NoError(t, c.Set(context.Background(), "key1", "value1"))
+				return c
+			}(),
 			args: args[string]{
 				ctx: context.Background(),
 				k:   "key1",
@@ -43,9 +42,11 @@ func Test_lruKV_Get(t *testing.T) {
 			wantErr: assert.NoError,
 		}, {
 			name: "not exist",
-			c: lruKV[string, string]{
-				cache: expirable.NewLRU[string, string](2, nil, 0),
-			},
+			c: func() *lruKV[string, string] {
+				c, err := NewLRU[string, string](2, nil, time.Minute)
+				require.NoError(t, err)
+				return c
+			}(),
 			args: args[string]{
 				ctx: context.Background(),
 				k:   "key1",
@@ -64,3 +65,81 @@ func Test_lruKV_Get(t *testing.T) {
 		})
 	}
 }
+
+func TestNewLRU(t *testing.T) {
+	_, err := NewLRU[string, string](0, nil, 0)
+	require.Error(t, err)
+
+	// Bounded by expiration only.
+	_, err = NewLRU[string, string](0, nil, time.Minute)
+	require.NoError(t, err)
+}
+
+func TestLRUKV_TTL(t *testing.T) {
+	var evicted []string
+	c, err := NewLRU(10, func(k, _ string) { evicted = append(evicted, k) }, 10*time.Millisecond)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, c.Set(ctx, "key1", "value1"))
+	_, err = c.Get(ctx, "key1")
+	require.NoError(t, err)
+
+	time.Sleep(20 * time.Millisecond)
+	_, err = c.Get(ctx, "key1")
+	require.ErrorIs(t, err, kvpkg.ErrNotFound)
+	assert.Equal(t, []string{"key1"}, evicted)
+}
+
+func TestLRUKV_Sweep(t *testing.T) {
+	var expired atomic.Int32
+	c, err := NewLRU(0, nil, 10*time.Millisecond, WithListener(func(_, _ string, reason RemovalReason) {
+		if reason == Expired {
+			expired.Add(1)
+		}
+	}))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// Entries never read again are removed by the sweep.
+	for i := range 10 {
+		require.NoError(t, c.Set(ctx, fmt.Sprint("key", i), "value"))
+	}
+	require.Eventually(t, func() bool { return expired.Load() == 10 }, time.Second, time.Millisecond)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	assert.Empty(t, c.items)
+	assert.Zero(t, c.ll.len)
+}
+
+func TestLRUKV_Listener(t *testing.T) {
+	type event struct {
+		k, v   string
+		reason RemovalReason
+	}
+	var events []event
+	var evicted []string
+
+	c, err := NewLRU(2, func(k, _ string) { evicted = append(evicted, k) }, 0,
+		WithListener(func(k, v string, reason RemovalReason) {
+			events = append(events, event{k, v, reason})
+		}))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, c.Set(ctx, "a", "1"))
+	require.NoError(t, c.Set(ctx, "a", "2"))
+	require.NoError(t, c.Set(ctx, "b", "3"))
+	require.NoError(t, c.Set(ctx, "c", "4"))
+	require.NoError(t, c.Del(ctx, "c"))
+	require.NoError(t, c.Del(ctx, "missing"))
+
+	assert.Equal(t, []event{
+		{"a", "1", Replaced},
+		{"a", "2", Evicted},
+		{"c", "4", Deleted},
+	}, events)
+
+	// onEvict keeps seeing every removal but replacements.
+	assert.Equal(t, []string{"a", "c"}, evicted)
+}
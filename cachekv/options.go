@@ -0,0 +1,36 @@
+package cachekv
+
+// Option configures a cachekv store.
+type Option[K comparable, V any] func(*options[K, V])
+
+type options[K comparable, V any] struct {
+	listeners listeners[K, V]
+	codec     Codec
+}
+
+// WithListener registers l to be notified of removals from the store.
+// It may be given several times, listeners are called in order.
+func WithListener[K comparable, V any](l Listener[K, V]) Option[K, V] {
+	return func(o *options[K, V]) {
+		if l != nil {
+			o.listeners = append(o.listeners, l)
+		}
+	}
+}
+
+// WithCodec sets the codec of the store snapshots. Defaults to GobCodec.
+func WithCodec[K comparable, V any](c Codec) Option[K, V] {
+	return func(o *options[K, V]) {
+		if c != nil {
+			o.codec = c
+		}
+	}
+}
+
+func newOptions[K comparable, V any](opts []Option[K, V]) options[K, V] {
+	o := options[K, V]{codec: GobCodec{}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
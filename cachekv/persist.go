@@ -0,0 +1,67 @@
+package cachekv
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// SaveFile writes a snapshot of s to the file at path.
+// The file is replaced atomically, so a crash never leaves a partial snapshot.
+func SaveFile(path string, s Snapshotter) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+
+	if err = s.Snapshot(f); err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+	}
+	return err
+}
+
+// LoadFile restores s from the snapshot file at path.
+func LoadFile(path string, s Snapshotter) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return s.Restore(f)
+}
+
+// Persist restores s from the snapshot file at path, if it exists, and
+// saves a new snapshot to path once ctx is done. Use it with a context
+// canceled on graceful shutdown, e.g. from signal.NotifyContext, to keep
+// the cache warm across restarts.
+//
+// The returned function waits for the snapshot to be saved and returns
+// the save error. An invalid snapshot file is reported as an error
+// wrapping ErrInvalidSnapshot, and nothing is scheduled.
+func Persist(ctx context.Context, path string, s Snapshotter) (func() error, error) {
+	if err := LoadFile(path, s); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		done <- SaveFile(path, s)
+	}()
+
+	return sync.OnceValue(func() error { return <-done }), nil
+}
@@ -2,7 +2,9 @@ package cachekv
 
 import (
 	"context"
+	"io"
 	"sync"
+	"time"
 
 	kv "github.com/chenyanchen/kv"
 )
@@ -10,10 +12,23 @@ import (
 type rwMutexKV[K comparable, V any] struct {
 	mu sync.RWMutex
 	m  map[K]V
+
+	// versions are the versions of the values of m in the stores of
+	// NewRWMutexCAS, nil in the others, and version the last version given.
+	versions map[K]uint64
+	version  uint64
+
+	listeners listeners[K, V]
+	codec     Codec
 }
 
-func NewRWMutex[K comparable, V any]() *rwMutexKV[K, V] {
-	return &rwMutexKV[K, V]{m: make(map[K]V)}
+func NewRWMutex[K comparable, V any](opts ...Option[K, V]) *rwMutexKV[K, V] {
+	o := newOptions(opts)
+	return &rwMutexKV[K, V]{
+		m:         make(map[K]V),
+		listeners: o.listeners,
+		codec:     o.codec,
+	}
 }
 
 func (s *rwMutexKV[K, V]) Get(ctx context.Context, k K) (V, error) {
@@ -29,14 +44,80 @@ func (s *rwMutexKV[K, V]) Get(ctx context.Context, k K) (V, error) {
 
 func (s *rwMutexKV[K, V]) Set(ctx context.Context, k K, v V) error {
 	s.mu.Lock()
-	s.m[k] = v
+	old, ok := s.put(k, v)
 	s.mu.Unlock()
+
+	if ok {
+		s.listeners.notify(k, old, Replaced)
+	}
 	return nil
 }
 
 func (s *rwMutexKV[K, V]) Del(ctx context.Context, k K) error {
 	s.mu.Lock()
-	delete(s.m, k)
+	old, ok := s.remove(k)
+	s.mu.Unlock()
+
+	if ok {
+		s.listeners.notify(k, old, Deleted)
+	}
+	return nil
+}
+
+// Snapshot writes all the entries of the store to w.
+func (s *rwMutexKV[K, V]) Snapshot(w io.Writer) error {
+	s.mu.RLock()
+	entries := make([]snapshotEntry[K, V], 0, len(s.m))
+	for k, v := range s.m {
+		entries = append(entries, snapshotEntry[K, V]{key: k, value: v})
+	}
+	s.mu.RUnlock()
+
+	return writeSnapshot(w, s.codec, entries)
+}
+
+// Restore adds the unexpired entries of a snapshot read from r to the store,
+// overwriting existing keys. Nothing is added if the snapshot is invalid.
+func (s *rwMutexKV[K, V]) Restore(r io.Reader) error {
+	entries, err := readSnapshot[K, V](r, s.codec)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var removals []removal[K, V]
+
+	s.mu.Lock()
+	for _, e := range entries {
+		if e.expired(now) {
+			continue
+		}
+		if old, ok := s.put(e.key, e.value); ok {
+			removals = append(removals, removal[K, V]{e.key, old, Replaced})
+		}
+	}
 	s.mu.Unlock()
+
+	s.listeners.dispatch(removals)
 	return nil
 }
+
+// put sets the value of k, with a new version if versioned, and returns
+// the old value. It must be called with s.mu held.
+func (s *rwMutexKV[K, V]) put(k K, v V) (V, bool) {
+	old, ok := s.m[k]
+	s.m[k] = v
+	if s.versions != nil {
+		s.version++
+		s.versions[k] = s.version
+	}
+	return old, ok
+}
+
+// remove deletes k, and returns its value. It must be called with s.mu held.
+func (s *rwMutexKV[K, V]) remove(k K) (V, bool) {
+	old, ok := s.m[k]
+	delete(s.m, k)
+	delete(s.versions, k)
+	return old, ok
+}
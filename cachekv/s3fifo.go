@@ -0,0 +1,208 @@
+package cachekv
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	kv "github.com/chenyanchen/kv"
+)
+
+const (
+	segmentSmall uint8 = iota
+	segmentMain
+)
+
+const (
+	s3FIFOSmallPercent = 10
+	s3FIFOMaxFreq      = 3
+)
+
+// s3FIFOKV is an S3-FIFO cache.
+//
+// New entries enter a small FIFO queue. Entries that were read while in the
+// small queue are moved to the main FIFO queue on eviction, the others are
+// evicted and remembered in a ghost queue of keys. A key found in the ghost
+// queue is inserted directly into the main queue. The main queue gives each
+// entry up to s3FIFOMaxFreq extra rounds, one per read.
+//
+// A hit only increments a counter, so Get runs under a read lock.
+type s3FIFOKV[K comparable, V any] struct {
+	mu sync.RWMutex
+
+	items map[K]*entry[K, V]
+	ghost map[K]*entry[K, V]
+
+	small      entryList[K, V]
+	main       entryList[K, V]
+	ghostQueue entryList[K, V]
+
+	size     int
+	smallCap int
+
+	listeners listeners[K, V]
+}
+
+// NewS3FIFO creates an S3-FIFO cache holding at most size entries.
+func NewS3FIFO[K comparable, V any](size int, opts ...Option[K, V]) (*s3FIFOKV[K, V], error) {
+	if size <= 0 {
+		return nil, errors.New("must provide a positive size")
+	}
+
+	o := newOptions(opts)
+	return &s3FIFOKV[K, V]{
+		items:     make(map[K]*entry[K, V], size),
+		ghost:     make(map[K]*entry[K, V]),
+		size:      size,
+		smallCap:  max(1, size*s3FIFOSmallPercent/100),
+		listeners: o.listeners,
+	}, nil
+}
+
+func (c *s3FIFOKV[K, V]) Get(ctx context.Context, k K) (V, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	e, ok := c.items[k]
+	if !ok {
+		var v V
+		return v, kv.ErrNotFound
+	}
+
+	incrementFreq(e)
+	return e.value, nil
+}
+
+func (c *s3FIFOKV[K, V]) Set(ctx context.Context, k K, v V) error {
+	c.mu.Lock()
+
+	if e, ok := c.items[k]; ok {
+		old := e.value
+		e.value = v
+		incrementFreq(e)
+		c.mu.Unlock()
+
+		c.listeners.notify(k, old, Replaced)
+		return nil
+	}
+
+	var evicted *entry[K, V]
+	for evicted == nil && len(c.items) >= c.size {
+		evicted = c.evict()
+	}
+
+	e := &entry[K, V]{key: k, value: v}
+	if g, ok := c.ghost[k]; ok {
+		c.ghostQueue.remove(g)
+		delete(c.ghost, k)
+
+		e.segment = segmentMain
+		c.main.pushFront(e)
+	} else {
+		e.segment = segmentSmall
+		c.small.pushFront(e)
+	}
+	c.items[k] = e
+	c.mu.Unlock()
+
+	if evicted != nil {
+		c.listeners.notify(evicted.key, evicted.value, Evicted)
+	}
+	return nil
+}
+
+func (c *s3FIFOKV[K, V]) Del(ctx context.Context, k K) error {
+	c.mu.Lock()
+	e, ok := c.items[k]
+	if ok {
+		c.queue(e).remove(e)
+		delete(c.items, k)
+	}
+	if g, found := c.ghost[k]; found {
+		c.ghostQueue.remove(g)
+		delete(c.ghost, k)
+	}
+	c.mu.Unlock()
+
+	if ok {
+		c.listeners.notify(k, e.value, Deleted)
+	}
+	return nil
+}
+
+// Len returns the number of cached entries.
+func (c *s3FIFOKV[K, V]) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.items)
+}
+
+// incrementFreq increments the frequency of e, saturating at s3FIFOMaxFreq.
+func incrementFreq[K comparable, V any](e *entry[K, V]) {
+	for {
+		f := e.freq.Load()
+		if f >= s3FIFOMaxFreq || e.freq.CompareAndSwap(f, f+1) {
+			return
+		}
+	}
+}
+
+func (c *s3FIFOKV[K, V]) queue(e *entry[K, V]) *entryList[K, V] {
+	if e.segment == segmentMain {
+		return &c.main
+	}
+	return &c.small
+}
+
+// evict either removes one entry from the cache and returns it, or moves
+// one entry from the small queue to the main queue and returns nil.
+func (c *s3FIFOKV[K, V]) evict() *entry[K, V] {
+	if c.small.len >= c.smallCap || c.main.len == 0 {
+		return c.evictSmall()
+	}
+	return c.evictMain()
+}
+
+func (c *s3FIFOKV[K, V]) evictSmall() *entry[K, V] {
+	e := c.small.back()
+	c.small.remove(e)
+
+	if e.freq.Load() > 0 {
+		e.freq.Store(0)
+		e.segment = segmentMain
+		c.main.pushFront(e)
+		return nil
+	}
+
+	delete(c.items, e.key)
+	c.remember(e.key)
+	return e
+}
+
+func (c *s3FIFOKV[K, V]) evictMain() *entry[K, V] {
+	for {
+		e := c.main.back()
+		if f := e.freq.Load(); f > 0 {
+			e.freq.Store(f - 1)
+			c.main.moveToFront(e)
+			continue
+		}
+
+		c.main.remove(e)
+		delete(c.items, e.key)
+		return e
+	}
+}
+
+// remember records k in the ghost queue, bounded by the size of the main queue.
+func (c *s3FIFOKV[K, V]) remember(k K) {
+	g := &entry[K, V]{key: k}
+	c.ghost[k] = g
+	c.ghostQueue.pushFront(g)
+
+	if c.ghostQueue.len > c.size-c.smallCap {
+		old := c.ghostQueue.back()
+		c.ghostQueue.remove(old)
+		delete(c.ghost, old.key)
+	}
+}
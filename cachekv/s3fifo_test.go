@@ -0,0 +1,136 @@
+package cachekv
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	kvpkg "github.com/chenyanchen/kv"
+)
+
+func TestNewS3FIFO(t *testing.T) {
+	_, err := NewS3FIFO[string, string](0)
+	require.Error(t, err)
+}
+
+func TestS3FIFOKV_GetSetDel(t *testing.T) {
+	kv, err := NewS3FIFO[string, string](10)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	_, err = kv.Get(ctx, "missing")
+	require.ErrorIs(t, err, kvpkg.ErrNotFound)
+
+	require.NoError(t, kv.Set(ctx, "key1", "value1"))
+	v, err := kv.Get(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, "value1", v)
+
+	require.NoError(t, kv.Set(ctx, "key1", "value2"))
+	v, err = kv.Get(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, "value2", v)
+
+	require.NoError(t, kv.Del(ctx, "key1"))
+	_, err = kv.Get(ctx, "key1")
+	require.ErrorIs(t, err, kvpkg.ErrNotFound)
+}
+
+func TestS3FIFOKV_Bounded(t *testing.T) {
+	const size = 100
+
+	kv, err := NewS3FIFO[int, int](size)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	for i := range 10 * size {
+		require.NoError(t, kv.Set(ctx, i, i))
+		if i%2 == 0 {
+			_, _ = kv.Get(ctx, i)
+		}
+		assert.LessOrEqual(t, kv.Len(), size)
+	}
+}
+
+func TestS3FIFOKV_OneHitWonders(t *testing.T) {
+	const size = 10
+
+	kv, err := NewS3FIFO[string, int](size)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// Entries read while in the small queue are promoted to the main queue.
+	hot := []string{"hot1", "hot2"}
+	for _, k := range hot {
+		require.NoError(t, kv.Set(ctx, k, 0))
+		_, err = kv.Get(ctx, k)
+		require.NoError(t, err)
+	}
+
+	// Entries never read again are evicted first.
+	for i := range 5 * size {
+		require.NoError(t, kv.Set(ctx, "cold"+strconv.Itoa(i), i))
+	}
+
+	for _, k := range hot {
+		_, err = kv.Get(ctx, k)
+		require.NoError(t, err, k)
+	}
+}
+
+func TestS3FIFOKV_Ghost(t *testing.T) {
+	kv, err := NewS3FIFO[string, int](10)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, kv.Set(ctx, "a", 0))
+	for i := range 10 {
+		require.NoError(t, kv.Set(ctx, strconv.Itoa(i), i))
+	}
+
+	// "a" was evicted without being read, but is remembered.
+	_, err = kv.Get(ctx, "a")
+	require.ErrorIs(t, err, kvpkg.ErrNotFound)
+	require.Contains(t, kv.ghost, "a")
+
+	// Re-inserting a remembered key goes straight to the main queue.
+	require.NoError(t, kv.Set(ctx, "a", 1))
+	assert.Equal(t, segmentMain, kv.items["a"].segment)
+	assert.NotContains(t, kv.ghost, "a")
+}
+
+func TestS3FIFOKV_Concurrent(t *testing.T) {
+	kv, err := NewS3FIFO[string, int](500)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	const numGoroutines = 100
+	const numOps = 1000
+
+	var wg sync.WaitGroup
+	wg.Add(numGoroutines)
+
+	for g := range numGoroutines {
+		go func(id int) {
+			defer wg.Done()
+			for i := range numOps {
+				key := strconv.Itoa((id*numOps + i) % 1000)
+				switch i % 3 {
+				case 0:
+					_ = kv.Set(ctx, key, i)
+				case 1:
+					_, _ = kv.Get(ctx, key)
+				case 2:
+					_ = kv.Del(ctx, key)
+				}
+			}
+		}(g)
+	}
+
+	wg.Wait()
+	assert.LessOrEqual(t, kv.Len(), 500)
+}
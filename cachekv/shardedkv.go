@@ -3,6 +3,8 @@ package cachekv
 import (
 	"context"
 	"hash/maphash"
+	"io"
+	"time"
 
 	kv "github.com/chenyanchen/kv"
 )
@@ -12,12 +14,15 @@ const defaultShardCount = 32
 type shardedKV[K comparable, V any] struct {
 	shards []*rwMutexKV[K, V]
 	seed   maphash.Seed
+
+	listeners listeners[K, V]
+	codec     Codec
 }
 
 // NewSharded creates a sharded KV store with numShards partitions.
 // If numShards <= 0, defaults to 32.
 // Sharding reduces lock contention under high concurrent access.
-func NewSharded[K comparable, V any](numShards int) *shardedKV[K, V] {
+func NewSharded[K comparable, V any](numShards int, opts ...Option[K, V]) *shardedKV[K, V] {
 	if numShards <= 0 {
 		numShards = defaultShardCount
 	}
@@ -27,14 +32,22 @@ func NewSharded[K comparable, V any](numShards int) *shardedKV[K, V] {
 		shards[i] = NewRWMutex[K, V]()
 	}
 
+	o := newOptions(opts)
 	return &shardedKV[K, V]{
-		shards: shards,
-		seed:   maphash.MakeSeed(),
+		shards:    shards,
+		seed:      maphash.MakeSeed(),
+		listeners: o.listeners,
+		codec:     o.codec,
 	}
 }
 
 func (s *shardedKV[K, V]) getShard(k K) *rwMutexKV[K, V] {
-	return s.shards[maphash.Comparable(s.seed, k)%uint64(len(s.shards))]
+	return s.shards[shardIndex(s.seed, k, len(s.shards))]
+}
+
+// shardIndex returns the index of the shard in [0, n) that owns k.
+func shardIndex[K comparable](seed maphash.Seed, k K, n int) uint64 {
+	return maphash.Comparable(seed, k) % uint64(n)
 }
 
 func (s *shardedKV[K, V]) Get(ctx context.Context, k K) (V, error) {
@@ -52,15 +65,67 @@ func (s *shardedKV[K, V]) Get(ctx context.Context, k K) (V, error) {
 func (s *shardedKV[K, V]) Set(ctx context.Context, k K, v V) error {
 	shard := s.getShard(k)
 	shard.mu.Lock()
-	shard.m[k] = v
+	old, ok := shard.put(k, v)
 	shard.mu.Unlock()
+
+	if ok {
+		s.listeners.notify(k, old, Replaced)
+	}
 	return nil
 }
 
 func (s *shardedKV[K, V]) Del(ctx context.Context, k K) error {
 	shard := s.getShard(k)
 	shard.mu.Lock()
-	delete(shard.m, k)
+	old, ok := shard.remove(k)
 	shard.mu.Unlock()
+
+	if ok {
+		s.listeners.notify(k, old, Deleted)
+	}
+	return nil
+}
+
+// Snapshot writes all the entries of the store to w.
+// Shards are locked one after the other, so the snapshot is only
+// consistent within each shard.
+func (s *shardedKV[K, V]) Snapshot(w io.Writer) error {
+	var entries []snapshotEntry[K, V]
+	for _, shard := range s.shards {
+		shard.mu.RLock()
+		for k, v := range shard.m {
+			entries = append(entries, snapshotEntry[K, V]{key: k, value: v})
+		}
+		shard.mu.RUnlock()
+	}
+
+	return writeSnapshot(w, s.codec, entries)
+}
+
+// Restore adds the unexpired entries of a snapshot read from r to the store,
+// overwriting existing keys. Nothing is added if the snapshot is invalid.
+func (s *shardedKV[K, V]) Restore(r io.Reader) error {
+	entries, err := readSnapshot[K, V](r, s.codec)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var removals []removal[K, V]
+
+	for _, e := range entries {
+		if e.expired(now) {
+			continue
+		}
+
+		shard := s.getShard(e.key)
+		shard.mu.Lock()
+		if old, ok := shard.put(e.key, e.value); ok {
+			removals = append(removals, removal[K, V]{e.key, old, Replaced})
+		}
+		shard.mu.Unlock()
+	}
+
+	s.listeners.dispatch(removals)
 	return nil
 }
@@ -0,0 +1,208 @@
+package cachekv
+
+import (
+	"context"
+	"errors"
+	"hash/maphash"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	kv "github.com/chenyanchen/kv"
+)
+
+// lruShard is a bounded LRU partition of a shardedLRUKV.
+type lruShard[K comparable, V any] struct {
+	mu    sync.Mutex
+	size  int
+	items map[K]*entry[K, V]
+	ll    entryList[K, V]
+}
+
+type shardedLRUKV[K comparable, V any] struct {
+	shards []*lruShard[K, V]
+	seed   maphash.Seed
+	ttl    time.Duration
+
+	// sweeping is set once the expired entries are swept in the
+	// background, from the first entry set with a TTL.
+	sweeping atomic.Bool
+
+	listeners listeners[K, V]
+}
+
+// NewShardedLRU creates an LRU cache holding at most size entries, split
+// across numShards independently locked partitions. If numShards <= 0,
+// defaults to 32, and it never exceeds size. If ttl > 0, entries expire
+// ttl after they were last set. Expired entries are removed when they are
+// read, or by a background sweep, which stops once the cache is garbage
+// collected.
+//
+// Each shard evicts on its own, so the least recently used entry of the
+// whole cache is not necessarily the first one evicted.
+func NewShardedLRU[K comparable, V any](size, numShards int, ttl time.Duration, opts ...Option[K, V]) (*shardedLRUKV[K, V], error) {
+	if size <= 0 {
+		return nil, errors.New("must provide a positive size")
+	}
+	if numShards <= 0 {
+		numShards = defaultShardCount
+	}
+	numShards = min(numShards, size)
+
+	shards := make([]*lruShard[K, V], numShards)
+	for i := range shards {
+		// Spread the remainder over the first shards.
+		shardSize := size / numShards
+		if i < size%numShards {
+			shardSize++
+		}
+		shards[i] = &lruShard[K, V]{
+			size:  shardSize,
+			items: make(map[K]*entry[K, V], shardSize),
+		}
+	}
+
+	o := newOptions(opts)
+	return &shardedLRUKV[K, V]{
+		shards:    shards,
+		seed:      maphash.MakeSeed(),
+		ttl:       ttl,
+		listeners: o.listeners,
+	}, nil
+}
+
+func (s *shardedLRUKV[K, V]) getShard(k K) *lruShard[K, V] {
+	return s.shards[shardIndex(s.seed, k, len(s.shards))]
+}
+
+func (s *shardedLRUKV[K, V]) Get(ctx context.Context, k K) (V, error) {
+	shard := s.getShard(k)
+	shard.mu.Lock()
+
+	e, ok := shard.items[k]
+	if !ok {
+		shard.mu.Unlock()
+		var v V
+		return v, kv.ErrNotFound
+	}
+
+	if e.expired(time.Now()) {
+		shard.remove(e)
+		shard.mu.Unlock()
+
+		s.listeners.notify(k, e.value, Expired)
+		var v V
+		return v, kv.ErrNotFound
+	}
+
+	shard.ll.moveToFront(e)
+	v := e.value
+	shard.mu.Unlock()
+	return v, nil
+}
+
+func (s *shardedLRUKV[K, V]) Set(ctx context.Context, k K, v V) error {
+	return s.SetWithTTL(ctx, k, v, s.ttl)
+}
+
+// SetWithTTL sets k like Set, but expiring ttl after instead of after the
+// TTL of the cache, never if ttl <= 0.
+func (s *shardedLRUKV[K, V]) SetWithTTL(ctx context.Context, k K, v V, ttl time.Duration) error {
+	now := time.Now()
+	var expiresAt int64
+	if ttl > 0 {
+		expiresAt = now.Add(ttl).UnixNano()
+		if s.sweeping.CompareAndSwap(false, true) {
+			interval := s.ttl
+			if interval <= 0 {
+				interval = ttl
+			}
+			sweep(s, max(interval, minSweepInterval), (*shardedLRUKV[K, V]).removeExpired)
+		}
+	}
+
+	shard := s.getShard(k)
+	shard.mu.Lock()
+
+	if e, ok := shard.items[k]; ok {
+		old := e.value
+		e.value = v
+		e.expiresAt = expiresAt
+		shard.ll.moveToFront(e)
+		shard.mu.Unlock()
+
+		s.listeners.notify(k, old, Replaced)
+		return nil
+	}
+
+	e := &entry[K, V]{key: k, value: v, expiresAt: expiresAt}
+	shard.items[k] = e
+	shard.ll.pushFront(e)
+
+	var evicted *entry[K, V]
+	if shard.ll.len > shard.size {
+		evicted = shard.ll.back()
+		shard.remove(evicted)
+	}
+	shard.mu.Unlock()
+
+	if evicted != nil {
+		reason := Evicted
+		if evicted.expired(now) {
+			reason = Expired
+		}
+		s.listeners.notify(evicted.key, evicted.value, reason)
+	}
+	return nil
+}
+
+func (s *shardedLRUKV[K, V]) Del(ctx context.Context, k K) error {
+	shard := s.getShard(k)
+	shard.mu.Lock()
+	e, ok := shard.items[k]
+	if ok {
+		shard.remove(e)
+	}
+	shard.mu.Unlock()
+
+	if ok {
+		s.listeners.notify(k, e.value, Deleted)
+	}
+	return nil
+}
+
+// Len returns the number of entries across all shards, including
+// expired entries that have not been removed yet.
+func (s *shardedLRUKV[K, V]) Len() int {
+	n := 0
+	for _, shard := range s.shards {
+		shard.mu.Lock()
+		n += shard.ll.len
+		shard.mu.Unlock()
+	}
+	return n
+}
+
+// removeExpired removes the expired entries of every shard.
+func (s *shardedLRUKV[K, V]) removeExpired() {
+	now := time.Now()
+	var removals []removal[K, V]
+	for _, shard := range s.shards {
+		shard.mu.Lock()
+		for e := shard.ll.back(); e != nil; {
+			prev := shard.ll.before(e)
+			if e.expired(now) {
+				shard.remove(e)
+				removals = append(removals, removal[K, V]{e.key, e.value, Expired})
+			}
+			e = prev
+		}
+		shard.mu.Unlock()
+	}
+	s.listeners.dispatch(removals)
+}
+
+func (s *lruShard[K, V]) remove(e *entry[K, V]) {
+	s.ll.remove(e)
+	delete(s.items, e.key)
+}
@@ -0,0 +1,233 @@
+package cachekv
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	kvpkg "github.com/chenyanchen/kv"
+)
+
+func TestNewShardedLRU(t *testing.T) {
+	_, err := NewShardedLRU[string, string](0, 16, 0)
+	require.Error(t, err)
+
+	// Capacity is split across shards, remainder included.
+	kv, err := NewShardedLRU[string, string](100, 16, 0)
+	require.NoError(t, err)
+	require.Len(t, kv.shards, 16)
+
+	total := 0
+	for _, shard := range kv.shards {
+		total += shard.size
+	}
+	assert.Equal(t, 100, total)
+
+	// Never more shards than entries.
+	kv, err = NewShardedLRU[string, string](4, 16, 0)
+	require.NoError(t, err)
+	assert.Len(t, kv.shards, 4)
+}
+
+func TestShardedLRUKV_GetSetDel(t *testing.T) {
+	kv, err := NewShardedLRU[string, string](100, 16, 0)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	_, err = kv.Get(ctx, "missing")
+	require.ErrorIs(t, err, kvpkg.ErrNotFound)
+
+	require.NoError(t, kv.Set(ctx, "key1", "value1"))
+	v, err := kv.Get(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, "value1", v)
+
+	require.NoError(t, kv.Set(ctx, "key1", "value2"))
+	v, err = kv.Get(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, "value2", v)
+
+	require.NoError(t, kv.Del(ctx, "key1"))
+	_, err = kv.Get(ctx, "key1")
+	require.ErrorIs(t, err, kvpkg.ErrNotFound)
+}
+
+func TestShardedLRUKV_Bounded(t *testing.T) {
+	const size = 100
+
+	kv, err := NewShardedLRU[int, int](size, 8, 0)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	for i := range 10 * size {
+		require.NoError(t, kv.Set(ctx, i, i))
+	}
+	assert.Equal(t, size, kv.Len())
+}
+
+func TestShardedLRUKV_Evict(t *testing.T) {
+	// A single shard behaves as a plain LRU.
+	kv, err := NewShardedLRU[string, string](2, 1, 0)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, kv.Set(ctx, "a", "1"))
+	require.NoError(t, kv.Set(ctx, "b", "2"))
+	_, err = kv.Get(ctx, "a")
+	require.NoError(t, err)
+	require.NoError(t, kv.Set(ctx, "c", "3"))
+
+	_, err = kv.Get(ctx, "b")
+	require.ErrorIs(t, err, kvpkg.ErrNotFound)
+	_, err = kv.Get(ctx, "a")
+	require.NoError(t, err)
+}
+
+func TestShardedLRUKV_TTL(t *testing.T) {
+	kv, err := NewShardedLRU[string, string](10, 2, 10*time.Millisecond)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, kv.Set(ctx, "key1", "value1"))
+	_, err = kv.Get(ctx, "key1")
+	require.NoError(t, err)
+
+	time.Sleep(20 * time.Millisecond)
+	_, err = kv.Get(ctx, "key1")
+	require.ErrorIs(t, err, kvpkg.ErrNotFound)
+	assert.Equal(t, 0, kv.Len())
+}
+
+func TestShardedLRUKV_Sweep(t *testing.T) {
+	var expired atomic.Int32
+	c, err := NewShardedLRU(100, 4, 10*time.Millisecond, WithListener(func(_, _ string, reason RemovalReason) {
+		if reason == Expired {
+			expired.Add(1)
+		}
+	}))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// Entries never read again are removed by the sweep.
+	for i := range 10 {
+		require.NoError(t, c.Set(ctx, "key"+strconv.Itoa(i), "value"))
+	}
+	require.Eventually(t, func() bool { return expired.Load() == 10 }, time.Second, time.Millisecond)
+	assert.Zero(t, c.Len())
+}
+
+func TestShardedLRUKV_Concurrent(t *testing.T) {
+	kv, err := NewShardedLRU[string, int](500, 32, 0)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	const numGoroutines = 100
+	const numOps = 1000
+
+	var wg sync.WaitGroup
+	wg.Add(numGoroutines)
+
+	for g := range numGoroutines {
+		go func(id int) {
+			defer wg.Done()
+			for i := range numOps {
+				key := strconv.Itoa((id*numOps + i) % 1000)
+				switch i % 3 {
+				case 0:
+					_ = kv.Set(ctx, key, i)
+				case 1:
+					_, _ = kv.Get(ctx, key)
+				case 2:
+					_ = kv.Del(ctx, key)
+				}
+			}
+		}(g)
+	}
+
+	wg.Wait()
+	assert.LessOrEqual(t, kv.Len(), 500)
+}
+
+func BenchmarkShardedLRU_Get(b *testing.B) {
+	for _, shards := range []int{16, 32, 64} {
+		b.Run("shards="+strconv.Itoa(shards), func(b *testing.B) {
+			kv, err := NewShardedLRU[string, string](benchKeyCount, shards, 0)
+			if err != nil {
+				b.Fatal(err)
+			}
+			ctx := context.Background()
+
+			// Pre-populate
+			for i := range benchKeyCount {
+				_ = kv.Set(ctx, strconv.Itoa(i), "value")
+			}
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					_, _ = kv.Get(ctx, strconv.Itoa(i%benchKeyCount))
+					i++
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkShardedLRU_Set(b *testing.B) {
+	for _, shards := range []int{16, 32, 64} {
+		b.Run("shards="+strconv.Itoa(shards), func(b *testing.B) {
+			kv, err := NewShardedLRU[string, string](benchKeyCount, shards, 0)
+			if err != nil {
+				b.Fatal(err)
+			}
+			ctx := context.Background()
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					_ = kv.Set(ctx, strconv.Itoa(i%benchKeyCount), "value")
+					i++
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkShardedLRU_Mixed(b *testing.B) {
+	for _, shards := range []int{16, 32, 64} {
+		b.Run("shards="+strconv.Itoa(shards), func(b *testing.B) {
+			kv, err := NewShardedLRU[string, string](benchKeyCount, shards, 0)
+			if err != nil {
+				b.Fatal(err)
+			}
+			ctx := context.Background()
+
+			// Pre-populate
+			for i := range benchKeyCount {
+				_ = kv.Set(ctx, strconv.Itoa(i), "value")
+			}
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					key := strconv.Itoa(i % benchKeyCount)
+					if i%5 == 0 {
+						_ = kv.Set(ctx, key, "value")
+					} else {
+						_, _ = kv.Get(ctx, key)
+					}
+					i++
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package cachekv
+
+import "math/bits"
+
+const (
+	sketchDepth      = 4
+	sketchMaxCount   = 15
+	sketchSampleRate = 10
+)
+
+// sketchSeeds are odd constants used to derive one index per row from a single hash.
+var sketchSeeds = [sketchDepth]uint64{ //nolint:gochecknoglobals // read-only hashing constants
+	0xc3a5c85c97cb3127, 0xb492b66fbe98f273, 0x9ae16a3b2f90404f, 0xcbf29ce484222325,
+}
+
+// countMinSketch is a probabilistic frequency estimator with small (4-bit)
+// saturating counters. Counters are periodically halved so that the
+// estimate reflects recent popularity rather than all-time popularity.
+type countMinSketch struct {
+	rows [sketchDepth][]uint8
+	mask uint64
+
+	additions  int
+	sampleSize int
+}
+
+// newCountMinSketch creates a sketch sized for a cache of the given capacity.
+func newCountMinSketch(capacity int) *countMinSketch {
+	width := uint64(1)
+	if capacity > 1 {
+		width = 1 << bits.Len64(uint64(capacity-1))
+	}
+
+	s := &countMinSketch{
+		mask:       width - 1,
+		sampleSize: sketchSampleRate * int(width),
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+func (s *countMinSketch) index(h uint64, row int) uint64 {
+	h *= sketchSeeds[row]
+	return (h ^ h>>32) & s.mask
+}
+
+// increment records one occurrence of the hashed key.
+func (s *countMinSketch) increment(h uint64) {
+	added := false
+	for i := range s.rows {
+		c := &s.rows[i][s.index(h, i)]
+		if *c < sketchMaxCount {
+			*c++
+			added = true
+		}
+	}
+
+	if added {
+		s.additions++
+		if s.additions >= s.sampleSize {
+			s.reset()
+		}
+	}
+}
+
+// estimate returns the estimated frequency of the hashed key.
+func (s *countMinSketch) estimate(h uint64) uint8 {
+	m := uint8(sketchMaxCount)
+	for i := range s.rows {
+		m = min(m, s.rows[i][s.index(h, i)])
+	}
+	return m
+}
+
+// reset halves all counters, aging old frequencies.
+func (s *countMinSketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.additions /= 2
+}
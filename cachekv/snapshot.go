@@ -0,0 +1,178 @@
+package cachekv
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"time"
+)
+
+// ErrInvalidSnapshot is returned by Restore when the snapshot is truncated,
+// corrupted, written by an unsupported format version or holds entries the
+// codec cannot decode.
+var ErrInvalidSnapshot = errors.New("invalid snapshot")
+
+const snapshotVersion uint16 = 1
+
+// snapshotMagic identifies a cachekv snapshot.
+const snapshotMagic = "CKVS"
+
+// snapshotHeaderLen is the length of the magic and the version.
+const snapshotHeaderLen = len(snapshotMagic) + 2
+
+//nolint:gochecknoglobals // read-only checksum table
+var snapshotTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Snapshotter is implemented by stores whose content can be saved and restored.
+type Snapshotter interface {
+	// Snapshot writes the content of the store to w.
+	Snapshot(w io.Writer) error
+	// Restore adds the entries of a snapshot read from r to the store.
+	Restore(r io.Reader) error
+}
+
+// snapshotEntry is an entry of a snapshot.
+type snapshotEntry[K comparable, V any] struct {
+	key   K
+	value V
+
+	// expiresAt is the expiration time in Unix nanoseconds, zero means never.
+	expiresAt int64
+}
+
+// expired reports whether e has a TTL that is over at now.
+func (e snapshotEntry[K, V]) expired(now time.Time) bool {
+	return e.expiresAt != 0 && now.UnixNano() >= e.expiresAt
+}
+
+// writeSnapshot writes entries to w in order.
+//
+// The format is the magic and the big-endian format version, followed by
+// the number of entries and then, for each entry, the length-prefixed
+// marshaled key, the length-prefixed marshaled value and the expiration
+// time, all as varints. It ends with the big-endian CRC-32C of all the
+// preceding bytes.
+func writeSnapshot[K comparable, V any](w io.Writer, codec Codec, entries []snapshotEntry[K, V]) error {
+	bw := bufio.NewWriter(w)
+	crc := crc32.New(snapshotTable)
+	mw := io.MultiWriter(bw, crc)
+
+	var buf [binary.MaxVarintLen64]byte
+	writeBytes := func(p []byte) error {
+		if _, err := mw.Write(binary.AppendUvarint(buf[:0], uint64(len(p)))); err != nil {
+			return err
+		}
+		_, err := mw.Write(p)
+		return err
+	}
+
+	header := binary.BigEndian.AppendUint16([]byte(snapshotMagic), snapshotVersion)
+	header = binary.AppendUvarint(header, uint64(len(entries)))
+	if _, err := mw.Write(header); err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		k, err := codec.Marshal(e.key)
+		if err != nil {
+			return fmt.Errorf("marshal key: %w", err)
+		}
+		v, err := codec.Marshal(e.value)
+		if err != nil {
+			return fmt.Errorf("marshal value: %w", err)
+		}
+
+		if err = writeBytes(k); err != nil {
+			return err
+		}
+		if err = writeBytes(v); err != nil {
+			return err
+		}
+		if _, err = mw.Write(binary.AppendVarint(buf[:0], e.expiresAt)); err != nil {
+			return err
+		}
+	}
+
+	if _, err := bw.Write(binary.BigEndian.AppendUint32(nil, crc.Sum32())); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// readSnapshot reads the entries of a snapshot written by writeSnapshot.
+// The whole snapshot is validated before any entry is returned.
+func readSnapshot[K comparable, V any](r io.Reader, codec Codec) ([]snapshotEntry[K, V], error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < snapshotHeaderLen+crc32.Size {
+		return nil, fmt.Errorf("%w: too short", ErrInvalidSnapshot)
+	}
+	if string(data[:len(snapshotMagic)]) != snapshotMagic {
+		return nil, fmt.Errorf("%w: bad magic", ErrInvalidSnapshot)
+	}
+	if v := binary.BigEndian.Uint16(data[len(snapshotMagic):]); v != snapshotVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidSnapshot, v)
+	}
+
+	body, sum := data[:len(data)-crc32.Size], data[len(data)-crc32.Size:]
+	if crc32.Checksum(body, snapshotTable) != binary.BigEndian.Uint32(sum) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrInvalidSnapshot)
+	}
+
+	br := bytes.NewReader(body[snapshotHeaderLen:])
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, fmt.Errorf("%w: read count: %w", ErrInvalidSnapshot, err)
+	}
+
+	readBytes := func() ([]byte, error) {
+		size, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		if size > uint64(br.Len()) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		p := make([]byte, size)
+		_, err = io.ReadFull(br, p)
+		return p, err
+	}
+
+	// Do not trust the count for the allocation, the checksum is not a signature.
+	entries := make([]snapshotEntry[K, V], 0, min(n, uint64(br.Len())))
+	for range n {
+		var e snapshotEntry[K, V]
+
+		k, err := readBytes()
+		if err != nil {
+			return nil, fmt.Errorf("%w: read key: %w", ErrInvalidSnapshot, err)
+		}
+		v, err := readBytes()
+		if err != nil {
+			return nil, fmt.Errorf("%w: read value: %w", ErrInvalidSnapshot, err)
+		}
+		if e.expiresAt, err = binary.ReadVarint(br); err != nil {
+			return nil, fmt.Errorf("%w: read expiration: %w", ErrInvalidSnapshot, err)
+		}
+
+		if err = codec.Unmarshal(k, &e.key); err != nil {
+			return nil, fmt.Errorf("%w: unmarshal key: %w", ErrInvalidSnapshot, err)
+		}
+		if err = codec.Unmarshal(v, &e.value); err != nil {
+			return nil, fmt.Errorf("%w: unmarshal value: %w", ErrInvalidSnapshot, err)
+		}
+		entries = append(entries, e)
+	}
+
+	if br.Len() != 0 {
+		return nil, fmt.Errorf("%w: trailing data", ErrInvalidSnapshot)
+	}
+	return entries, nil
+}
@@ -0,0 +1,204 @@
+package cachekv
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	kvpkg "github.com/chenyanchen/kv"
+)
+
+type snapshotKV interface {
+	kvpkg.KV[string, int]
+	Snapshotter
+}
+
+func TestSnapshot_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(...Option[string, int]) snapshotKV
+	}{
+		{
+			name:  "RWMutex",
+			build: func(opts ...Option[string, int]) snapshotKV { return NewRWMutex(opts...) },
+		}, {
+			name:  "Sharded",
+			build: func(opts ...Option[string, int]) snapshotKV { return NewSharded(4, opts...) },
+		}, {
+			name: "LRU",
+			build: func(opts ...Option[string, int]) snapshotKV {
+				c, err := NewLRU(100, nil, 0, opts...)
+				require.NoError(t, err)
+				return c
+			},
+		},
+	}
+	codecs := map[string]Codec{"gob": GobCodec{}, "json": JSONCodec{}}
+
+	for _, tt := range tests {
+		for codecName, codec := range codecs {
+			t.Run(tt.name+"/"+codecName, func(t *testing.T) {
+				ctx := context.Background()
+
+				src := tt.build(WithCodec[string, int](codec))
+				require.NoError(t, src.Set(ctx, "a", 1))
+				require.NoError(t, src.Set(ctx, "b", 2))
+
+				var buf bytes.Buffer
+				require.NoError(t, src.Snapshot(&buf))
+
+				var replaced []string
+				dst := tt.build(
+					WithCodec[string, int](codec),
+					WithListener(func(k string, _ int, reason RemovalReason) {
+						replaced = append(replaced, k+" "+reason.String())
+					}),
+				)
+				require.NoError(t, dst.Set(ctx, "a", 0))
+				require.NoError(t, dst.Restore(&buf))
+
+				for k, want := range map[string]int{"a": 1, "b": 2} {
+					v, err := dst.Get(ctx, k)
+					require.NoError(t, err)
+					assert.Equal(t, want, v)
+				}
+				assert.Equal(t, []string{"a replaced"}, replaced)
+			})
+		}
+	}
+}
+
+func TestSnapshot_Invalid(t *testing.T) {
+	ctx := context.Background()
+
+	src := NewRWMutex[string, int]()
+	require.NoError(t, src.Set(ctx, "a", 1))
+
+	var buf bytes.Buffer
+	require.NoError(t, src.Snapshot(&buf))
+	valid := buf.Bytes()
+
+	corrupt := func(f func(p []byte) []byte) []byte {
+		return f(bytes.Clone(valid))
+	}
+
+	tests := map[string][]byte{
+		"empty":     nil,
+		"magic":     corrupt(func(p []byte) []byte { p[0] = 'X'; return p }),
+		"version":   corrupt(func(p []byte) []byte { p[5]++; return p }),
+		"checksum":  corrupt(func(p []byte) []byte { p[len(p)-1]++; return p }),
+		"body":      corrupt(func(p []byte) []byte { p[snapshotHeaderLen+2]++; return p }),
+		"truncated": valid[:len(valid)-1],
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			dst := NewRWMutex[string, int]()
+			require.ErrorIs(t, dst.Restore(bytes.NewReader(data)), ErrInvalidSnapshot)
+
+			_, err := dst.Get(ctx, "a")
+			require.ErrorIs(t, err, kvpkg.ErrNotFound, "invalid snapshot must not be applied")
+		})
+	}
+
+	// Values the codec cannot decode.
+	other := NewRWMutex[string, string]()
+	require.NoError(t, other.Set(ctx, "a", "one"))
+	buf.Reset()
+	require.NoError(t, other.Snapshot(&buf))
+	dst := NewRWMutex[string, int]()
+	require.ErrorIs(t, dst.Restore(&buf), ErrInvalidSnapshot)
+}
+
+func TestLRUKV_SnapshotRecency(t *testing.T) {
+	ctx := context.Background()
+
+	src, err := NewLRU[string, int](3, nil, 0)
+	require.NoError(t, err)
+	for i, k := range []string{"a", "b", "c"} {
+		require.NoError(t, src.Set(ctx, k, i))
+	}
+	// "a" becomes the most recently used.
+	_, err = src.Get(ctx, "a")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, src.Snapshot(&buf))
+
+	dst, err := NewLRU[string, int](3, nil, 0)
+	require.NoError(t, err)
+	require.NoError(t, dst.Restore(&buf))
+
+	// The least recently used entry, "b", is evicted first.
+	require.NoError(t, dst.Set(ctx, "d", 3))
+	_, err = dst.Get(ctx, "b")
+	require.ErrorIs(t, err, kvpkg.ErrNotFound)
+	for _, k := range []string{"a", "c", "d"} {
+		_, err = dst.Get(ctx, k)
+		require.NoError(t, err, k)
+	}
+}
+
+func TestLRUKV_SnapshotTTL(t *testing.T) {
+	ctx := context.Background()
+
+	src, err := NewLRU[string, int](10, nil, 50*time.Millisecond)
+	require.NoError(t, err)
+	require.NoError(t, src.Set(ctx, "a", 1))
+
+	var buf bytes.Buffer
+	require.NoError(t, src.Snapshot(&buf))
+
+	// The remaining TTL is kept, not reset to the TTL of the new cache.
+	dst, err := NewLRU[string, int](10, nil, time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, dst.Restore(&buf))
+
+	_, err = dst.Get(ctx, "a")
+	require.NoError(t, err)
+
+	time.Sleep(60 * time.Millisecond)
+	_, err = dst.Get(ctx, "a")
+	require.ErrorIs(t, err, kvpkg.ErrNotFound)
+}
+
+func TestPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+
+	// Cold start without a snapshot file.
+	first := NewRWMutex[string, int]()
+	ctx, cancel := context.WithCancel(context.Background())
+	wait, err := Persist(ctx, path, first)
+	require.NoError(t, err)
+
+	require.NoError(t, first.Set(context.Background(), "a", 1))
+	cancel()
+	require.NoError(t, wait())
+	require.NoError(t, wait(), "wait may be called again")
+
+	// Warm start from the snapshot saved on shutdown.
+	second := NewRWMutex[string, int]()
+	ctx, cancel = context.WithCancel(context.Background())
+	wait, err = Persist(ctx, path, second)
+	require.NoError(t, err)
+
+	v, err := second.Get(context.Background(), "a")
+	require.NoError(t, err)
+	assert.Equal(t, 1, v)
+
+	cancel()
+	require.NoError(t, wait())
+}
+
+func TestPersist_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+	require.NoError(t, os.WriteFile(path, []byte("garbage"), 0o600))
+
+	_, err := Persist(context.Background(), path, NewRWMutex[string, int]())
+	require.ErrorIs(t, err, ErrInvalidSnapshot)
+}
@@ -0,0 +1,205 @@
+package cachekv
+
+import (
+	"context"
+	"errors"
+	"hash/maphash"
+	"sync"
+
+	kv "github.com/chenyanchen/kv"
+)
+
+const (
+	segmentWindow uint8 = iota
+	segmentProbation
+	segmentProtected
+)
+
+const (
+	tinyLFUWindowPercent    = 1
+	tinyLFUProtectedPercent = 80
+)
+
+// tinyLFUKV is a W-TinyLFU cache.
+//
+// New entries enter a small window LRU. When the window overflows, its
+// victim competes with the victim of the main segmented LRU, and the
+// count-min sketch decides which one is more likely to be used again.
+// This keeps one-off accesses, such as a full scan, from flushing the
+// frequently used entries.
+type tinyLFUKV[K comparable, V any] struct {
+	mu sync.Mutex
+
+	items  map[K]*entry[K, V]
+	sketch *countMinSketch
+	seed   maphash.Seed
+	// hashKey replaces the seeded hash of the keys if set, for the
+	// benchmarks to be reproducible.
+	hashKey func(K) uint64
+
+	window    entryList[K, V]
+	probation entryList[K, V]
+	protected entryList[K, V]
+
+	windowCap    int
+	mainCap      int
+	protectedCap int
+
+	listeners listeners[K, V]
+}
+
+// NewTinyLFU creates a W-TinyLFU cache holding at most size entries.
+func NewTinyLFU[K comparable, V any](size int, opts ...Option[K, V]) (*tinyLFUKV[K, V], error) {
+	if size <= 0 {
+		return nil, errors.New("must provide a positive size")
+	}
+
+	windowCap := max(1, size*tinyLFUWindowPercent/100)
+	mainCap := size - windowCap
+
+	o := newOptions(opts)
+	return &tinyLFUKV[K, V]{
+		items:        make(map[K]*entry[K, V], size),
+		sketch:       newCountMinSketch(size),
+		seed:         maphash.MakeSeed(),
+		windowCap:    windowCap,
+		mainCap:      mainCap,
+		protectedCap: mainCap * tinyLFUProtectedPercent / 100,
+		listeners:    o.listeners,
+	}, nil
+}
+
+func (c *tinyLFUKV[K, V]) Get(ctx context.Context, k K) (V, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sketch.increment(c.hash(k))
+
+	e, ok := c.items[k]
+	if !ok {
+		var v V
+		return v, kv.ErrNotFound
+	}
+
+	c.touch(e)
+	return e.value, nil
+}
+
+func (c *tinyLFUKV[K, V]) Set(ctx context.Context, k K, v V) error {
+	c.mu.Lock()
+
+	if e, ok := c.items[k]; ok {
+		old := e.value
+		e.value = v
+		c.touch(e)
+		c.mu.Unlock()
+
+		c.listeners.notify(k, old, Replaced)
+		return nil
+	}
+
+	e := &entry[K, V]{key: k, value: v, segment: segmentWindow}
+	c.items[k] = e
+	c.window.pushFront(e)
+
+	var evicted *entry[K, V]
+	if c.window.len > c.windowCap {
+		evicted = c.admit(c.window.back())
+	}
+	c.mu.Unlock()
+
+	if evicted != nil {
+		c.listeners.notify(evicted.key, evicted.value, Evicted)
+	}
+	return nil
+}
+
+func (c *tinyLFUKV[K, V]) Del(ctx context.Context, k K) error {
+	c.mu.Lock()
+	e, ok := c.items[k]
+	if ok {
+		c.segment(e).remove(e)
+		delete(c.items, k)
+	}
+	c.mu.Unlock()
+
+	if ok {
+		c.listeners.notify(k, e.value, Deleted)
+	}
+	return nil
+}
+
+// Len returns the number of cached entries.
+func (c *tinyLFUKV[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.items)
+}
+
+func (c *tinyLFUKV[K, V]) hash(k K) uint64 {
+	if c.hashKey != nil {
+		return c.hashKey(k)
+	}
+	return maphash.Comparable(c.seed, k)
+}
+
+func (c *tinyLFUKV[K, V]) segment(e *entry[K, V]) *entryList[K, V] {
+	switch e.segment {
+	case segmentProbation:
+		return &c.probation
+	case segmentProtected:
+		return &c.protected
+	default:
+		return &c.window
+	}
+}
+
+// touch records a hit on e, promoting it from probation to protected.
+func (c *tinyLFUKV[K, V]) touch(e *entry[K, V]) {
+	if e.segment != segmentProbation {
+		c.segment(e).moveToFront(e)
+		return
+	}
+
+	c.probation.remove(e)
+	e.segment = segmentProtected
+	c.protected.pushFront(e)
+
+	// Demote the least recently used protected entry to make room.
+	if c.protected.len > c.protectedCap {
+		demoted := c.protected.back()
+		c.protected.remove(demoted)
+		demoted.segment = segmentProbation
+		c.probation.pushFront(demoted)
+	}
+}
+
+// admit moves the window victim candidate into the main segment if it is
+// estimated to be used more often than the main victim, otherwise evicts it.
+// It returns the evicted entry, if any.
+func (c *tinyLFUKV[K, V]) admit(candidate *entry[K, V]) *entry[K, V] {
+	c.window.remove(candidate)
+
+	if c.probation.len+c.protected.len < c.mainCap {
+		candidate.segment = segmentProbation
+		c.probation.pushFront(candidate)
+		return nil
+	}
+
+	victim := c.probation.back()
+	if victim == nil {
+		victim = c.protected.back()
+	}
+
+	if victim == nil || c.sketch.estimate(c.hash(candidate.key)) <= c.sketch.estimate(c.hash(victim.key)) {
+		delete(c.items, candidate.key)
+		return candidate
+	}
+
+	c.segment(victim).remove(victim)
+	delete(c.items, victim.key)
+
+	candidate.segment = segmentProbation
+	c.probation.pushFront(candidate)
+	return victim
+}
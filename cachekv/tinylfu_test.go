@@ -0,0 +1,114 @@
+package cachekv
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	kvpkg "github.com/chenyanchen/kv"
+)
+
+func TestNewTinyLFU(t *testing.T) {
+	_, err := NewTinyLFU[string, string](0)
+	require.Error(t, err)
+}
+
+func TestTinyLFUKV_GetSetDel(t *testing.T) {
+	kv, err := NewTinyLFU[string, string](100)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	_, err = kv.Get(ctx, "missing")
+	require.ErrorIs(t, err, kvpkg.ErrNotFound)
+
+	require.NoError(t, kv.Set(ctx, "key1", "value1"))
+	v, err := kv.Get(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, "value1", v)
+
+	require.NoError(t, kv.Set(ctx, "key1", "value2"))
+	v, err = kv.Get(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, "value2", v)
+
+	require.NoError(t, kv.Del(ctx, "key1"))
+	_, err = kv.Get(ctx, "key1")
+	require.ErrorIs(t, err, kvpkg.ErrNotFound)
+}
+
+func TestTinyLFUKV_Bounded(t *testing.T) {
+	const size = 100
+
+	kv, err := NewTinyLFU[int, int](size)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	for i := range 10 * size {
+		require.NoError(t, kv.Set(ctx, i, i))
+		assert.LessOrEqual(t, kv.Len(), size)
+	}
+}
+
+func TestTinyLFUKV_ScanResistant(t *testing.T) {
+	const size = 100
+
+	kv, err := NewTinyLFU[string, int](size)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// Build a frequently used hot set.
+	hot := make([]string, size/2)
+	for i := range hot {
+		hot[i] = "hot" + strconv.Itoa(i)
+	}
+	for range 5 {
+		for _, k := range hot {
+			if _, err := kv.Get(ctx, k); err != nil {
+				require.NoError(t, kv.Set(ctx, k, 0))
+			}
+		}
+	}
+
+	// A one-off scan touching many more keys than the cache holds.
+	for i := range 10 * size {
+		k := "scan" + strconv.Itoa(i)
+		if _, err := kv.Get(ctx, k); err != nil {
+			require.NoError(t, kv.Set(ctx, k, i))
+		}
+	}
+
+	hits := 0
+	for _, k := range hot {
+		if _, err := kv.Get(ctx, k); err == nil {
+			hits++
+		}
+	}
+	assert.Greater(t, hits, len(hot)*9/10, "scan flushed the hot set")
+}
+
+func TestCountMinSketch(t *testing.T) {
+	s := newCountMinSketch(64)
+
+	for range 5 {
+		s.increment(1)
+	}
+	s.increment(2)
+
+	assert.GreaterOrEqual(t, s.estimate(1), uint8(5))
+	assert.GreaterOrEqual(t, s.estimate(2), uint8(1))
+	assert.Less(t, s.estimate(2), s.estimate(1))
+
+	// Counters saturate.
+	for range 100 {
+		s.increment(3)
+	}
+	assert.LessOrEqual(t, s.estimate(3), uint8(sketchMaxCount))
+
+	// Reset halves the counters.
+	before := s.estimate(1)
+	s.reset()
+	assert.Equal(t, before/2, s.estimate(1))
+}
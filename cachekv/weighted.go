@@ -0,0 +1,157 @@
+package cachekv
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	kv "github.com/chenyanchen/kv"
+)
+
+// ErrEntryTooHeavy is returned by a cost-aware cache when a single entry
+// weighs more than the whole capacity of the cache.
+var ErrEntryTooHeavy = errors.New("entry weight exceeds cache capacity")
+
+// weightedKV is an LRU cache bounded by the total weight of its entries
+// instead of the number of entries.
+type weightedKV[K comparable, V any] struct {
+	mu sync.Mutex
+
+	maxWeight int64
+	weight    int64
+	weigher   func(K, V) int64
+	onEvict   func(K, V)
+	listeners listeners[K, V]
+
+	items map[K]*entry[K, V]
+	ll    entryList[K, V]
+}
+
+// NewWeighted creates an LRU cache whose capacity is the total weight of
+// its entries. The weigher reports the cost of each entry, e.g. its size in bytes.
+//
+// On Set, the least recently used entries are evicted until the total weight
+// fits in maxWeight. An entry heavier than maxWeight is rejected with ErrEntryTooHeavy.
+//
+// onEvict, if not nil, is called for every entry that is evicted or deleted.
+func NewWeighted[K comparable, V any](maxWeight int64, weigher func(K, V) int64, onEvict func(K, V), opts ...Option[K, V]) (*weightedKV[K, V], error) {
+	if maxWeight <= 0 {
+		return nil, errors.New("max weight must be positive")
+	}
+	if weigher == nil {
+		return nil, errors.New("weigher is nil")
+	}
+
+	o := newOptions(opts)
+	return &weightedKV[K, V]{
+		maxWeight: maxWeight,
+		weigher:   weigher,
+		onEvict:   onEvict,
+		listeners: o.listeners,
+		items:     make(map[K]*entry[K, V]),
+	}, nil
+}
+
+func (c *weightedKV[K, V]) Get(ctx context.Context, k K) (V, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[k]
+	if !ok {
+		var v V
+		return v, kv.ErrNotFound
+	}
+
+	c.ll.moveToFront(e)
+	return e.value, nil
+}
+
+func (c *weightedKV[K, V]) Set(ctx context.Context, k K, v V) error {
+	w := c.weigher(k, v)
+	if w < 0 {
+		return errors.New("weigher returned a negative weight")
+	}
+
+	c.mu.Lock()
+
+	if w > c.maxWeight {
+		// The old value must not outlive a rejected update.
+		var removals []removal[K, V]
+		if e, ok := c.items[k]; ok {
+			c.removeEntry(e)
+			removals = append(removals, removal[K, V]{e.key, e.value, Evicted})
+		}
+		c.mu.Unlock()
+
+		c.notify(removals)
+		return ErrEntryTooHeavy
+	}
+
+	var removals []removal[K, V]
+	if e, ok := c.items[k]; ok {
+		removals = append(removals, removal[K, V]{k, e.value, Replaced})
+		c.weight += w - e.weight
+		e.value = v
+		e.weight = w
+		c.ll.moveToFront(e)
+	} else {
+		e = &entry[K, V]{key: k, value: v, weight: w}
+		c.items[k] = e
+		c.ll.pushFront(e)
+		c.weight += w
+	}
+
+	for c.weight > c.maxWeight {
+		e := c.ll.back()
+		c.removeEntry(e)
+		removals = append(removals, removal[K, V]{e.key, e.value, Evicted})
+	}
+	c.mu.Unlock()
+
+	c.notify(removals)
+	return nil
+}
+
+func (c *weightedKV[K, V]) Del(ctx context.Context, k K) error {
+	c.mu.Lock()
+	e, ok := c.items[k]
+	if ok {
+		c.removeEntry(e)
+	}
+	c.mu.Unlock()
+
+	if ok {
+		c.notify([]removal[K, V]{{e.key, e.value, Deleted}})
+	}
+	return nil
+}
+
+// Weight returns the current total weight of the cached entries.
+func (c *weightedKV[K, V]) Weight() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.weight
+}
+
+// Len returns the number of cached entries.
+func (c *weightedKV[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.len
+}
+
+func (c *weightedKV[K, V]) removeEntry(e *entry[K, V]) {
+	c.ll.remove(e)
+	delete(c.items, e.key)
+	c.weight -= e.weight
+}
+
+// notify calls onEvict and the listeners for removals, outside the lock.
+func (c *weightedKV[K, V]) notify(removals []removal[K, V]) {
+	for _, r := range removals {
+		if c.onEvict != nil && r.reason != Replaced {
+			c.onEvict(r.key, r.value)
+		}
+		c.listeners.notify(r.key, r.value, r.reason)
+	}
+}
@@ -0,0 +1,88 @@
+package cachekv
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	kvpkg "github.com/chenyanchen/kv"
+)
+
+func byteLen(_ string, v []byte) int64 { return int64(len(v)) }
+
+func TestNewWeighted(t *testing.T) {
+	_, err := NewWeighted[string, []byte](0, byteLen, nil)
+	require.Error(t, err)
+
+	_, err = NewWeighted[string, []byte](10, nil, nil)
+	require.Error(t, err)
+}
+
+func TestWeightedKV_Evict(t *testing.T) {
+	var evicted []string
+	kv, err := NewWeighted(10, byteLen, func(k string, _ []byte) { evicted = append(evicted, k) })
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, kv.Set(ctx, "a", make([]byte, 4)))
+	require.NoError(t, kv.Set(ctx, "b", make([]byte, 4)))
+	assert.Equal(t, int64(8), kv.Weight())
+
+	// Touch "a" so that "b" is the least recently used.
+	_, err = kv.Get(ctx, "a")
+	require.NoError(t, err)
+
+	// Needs 7 more, so both "b" and then "a" must go.
+	require.NoError(t, kv.Set(ctx, "c", make([]byte, 7)))
+	assert.Equal(t, []string{"b", "a"}, evicted)
+	assert.Equal(t, int64(7), kv.Weight())
+	assert.Equal(t, 1, kv.Len())
+
+	_, err = kv.Get(ctx, "b")
+	require.ErrorIs(t, err, kvpkg.ErrNotFound)
+}
+
+func TestWeightedKV_Replace(t *testing.T) {
+	kv, err := NewWeighted(10, byteLen, nil)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, kv.Set(ctx, "a", make([]byte, 4)))
+	require.NoError(t, kv.Set(ctx, "a", make([]byte, 6)))
+	assert.Equal(t, int64(6), kv.Weight())
+	assert.Equal(t, 1, kv.Len())
+}
+
+func TestWeightedKV_TooHeavy(t *testing.T) {
+	kv, err := NewWeighted(10, byteLen, nil)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, kv.Set(ctx, "a", make([]byte, 4)))
+	require.NoError(t, kv.Set(ctx, "b", make([]byte, 4)))
+
+	require.ErrorIs(t, kv.Set(ctx, "c", make([]byte, 11)), ErrEntryTooHeavy)
+	assert.Equal(t, int64(8), kv.Weight(), "rejected entry must not evict others")
+
+	// Rejecting an update drops the stale value.
+	require.ErrorIs(t, kv.Set(ctx, "a", make([]byte, 11)), ErrEntryTooHeavy)
+	_, err = kv.Get(ctx, "a")
+	require.ErrorIs(t, err, kvpkg.ErrNotFound)
+	assert.Equal(t, int64(4), kv.Weight())
+}
+
+func TestWeightedKV_Del(t *testing.T) {
+	kv, err := NewWeighted(10, byteLen, nil)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, kv.Set(ctx, "a", make([]byte, 4)))
+	require.NoError(t, kv.Del(ctx, "a"))
+	require.NoError(t, kv.Del(ctx, "missing"))
+	assert.Equal(t, int64(0), kv.Weight())
+
+	_, err = kv.Get(ctx, "a")
+	require.ErrorIs(t, err, kvpkg.ErrNotFound)
+}
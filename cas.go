@@ -0,0 +1,75 @@
+package kv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// ErrVersionMismatch is returned by CASKV when the version of a value is
+// not the expected one: the value changed since it was read.
+var ErrVersionMismatch = errors.New("version mismatch")
+
+// CASKV is a KV versioning its values, for optimistic concurrency: a
+// value read with its version is only replaced if it did not change since.
+//
+// The version of a value is never 0, and changes with every write of the
+// key, including after a delete.
+type CASKV[K comparable, V any] interface {
+	KV[K, V]
+
+	// GetVersion returns the value of k and its version.
+	GetVersion(ctx context.Context, k K) (V, uint64, error)
+	// CompareAndSet sets the value of k if its version is version, or if
+	// k is not found and version is 0. It returns ErrVersionMismatch
+	// otherwise.
+	CompareAndSet(ctx context.Context, k K, v V, version uint64) error
+	// SetIfAbsent sets the value of k if k is not found, and returns
+	// ErrVersionMismatch otherwise.
+	SetIfAbsent(ctx context.Context, k K, v V) error
+}
+
+// updateAttempts is the number of times Update tries to write a value.
+const updateAttempts = 10
+
+// Update sets the value of k to fn of its current value, the zero value
+// if k is not found, without losing concurrent updates: if the value
+// changed in between, it reads the value again and retries, a few times.
+// It returns the value set, or the error of fn, or ErrVersionMismatch if
+// all the attempts lost against concurrent writes.
+func Update[K comparable, V any](ctx context.Context, s CASKV[K, V], k K, fn func(old V) (V, error)) (V, error) {
+	var v V
+	for attempt := range updateAttempts {
+		if attempt > 0 {
+			// Back off randomly, so that the competing writers spread out.
+			t := time.NewTimer(rand.N(time.Millisecond << attempt))
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return v, ctx.Err()
+			case <-t.C:
+			}
+		}
+
+		old, version, err := s.GetVersion(ctx, k)
+		if errors.Is(err, ErrNotFound) {
+			var zero V
+			old, version = zero, 0
+		} else if err != nil {
+			return v, err
+		}
+
+		v, err = fn(old)
+		if err != nil {
+			return v, err
+		}
+
+		err = s.CompareAndSet(ctx, k, v, version)
+		if !errors.Is(err, ErrVersionMismatch) {
+			return v, err
+		}
+	}
+	return v, fmt.Errorf("update after %d attempts: %w", updateAttempts, ErrVersionMismatch)
+}
@@ -0,0 +1,25 @@
+package kv
+
+import (
+	"context"
+	"time"
+)
+
+// Counter is implemented by the stores that increment integer values
+// atomically, where a Get followed by a Set would lose concurrent updates.
+type Counter[K comparable] interface {
+	// Incr adds delta, which may be negative, to the counter k, created at
+	// 0 if not found, and returns its new value.
+	Incr(ctx context.Context, k K, delta int64) (int64, error)
+}
+
+// ExpiringCounter is a Counter whose counters may expire, for counts over
+// a window of time such as rate limits.
+type ExpiringCounter[K comparable] interface {
+	Counter[K]
+
+	// IncrWithTTL increments k like Incr. If k is created, it expires ttl
+	// after, otherwise its expiration is left as it is: the counter counts
+	// over the window started by its first increment.
+	IncrWithTTL(ctx context.Context, k K, delta int64, ttl time.Duration) (int64, error)
+}
@@ -0,0 +1,46 @@
+// Package counterkv implements kv.Counter on stores that do not count
+// natively, and aggregates increments before they reach a store.
+package counterkv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	kv "github.com/chenyanchen/kv"
+)
+
+type bytesCounter[K comparable] struct {
+	store kv.CASKV[K, []byte]
+}
+
+// NewBytes returns a kv.Counter on a store of bytes, keeping counters as
+// decimal strings, as Redis does. Increments are optimistic, with
+// kv.Update: they retry when a concurrent write got in between.
+func NewBytes[K comparable](store kv.CASKV[K, []byte]) (*bytesCounter[K], error) {
+	if store == nil {
+		return nil, errors.New("store is nil")
+	}
+	return &bytesCounter[K]{store: store}, nil
+}
+
+// Incr adds delta to the counter k, see kv.Counter.
+func (c *bytesCounter[K]) Incr(ctx context.Context, k K, delta int64) (int64, error) {
+	var n int64
+	_, err := kv.Update(ctx, c.store, k, func(old []byte) ([]byte, error) {
+		n = 0
+		if old != nil {
+			var err error
+			if n, err = strconv.ParseInt(string(old), 10, 64); err != nil {
+				return nil, fmt.Errorf("counter %v: %w", k, err)
+			}
+		}
+		n += delta
+		return strconv.AppendInt(nil, n, 10), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
@@ -0,0 +1,142 @@
+package counterkv
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	kv "github.com/chenyanchen/kv"
+	"github.com/chenyanchen/kv/cachekv"
+)
+
+func TestBytes(t *testing.T) {
+	ctx := context.Background()
+	store := cachekv.NewShardedCAS[string, []byte](4)
+	c, err := NewBytes[string](store)
+	require.NoError(t, err)
+
+	const writers, increments = 8, 50
+	var wg sync.WaitGroup
+	for range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range increments {
+				if _, err := c.Incr(ctx, "views", 1); !assert.NoError(t, err) {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	v, err := store.Get(ctx, "views")
+	require.NoError(t, err)
+	assert.Equal(t, "400", string(v))
+	n, err := c.Incr(ctx, "views", -401)
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), n)
+
+	require.NoError(t, store.Set(ctx, "name", []byte("a")))
+	_, err = c.Incr(ctx, "name", 1)
+	require.Error(t, err)
+
+	_, err = NewBytes[string](nil)
+	require.Error(t, err)
+}
+
+// countingCounter counts the increments reaching a counter, and fails
+// them while down.
+type countingCounter struct {
+	kv.Counter[string]
+	incrs atomic.Int32
+	down  atomic.Bool
+}
+
+var errDown = errors.New("store down")
+
+func (c *countingCounter) Incr(ctx context.Context, k string, delta int64) (int64, error) {
+	c.incrs.Add(1)
+	if c.down.Load() {
+		return 0, errDown
+	}
+	return c.Counter.Incr(ctx, k, delta)
+}
+
+func TestWriteBehind(t *testing.T) {
+	ctx := context.Background()
+	counters := cachekv.NewCounter[string](4)
+	store := &countingCounter{Counter: counters}
+	w, err := NewWriteBehind[string](store, WithFlushInterval(time.Hour))
+	require.NoError(t, err)
+
+	for range 101 {
+		require.NoError(t, w.Add(ctx, "views", 1))
+	}
+	require.NoError(t, w.Add(ctx, "zero", 0))
+	_, err = counters.Get(ctx, "views")
+	require.ErrorIs(t, err, kv.ErrNotFound, "not flushed yet")
+
+	require.NoError(t, w.Flush(ctx))
+	assert.Equal(t, int32(1), store.incrs.Load(), "a single increment per key")
+	v, err := counters.Get(ctx, "views")
+	require.NoError(t, err)
+	assert.Equal(t, int64(101), v)
+
+	// Failed increments are kept for the next flush.
+	require.NoError(t, w.Add(ctx, "views", 5))
+	store.down.Store(true)
+	require.ErrorIs(t, w.Flush(ctx), errDown)
+	require.NoError(t, w.Add(ctx, "views", 1))
+	store.down.Store(false)
+
+	require.NoError(t, w.Close())
+	v, err = counters.Get(ctx, "views")
+	require.NoError(t, err)
+	assert.Equal(t, int64(107), v, "flushed by Close")
+	require.ErrorIs(t, w.Add(ctx, "views", 1), ErrClosed)
+	require.NoError(t, w.Close())
+
+	_, err = NewWriteBehind[string](nil)
+	require.Error(t, err)
+}
+
+func TestWriteBehind_Background(t *testing.T) {
+	ctx := context.Background()
+	counters := cachekv.NewCounter[string](4)
+	store := &countingCounter{Counter: counters}
+
+	// Flushed every interval.
+	w, err := NewWriteBehind[string](store, WithFlushInterval(10*time.Millisecond))
+	require.NoError(t, err)
+	require.NoError(t, w.Add(ctx, "a", 1))
+	require.Eventually(t, func() bool {
+		v, err := counters.Get(ctx, "a")
+		return err == nil && v == 1
+	}, time.Second, time.Millisecond)
+	require.NoError(t, w.Close())
+
+	// Or once too many keys are pending, with the errors reported.
+	errs := make(chan error, 10)
+	store.down.Store(true)
+	w, err = NewWriteBehind[string](store,
+		WithFlushInterval(time.Hour),
+		WithMaxPending(2),
+		WithErrorHandler(func(err error) { errs <- err }))
+	require.NoError(t, err)
+	defer w.Close()
+	require.NoError(t, w.Add(ctx, "b", 1))
+	require.NoError(t, w.Add(ctx, "c", 1))
+	select {
+	case err := <-errs:
+		require.ErrorIs(t, err, errDown)
+	case <-time.After(time.Second):
+		t.Fatal("not flushed")
+	}
+}
@@ -0,0 +1,181 @@
+package counterkv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	kv "github.com/chenyanchen/kv"
+)
+
+// ErrClosed is returned by the increments of a closed aggregator.
+var ErrClosed = errors.New("counterkv: closed")
+
+const (
+	defaultFlushInterval = time.Second
+	defaultMaxPending    = 10000
+)
+
+// Option configures a write-behind aggregator.
+type Option func(*options)
+
+type options struct {
+	interval   time.Duration
+	maxPending int
+	onError    func(error)
+}
+
+// WithFlushInterval returns an Option that sets how often the pending
+// increments are flushed. Defaults to a second.
+func WithFlushInterval(d time.Duration) Option {
+	return func(o *options) {
+		if d > 0 {
+			o.interval = d
+		}
+	}
+}
+
+// WithMaxPending returns an Option that flushes as soon as n keys have
+// pending increments, without waiting for the interval, to bound memory.
+// Defaults to 10000.
+func WithMaxPending(n int) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.maxPending = n
+		}
+	}
+}
+
+// WithErrorHandler returns an Option that reports the errors of the
+// background flushes, which are otherwise dropped. The increments that
+// failed are kept pending, and retried by the next flush.
+func WithErrorHandler(onError func(error)) Option {
+	return func(o *options) {
+		o.onError = onError
+	}
+}
+
+type writeBehind[K comparable] struct {
+	store kv.Counter[K]
+	opts  options
+
+	mu      sync.Mutex
+	pending map[K]int64
+	closed  bool
+
+	// flushMu serializes the flushes.
+	flushMu sync.Mutex
+
+	full chan struct{}
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// NewWriteBehind returns an aggregator adding up the increments of each
+// key in memory, and flushing their sums to store in the background, so
+// that hot keys cost a single store increment per flush.
+//
+// The increments pending are lost if the process exits before Close. It is
+// not a kv.Counter: as the increments did not reach the store yet, Add
+// does not know the value of k, read it from the store.
+func NewWriteBehind[K comparable](store kv.Counter[K], opts ...Option) (*writeBehind[K], error) {
+	if store == nil {
+		return nil, errors.New("store is nil")
+	}
+
+	o := options{interval: defaultFlushInterval, maxPending: defaultMaxPending}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	w := &writeBehind[K]{
+		store:   store,
+		opts:    o,
+		pending: make(map[K]int64),
+		full:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go w.run()
+	return w, nil
+}
+
+// Add adds delta to the pending increments of k.
+func (w *writeBehind[K]) Add(ctx context.Context, k K, delta int64) error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return ErrClosed
+	}
+	w.pending[k] += delta
+	full := len(w.pending) >= w.opts.maxPending
+	w.mu.Unlock()
+
+	if full {
+		select {
+		case w.full <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+func (w *writeBehind[K]) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.opts.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		case <-w.full:
+		}
+		if err := w.Flush(context.Background()); err != nil && w.opts.onError != nil {
+			w.opts.onError(err)
+		}
+	}
+}
+
+// Flush writes the pending increments to the store now. The increments
+// that fail are kept pending, and their errors returned.
+func (w *writeBehind[K]) Flush(ctx context.Context) error {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	w.mu.Lock()
+	pending := w.pending
+	w.pending = make(map[K]int64, len(pending))
+	w.mu.Unlock()
+
+	var errs []error
+	for k, delta := range pending {
+		if delta == 0 {
+			continue
+		}
+		if _, err := w.store.Incr(ctx, k, delta); err != nil {
+			errs = append(errs, fmt.Errorf("counter %v: %w", k, err))
+			w.mu.Lock()
+			w.pending[k] += delta
+			w.mu.Unlock()
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close stops the background flushes, and flushes the increments pending.
+// Later increments fail with ErrClosed.
+func (w *writeBehind[K]) Close() error {
+	w.once.Do(func() {
+		w.mu.Lock()
+		w.closed = true
+		w.mu.Unlock()
+		close(w.stop)
+	})
+	<-w.done
+	return w.Flush(context.Background())
+}
@@ -0,0 +1,43 @@
+package failoverkv
+
+import (
+	"context"
+
+	kv "github.com/chenyanchen/kv"
+)
+
+type batchKV[K comparable, V any] struct {
+	*failover[kv.BatchKV[K, V]]
+}
+
+// NewBatch returns a BatchKV over backends, see New. A batch fails over
+// as a whole.
+func NewBatch[K comparable, V any](backends []kv.BatchKV[K, V], opts ...Option) (*batchKV[K, V], error) {
+	f, err := newFailover(backends, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &batchKV[K, V]{failover: f}, nil
+}
+
+// Get returns the values of the keys found; missing keys are left out of the result.
+func (f *batchKV[K, V]) Get(ctx context.Context, keys []K) (map[K]V, error) {
+	var values map[K]V
+	err := f.read(ctx, func(b kv.BatchKV[K, V]) error {
+		var err error
+		values, err = b.Get(ctx, keys)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func (f *batchKV[K, V]) Set(ctx context.Context, kvs map[K]V) error {
+	return f.write(ctx, func(b kv.BatchKV[K, V]) error { return b.Set(ctx, kvs) })
+}
+
+func (f *batchKV[K, V]) Del(ctx context.Context, keys []K) error {
+	return f.write(ctx, func(b kv.BatchKV[K, V]) error { return b.Del(ctx, keys) })
+}
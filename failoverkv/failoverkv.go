@@ -0,0 +1,281 @@
+// Package failoverkv reads from an ordered list of backends, such as a
+// primary store and its read replicas, moving to the next backend when
+// one fails.
+package failoverkv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	kv "github.com/chenyanchen/kv"
+)
+
+// BackendError is the error of one backend.
+type BackendError struct {
+	Backend int
+	Err     error
+}
+
+func (e *BackendError) Error() string {
+	return fmt.Sprintf("backend %d: %v", e.Backend, e.Err)
+}
+
+func (e *BackendError) Unwrap() error { return e.Err }
+
+// WritePolicy is where writes go.
+type WritePolicy int
+
+const (
+	// WritePrimary writes to the primary, the first backend, only. Writes
+	// do not fail over.
+	WritePrimary WritePolicy = iota
+	// WriteAll writes to all the backends, in order, and fails if any
+	// backend fails.
+	WriteAll
+)
+
+// Option configures a failover KV.
+type Option func(*options)
+
+type options struct {
+	retryable     func(error) bool
+	writePolicy   WritePolicy
+	probe         func(ctx context.Context, backend int) error
+	probeInterval time.Duration
+	onServed      func(ctx context.Context, backend int)
+}
+
+// WithRetryable returns an Option that sets which errors of a backend
+// move a read to the next backend; other errors are returned as they
+// are. kv.ErrNotFound never does: the key is not found, not the backend
+// failing. Defaults to all errors.
+func WithRetryable(retryable func(error) bool) Option {
+	return func(o *options) {
+		if retryable != nil {
+			o.retryable = retryable
+		}
+	}
+}
+
+// WithWritePolicy returns an Option that sets where writes go. Defaults
+// to WritePrimary.
+func WithWritePolicy(p WritePolicy) Option {
+	return func(o *options) {
+		o.writePolicy = p
+	}
+}
+
+// WithHealthCheck returns an Option that probes every backend every
+// interval. Backends failing their probe, or a read, are skipped until
+// their probe succeeds again; if all the backends are, none is skipped.
+// Without health checks, no backend is ever skipped.
+func WithHealthCheck(interval time.Duration, probe func(ctx context.Context, backend int) error) Option {
+	return func(o *options) {
+		if interval > 0 && probe != nil {
+			o.probe, o.probeInterval = probe, interval
+		}
+	}
+}
+
+// WithServedHandler returns an Option that calls fn with the context and
+// the index of the backend serving each request, or -1 if none did.
+// Writes to all the backends are served by the primary.
+func WithServedHandler(fn func(ctx context.Context, backend int)) Option {
+	return func(o *options) {
+		o.onServed = fn
+	}
+}
+
+// failover tries backends of type B in order.
+type failover[B any] struct {
+	backends []B
+	opts     options
+	down     []atomic.Bool
+
+	stop chan struct{}
+	once sync.Once
+	wg   sync.WaitGroup
+}
+
+func newFailover[B any](backends []B, opts []Option) (*failover[B], error) {
+	if len(backends) == 0 {
+		return nil, errors.New("no backends")
+	}
+	for i, b := range backends {
+		if any(b) == nil {
+			return nil, fmt.Errorf("backend %d is nil", i)
+		}
+	}
+
+	o := options{retryable: func(error) bool { return true }}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	f := &failover[B]{
+		backends: slices.Clone(backends),
+		opts:     o,
+		down:     make([]atomic.Bool, len(backends)),
+		stop:     make(chan struct{}),
+	}
+	if o.probe != nil {
+		f.wg.Add(1)
+		go f.probeLoop()
+	}
+	return f, nil
+}
+
+// read calls fn with the backends in order, skipping those down, until a
+// call does not fail with a retryable error.
+func (f *failover[B]) read(ctx context.Context, fn func(B) error) error {
+	order := f.order()
+	var errs []error
+	for _, i := range order {
+		err := fn(f.backends[i])
+		if err == nil || errors.Is(err, kv.ErrNotFound) {
+			f.served(ctx, i)
+			return err
+		}
+		if ctx.Err() != nil || !f.opts.retryable(err) {
+			f.served(ctx, -1)
+			return &BackendError{Backend: i, Err: err}
+		}
+
+		if f.opts.probe != nil {
+			f.down[i].Store(true)
+		}
+		errs = append(errs, &BackendError{Backend: i, Err: err})
+	}
+	f.served(ctx, -1)
+	return errors.Join(errs...)
+}
+
+func (f *failover[B]) served(ctx context.Context, backend int) {
+	if f.opts.onServed != nil {
+		f.opts.onServed(ctx, backend)
+	}
+}
+
+// order returns the indexes of the backends up, or of all the backends
+// if none is up.
+func (f *failover[B]) order() []int {
+	order := make([]int, 0, len(f.backends))
+	for i := range f.backends {
+		if !f.down[i].Load() {
+			order = append(order, i)
+		}
+	}
+	if len(order) == 0 {
+		for i := range f.backends {
+			order = append(order, i)
+		}
+	}
+	return order
+}
+
+// write calls fn with the backends of the write policy.
+func (f *failover[B]) write(ctx context.Context, fn func(B) error) error {
+	if f.opts.writePolicy == WritePrimary {
+		if err := fn(f.backends[0]); err != nil {
+			f.served(ctx, -1)
+			return &BackendError{Backend: 0, Err: err}
+		}
+		f.served(ctx, 0)
+		return nil
+	}
+
+	var errs []error
+	for i, b := range f.backends {
+		if err := fn(b); err != nil {
+			errs = append(errs, &BackendError{Backend: i, Err: err})
+		}
+	}
+	if len(errs) > 0 {
+		f.served(ctx, -1)
+		return errors.Join(errs...)
+	}
+	f.served(ctx, 0)
+	return nil
+}
+
+func (f *failover[B]) probeLoop() {
+	defer f.wg.Done()
+
+	ticker := time.NewTicker(f.opts.probeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-ticker.C:
+			f.probeAll()
+		}
+	}
+}
+
+// probeAll probes the backends in parallel, each for one interval at most.
+func (f *failover[B]) probeAll() {
+	ctx, cancel := context.WithTimeout(context.Background(), f.opts.probeInterval)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := range f.backends {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f.down[i].Store(f.opts.probe(ctx, i) != nil)
+		}()
+	}
+	wg.Wait()
+}
+
+// Healthy reports whether the backend at index i is not skipped.
+func (f *failover[B]) Healthy(i int) bool {
+	return !f.down[i].Load()
+}
+
+// Close stops the health checks.
+func (f *failover[B]) Close() error {
+	f.once.Do(func() { close(f.stop) })
+	f.wg.Wait()
+	return nil
+}
+
+type failoverKV[K comparable, V any] struct {
+	*failover[kv.KV[K, V]]
+}
+
+// New returns a KV reading from the first of backends that does not fail,
+// and writing with the write policy. The first backend is the primary.
+// Close stops its health checks, if any.
+func New[K comparable, V any](backends []kv.KV[K, V], opts ...Option) (*failoverKV[K, V], error) {
+	f, err := newFailover(backends, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &failoverKV[K, V]{failover: f}, nil
+}
+
+func (f *failoverKV[K, V]) Get(ctx context.Context, k K) (V, error) {
+	var v V
+	err := f.read(ctx, func(b kv.KV[K, V]) error {
+		var err error
+		v, err = b.Get(ctx, k)
+		return err
+	})
+	return v, err
+}
+
+func (f *failoverKV[K, V]) Set(ctx context.Context, k K, v V) error {
+	return f.write(ctx, func(b kv.KV[K, V]) error { return b.Set(ctx, k, v) })
+}
+
+func (f *failoverKV[K, V]) Del(ctx context.Context, k K) error {
+	return f.write(ctx, func(b kv.KV[K, V]) error { return b.Del(ctx, k) })
+}
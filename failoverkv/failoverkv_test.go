@@ -0,0 +1,248 @@
+package failoverkv
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	kv "github.com/chenyanchen/kv"
+	"github.com/chenyanchen/kv/cachekv"
+)
+
+var errDown = errors.New("backend down")
+
+// backend is a store that can be down, counting its gets.
+type backend struct {
+	kv.KV[string, int]
+	down atomic.Bool
+	gets atomic.Int32
+}
+
+func (b *backend) Get(ctx context.Context, k string) (int, error) {
+	b.gets.Add(1)
+	if b.down.Load() {
+		return 0, errDown
+	}
+	return b.KV.Get(ctx, k)
+}
+
+func (b *backend) Set(ctx context.Context, k string, v int) error {
+	if b.down.Load() {
+		return errDown
+	}
+	return b.KV.Set(ctx, k, v)
+}
+
+func (b *backend) Del(ctx context.Context, k string) error {
+	if b.down.Load() {
+		return errDown
+	}
+	return b.KV.Del(ctx, k)
+}
+
+func newBackends(n int) ([]*backend, []kv.KV[string, int]) {
+	backends := make([]*backend, n)
+	stores := make([]kv.KV[string, int], n)
+	for i := range n {
+		backends[i] = &backend{KV: cachekv.NewRWMutex[string, int]()}
+		stores[i] = backends[i]
+	}
+	return backends, stores
+}
+
+func TestFailoverKV(t *testing.T) {
+	ctx := context.Background()
+	backends, stores := newBackends(3)
+	served := -2
+	f, err := New(stores, WithServedHandler(func(_ context.Context, backend int) { served = backend }))
+	require.NoError(t, err)
+	defer f.Close()
+
+	for _, b := range backends {
+		require.NoError(t, b.KV.Set(ctx, "a", 1))
+	}
+
+	v, err := f.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, 1, v)
+	assert.Equal(t, 0, served)
+
+	backends[0].down.Store(true)
+	v, err = f.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, 1, v)
+	assert.Equal(t, 1, served, "the first replica serves")
+
+	// Not found does not fail over.
+	_, err = f.Get(ctx, "b")
+	require.ErrorIs(t, err, kv.ErrNotFound)
+	assert.Equal(t, 1, served)
+	require.NoError(t, backends[2].KV.Set(ctx, "b", 2))
+	_, err = f.Get(ctx, "b")
+	require.ErrorIs(t, err, kv.ErrNotFound)
+
+	// All down.
+	for _, b := range backends {
+		b.down.Store(true)
+	}
+	_, err = f.Get(ctx, "a")
+	require.ErrorIs(t, err, errDown)
+	assert.Equal(t, -1, served)
+	var backendErr *BackendError
+	require.ErrorAs(t, err, &backendErr)
+	assert.EqualError(t, err, "backend 0: backend down\nbackend 1: backend down\nbackend 2: backend down")
+
+	_, err = New[string, int](nil)
+	require.Error(t, err)
+	_, err = New([]kv.KV[string, int]{nil})
+	require.Error(t, err)
+}
+
+func TestFailoverKV_Retryable(t *testing.T) {
+	ctx := context.Background()
+	backends, stores := newBackends(2)
+	errBadRequest := errors.New("bad request")
+	f, err := New(stores, WithRetryable(func(err error) bool { return errors.Is(err, errDown) }))
+	require.NoError(t, err)
+	defer f.Close()
+
+	require.NoError(t, backends[1].KV.Set(ctx, "a", 1))
+	backends[0].KV = errKV{err: errBadRequest}
+
+	_, err = f.Get(ctx, "a")
+	require.ErrorIs(t, err, errBadRequest)
+	assert.Zero(t, backends[1].gets.Load(), "not failed over")
+
+	// The context of the caller is done: no failover either.
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	backends[0].KV = errKV{err: context.Canceled}
+	_, err = f.Get(cctx, "a")
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Zero(t, backends[1].gets.Load())
+}
+
+func TestFailoverKV_Writes(t *testing.T) {
+	ctx := context.Background()
+
+	backends, stores := newBackends(2)
+	f, err := New(stores)
+	require.NoError(t, err)
+	require.NoError(t, f.Set(ctx, "a", 1))
+	_, err = backends[1].KV.Get(ctx, "a")
+	require.ErrorIs(t, err, kv.ErrNotFound, "primary only")
+
+	backends[0].down.Store(true)
+	require.ErrorIs(t, f.Set(ctx, "a", 2), errDown, "writes do not fail over")
+
+	backends, stores = newBackends(2)
+	f, err = New(stores, WithWritePolicy(WriteAll))
+	require.NoError(t, err)
+	require.NoError(t, f.Set(ctx, "a", 1))
+	for _, b := range backends {
+		v, err := b.KV.Get(ctx, "a")
+		require.NoError(t, err)
+		assert.Equal(t, 1, v)
+	}
+
+	backends[1].down.Store(true)
+	err = f.Del(ctx, "a")
+	var backendErr *BackendError
+	require.ErrorAs(t, err, &backendErr)
+	assert.Equal(t, 1, backendErr.Backend)
+	_, err = backends[0].KV.Get(ctx, "a")
+	require.ErrorIs(t, err, kv.ErrNotFound, "the other backends are written")
+}
+
+func TestFailoverKV_HealthCheck(t *testing.T) {
+	ctx := context.Background()
+	backends, stores := newBackends(2)
+	for _, b := range backends {
+		require.NoError(t, b.KV.Set(ctx, "a", 1))
+	}
+
+	served := -2
+	f, err := New(stores, WithServedHandler(func(_ context.Context, backend int) { served = backend }),
+		WithHealthCheck(5*time.Millisecond, func(ctx context.Context, i int) error {
+			if backends[i].down.Load() {
+				return errDown
+			}
+			return nil
+		}))
+	require.NoError(t, err)
+	defer f.Close()
+
+	// A failed read marks the primary down, and it is skipped.
+	backends[0].down.Store(true)
+	_, err = f.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, 1, served)
+	assert.False(t, f.Healthy(0))
+
+	gets := backends[0].gets.Load()
+	_, err = f.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, gets, backends[0].gets.Load(), "the primary is skipped")
+
+	// The probe brings it back.
+	backends[0].down.Store(false)
+	require.Eventually(t, func() bool { return f.Healthy(0) }, time.Second, time.Millisecond)
+	_, err = f.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, 0, served)
+
+	// All down: all are tried still.
+	backends[0].down.Store(true)
+	backends[1].down.Store(true)
+	require.Eventually(t, func() bool { return !f.Healthy(0) && !f.Healthy(1) }, time.Second, time.Millisecond)
+	backends[1].down.Store(false)
+	_, err = f.Get(ctx, "a")
+	require.NoError(t, err)
+
+	require.NoError(t, f.Close())
+	require.NoError(t, f.Close())
+}
+
+func TestBatchKV(t *testing.T) {
+	ctx := context.Background()
+	replica := cachekv.NewRWMutex[string, int]()
+	require.NoError(t, replica.Set(ctx, "a", 1))
+
+	served := -2
+	f, err := NewBatch([]kv.BatchKV[string, int]{
+		downBatch{},
+		cachekv.NewBatch[string, int](replica, nil),
+	}, WithWritePolicy(WriteAll), WithServedHandler(func(_ context.Context, backend int) { served = backend }))
+	require.NoError(t, err)
+	defer f.Close()
+
+	got, err := f.Get(ctx, []string{"a", "b"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"a": 1}, got)
+	assert.Equal(t, 1, served)
+
+	err = f.Set(ctx, map[string]int{"b": 2})
+	require.ErrorIs(t, err, errDown)
+	v, err := replica.Get(ctx, "b")
+	require.NoError(t, err)
+	assert.Equal(t, 2, v, "the replica is written")
+
+	require.ErrorIs(t, f.Del(ctx, []string{"b"}), errDown)
+}
+
+type errKV struct{ err error }
+
+func (s errKV) Get(context.Context, string) (int, error) { return 0, s.err }
+func (s errKV) Set(context.Context, string, int) error   { return s.err }
+func (s errKV) Del(context.Context, string) error        { return s.err }
+
+type downBatch struct{}
+
+func (downBatch) Get(context.Context, []string) (map[string]int, error) { return nil, errDown }
+func (downBatch) Set(context.Context, map[string]int) error             { return errDown }
+func (downBatch) Del(context.Context, []string) error                   { return errDown }
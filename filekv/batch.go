@@ -0,0 +1,96 @@
+package filekv
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	kv "github.com/chenyanchen/kv"
+)
+
+// batchKV is the kv.BatchKV view of a fileKV. The files of a batch are
+// read, written and removed in parallel.
+type batchKV struct {
+	s *fileKV
+}
+
+// NewBatch returns a kv.BatchKV over the files of store.
+func NewBatch(store *fileKV) (*batchKV, error) {
+	if store == nil {
+		return nil, errors.New("store is nil")
+	}
+	return &batchKV{s: store}, nil
+}
+
+// Get returns the values of the keys found; missing keys are left out of the result.
+func (b *batchKV) Get(ctx context.Context, keys []string) (map[string][]byte, error) {
+	result := make(map[string][]byte, len(keys))
+	var mu sync.Mutex
+
+	err := b.parallel(ctx, keys, func(k string) error {
+		v, err := b.s.Get(ctx, k)
+		if errors.Is(err, kv.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		result[k] = v
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (b *batchKV) Set(ctx context.Context, kvs map[string][]byte) error {
+	keys := make([]string, 0, len(kvs))
+	for k := range kvs {
+		keys = append(keys, k)
+	}
+	return b.parallel(ctx, keys, func(k string) error {
+		return b.s.Set(ctx, k, kvs[k])
+	})
+}
+
+func (b *batchKV) Del(ctx context.Context, keys []string) error {
+	return b.parallel(ctx, keys, func(k string) error {
+		return b.s.Del(ctx, k)
+	})
+}
+
+// parallel calls fn for every key, with at most the configured number of
+// calls at a time. It stops starting new calls after the first error or
+// when ctx is done, and returns the first error.
+func (b *batchKV) parallel(ctx context.Context, keys []string, fn func(k string) error) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	sem := make(chan struct{}, b.s.opts.parallelism)
+	var wg sync.WaitGroup
+
+	for _, k := range keys {
+		sem <- struct{}{}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := fn(k); err != nil {
+				cancel(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return context.Cause(ctx)
+}
@@ -0,0 +1,279 @@
+// Package filekv implements a kv.KV that stores one file per key, for
+// values too large to keep in memory.
+package filekv
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	kv "github.com/chenyanchen/kv"
+)
+
+const (
+	tempPrefix = ".tmp-"
+
+	defaultParallelism = 16
+)
+
+// Option configures a fileKV.
+type Option func(*options)
+
+type options struct {
+	maxSize     int64
+	parallelism int
+}
+
+// WithMaxSize returns an Option that bounds the total size of the stored
+// values in bytes. When a write exceeds it, the least recently used files,
+// by modification time, are removed until the total is below 90% of maxSize.
+// Get refreshes the modification time of the file it reads.
+func WithMaxSize(maxSize int64) Option {
+	return func(o *options) {
+		o.maxSize = maxSize
+	}
+}
+
+// WithParallelism returns an Option that sets the number of files read,
+// written or removed at the same time by a batch operation. Defaults to 16.
+func WithParallelism(n int) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.parallelism = n
+		}
+	}
+}
+
+type fileKV struct {
+	dir  string
+	opts options
+
+	// mu serializes the updates of a file with the accounting of its size.
+	mu   sync.Mutex
+	size atomic.Int64
+
+	// evicting is set while the least recently used files are removed.
+	evicting atomic.Bool
+}
+
+// New returns a store of the files in dir, creating dir if needed.
+// Each key is stored in a file named by the SHA-256 of the key, under two
+// levels of fan-out subdirectories. Temporary files left behind by an
+// interrupted write are removed.
+func New(dir string, opts ...Option) (*fileKV, error) {
+	o := options{parallelism: defaultParallelism}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.maxSize < 0 {
+		return nil, errors.New("max size must not be negative")
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	s := &fileKV{dir: dir, opts: o}
+
+	files, err := s.files(true)
+	if err != nil {
+		return nil, err
+	}
+	var size int64
+	for _, f := range files {
+		size += f.size
+	}
+	s.size.Store(size)
+	return s, nil
+}
+
+// path returns the path of the file of k: dir/ab/cd/abcd....
+func (s *fileKV) path(k string) string {
+	sum := sha256.Sum256([]byte(k))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(s.dir, name[:2], name[2:4], name)
+}
+
+func (s *fileKV) Get(ctx context.Context, k string) ([]byte, error) {
+	path := s.path(k)
+	v, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, kv.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if s.opts.maxSize > 0 {
+		now := time.Now()
+		// The file may have been removed since it was read.
+		if err = os.Chtimes(path, now, now); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// Set writes v to a temporary file and renames it over the file of k, so
+// that readers see either the old or the new value, never a partial one.
+func (s *fileKV) Set(ctx context.Context, k string, v []byte) error {
+	if s.opts.maxSize > 0 && int64(len(v)) > s.opts.maxSize {
+		return errors.New("value exceeds max size")
+	}
+
+	path := s.path(k)
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := writeTemp(dir, v)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	old := fileSize(path)
+	err = os.Rename(tmp, path)
+	if err == nil {
+		s.size.Add(int64(len(v)) - old)
+	}
+	s.mu.Unlock()
+
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return s.evict()
+}
+
+func (s *fileKV) Del(ctx context.Context, k string) error {
+	return s.remove(s.path(k))
+}
+
+// Size returns the total size of the stored values in bytes.
+func (s *fileKV) Size() int64 {
+	return s.size.Load()
+}
+
+// remove removes the file at path, if any.
+func (s *fileKV) remove(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	size := fileSize(path)
+	if err := os.Remove(path); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	s.size.Add(-size)
+	return nil
+}
+
+// evict removes the least recently used files while the total size
+// exceeds the limit. Concurrent writers leave the work to the one running.
+func (s *fileKV) evict() error {
+	if s.opts.maxSize <= 0 || s.size.Load() <= s.opts.maxSize {
+		return nil
+	}
+	if !s.evicting.CompareAndSwap(false, true) {
+		return nil
+	}
+	defer s.evicting.Store(false)
+
+	files, err := s.files(false)
+	if err != nil {
+		return err
+	}
+	slices.SortFunc(files, func(a, b file) int { return a.modTime.Compare(b.modTime) })
+
+	target := s.opts.maxSize / 10 * 9
+	for _, f := range files {
+		if s.size.Load() <= target {
+			break
+		}
+		if err = s.remove(f.path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type file struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// files lists the stored files. Temporary files are skipped, or removed
+// if removeTemp is set, which is only safe when no write is in progress.
+func (s *fileKV) files(removeTemp bool) ([]file, error) {
+	var files []file
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		if strings.HasPrefix(d.Name(), tempPrefix) {
+			if removeTemp {
+				return os.Remove(path)
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		files = append(files, file{path: path, size: info.Size(), modTime: info.ModTime()})
+		return nil
+	})
+	return files, err
+}
+
+// writeTemp writes v to a new temporary file in dir and returns its path.
+func writeTemp(dir string, v []byte) (string, error) {
+	f, err := os.CreateTemp(dir, tempPrefix+"*")
+	if err != nil {
+		return "", err
+	}
+
+	_, err = f.Write(v)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// fileSize returns the size of the file at path, or 0 if there is none.
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
@@ -0,0 +1,184 @@
+package filekv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	kv "github.com/chenyanchen/kv"
+	"github.com/chenyanchen/kv/cachekv"
+	"github.com/chenyanchen/kv/layerkv"
+)
+
+func TestFileKV(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s, err := New(dir)
+	require.NoError(t, err)
+
+	_, err = s.Get(ctx, "a")
+	require.ErrorIs(t, err, kv.ErrNotFound)
+
+	require.NoError(t, s.Set(ctx, "a", []byte("hello")))
+	require.NoError(t, s.Set(ctx, "../b", []byte("key is not a path")))
+	require.NoError(t, s.Set(ctx, "a", []byte("hi")))
+
+	v, err := s.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("hi"), v)
+	assert.Equal(t, int64(len("hi")+len("key is not a path")), s.Size())
+
+	require.NoError(t, s.Del(ctx, "a"))
+	require.NoError(t, s.Del(ctx, "a"), "deleting a missing key is not an error")
+	_, err = s.Get(ctx, "a")
+	require.ErrorIs(t, err, kv.ErrNotFound)
+	assert.Equal(t, int64(len("key is not a path")), s.Size())
+
+	// Files are fanned out, and no temporary file is left behind.
+	var files []string
+	require.NoError(t, filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			rel, _ := filepath.Rel(dir, path)
+			files = append(files, rel)
+		}
+		return err
+	}))
+	require.Len(t, files, 1)
+	parts := strings.Split(files[0], string(filepath.Separator))
+	require.Len(t, parts, 3)
+	assert.True(t, strings.HasPrefix(parts[2], parts[0]+parts[1]))
+}
+
+func TestFileKV_Reopen(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s, err := New(dir)
+	require.NoError(t, err)
+	require.NoError(t, s.Set(ctx, "a", []byte("12345")))
+
+	// A temporary file of an interrupted write.
+	tmp := filepath.Join(filepath.Dir(s.path("a")), tempPrefix+"1")
+	require.NoError(t, os.WriteFile(tmp, []byte("partial"), 0o644))
+
+	s, err = New(dir)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), s.Size())
+	assert.NoFileExists(t, tmp)
+
+	v, err := s.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("12345"), v)
+}
+
+func TestFileKV_MaxSize(t *testing.T) {
+	ctx := context.Background()
+
+	s, err := New(t.TempDir(), WithMaxSize(100))
+	require.NoError(t, err)
+
+	value := make([]byte, 30)
+	for i, k := range []string{"a", "b", "c"} {
+		require.NoError(t, s.Set(ctx, k, value))
+		// Make the access order explicit, whatever the timestamp resolution.
+		at := time.Now().Add(time.Duration(i-10) * time.Minute)
+		require.NoError(t, os.Chtimes(s.path(k), at, at))
+	}
+
+	// Reading "a" makes "b" the least recently used.
+	_, err = s.Get(ctx, "a")
+	require.NoError(t, err)
+
+	require.NoError(t, s.Set(ctx, "d", value))
+	assert.LessOrEqual(t, s.Size(), int64(90))
+
+	_, err = s.Get(ctx, "b")
+	require.ErrorIs(t, err, kv.ErrNotFound)
+	for _, k := range []string{"a", "c", "d"} {
+		_, err = s.Get(ctx, k)
+		require.NoError(t, err, k)
+	}
+
+	require.Error(t, s.Set(ctx, "e", make([]byte, 101)))
+}
+
+func TestBatchKV(t *testing.T) {
+	ctx := context.Background()
+
+	s, err := New(t.TempDir(), WithParallelism(4))
+	require.NoError(t, err)
+	b, err := NewBatch(s)
+	require.NoError(t, err)
+
+	kvs := make(map[string][]byte)
+	keys := make([]string, 0, 50)
+	for i := range 50 {
+		k := fmt.Sprint("key", i)
+		kvs[k] = []byte(fmt.Sprint("value", i))
+		keys = append(keys, k)
+	}
+	require.NoError(t, b.Set(ctx, kvs))
+
+	got, err := b.Get(ctx, append(keys, "missing"))
+	require.NoError(t, err)
+	assert.Equal(t, kvs, got)
+
+	require.NoError(t, b.Del(ctx, keys[:25]))
+	got, err = b.Get(ctx, keys)
+	require.NoError(t, err)
+	assert.Len(t, got, 25)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = b.Get(canceled, keys)
+	require.ErrorIs(t, err, context.Canceled)
+
+	_, err = NewBatch(nil)
+	require.Error(t, err)
+}
+
+func TestBatchKV_Error(t *testing.T) {
+	ctx := context.Background()
+
+	s, err := New(t.TempDir())
+	require.NoError(t, err)
+	b, err := NewBatch(s)
+	require.NoError(t, err)
+
+	// A directory where the file of the key should be.
+	require.NoError(t, os.MkdirAll(s.path("dir"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(s.path("dir"), "f"), nil, 0o644))
+
+	_, err = b.Get(ctx, []string{"a", "dir"})
+	require.Error(t, err)
+	assert.False(t, errors.Is(err, kv.ErrNotFound))
+}
+
+func TestFileKV_Layer(t *testing.T) {
+	ctx := context.Background()
+
+	s, err := New(t.TempDir())
+	require.NoError(t, err)
+	cache, err := cachekv.NewLRU[string, []byte](10, nil, 0)
+	require.NoError(t, err)
+	l, err := layerkv.New(cache, s)
+	require.NoError(t, err)
+
+	require.NoError(t, l.Set(ctx, "a", []byte("blob")))
+	v, err := l.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("blob"), v)
+
+	v, err = cache.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("blob"), v)
+}
@@ -0,0 +1,238 @@
+package httpkv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	kv "github.com/chenyanchen/kv"
+)
+
+// maxErrorBody bounds the part of an error response kept in a StatusError.
+const maxErrorBody = 1 << 10
+
+// StatusError is returned by the clients for an unexpected response status.
+type StatusError struct {
+	Code    int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("httpkv: %d %s", e.Code, e.Message)
+}
+
+// WithHTTPClient returns an Option that sets the http.Client of a client.
+// Defaults to a client that keeps up to 64 idle connections to the server.
+func WithHTTPClient[K comparable, V any](c *http.Client) Option[K, V] {
+	return func(o *options[K, V]) {
+		if c != nil {
+			o.httpClient = c
+		}
+	}
+}
+
+// newHTTPClient returns the default http.Client of the clients.
+func newHTTPClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = 64
+	transport.MaxIdleConnsPerHost = 64
+	transport.IdleConnTimeout = 90 * time.Second
+	return &http.Client{Transport: transport}
+}
+
+// remote holds what the KV and the BatchKV clients share.
+type remote[K comparable, V any] struct {
+	base string
+	opts options[K, V]
+}
+
+func newRemote[K comparable, V any](baseURL string, opts []Option[K, V]) (remote[K, V], error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return remote[K, V]{}, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return remote[K, V]{}, fmt.Errorf("unsupported URL scheme %q", u.Scheme)
+	}
+
+	o := options[K, V]{
+		parseKey:  parseKey[K],
+		formatKey: formatKey[K],
+		codec:     JSONCodec{},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.httpClient == nil {
+		o.httpClient = newHTTPClient()
+	}
+
+	return remote[K, V]{base: strings.TrimSuffix(u.String(), "/"), opts: o}, nil
+}
+
+// do sends a request and returns the response body if the status is want.
+// The body of every response is read to the end, so that the connection
+// can be reused.
+func (r remote[K, V]) do(ctx context.Context, method, path, contentType string, body []byte, want int) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, r.base+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := r.opts.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case want:
+		return data, nil
+	case http.StatusNotFound:
+		return nil, kv.ErrNotFound
+	case http.StatusPreconditionFailed:
+		return nil, ErrVersionMismatch
+	default:
+		msg := strings.TrimSpace(string(data[:min(len(data), maxErrorBody)]))
+		return nil, &StatusError{Code: resp.StatusCode, Message: msg}
+	}
+}
+
+func (r remote[K, V]) keyPath(k K) string {
+	return "/" + url.PathEscape(r.opts.formatKey(k))
+}
+
+type client[K comparable, V any] struct {
+	remote[K, V]
+}
+
+// NewClient returns a kv.KV on the server at baseURL, which speaks the
+// wire protocol of the package, such as a NewHandler. The keys and codec
+// options must match those of the server.
+func NewClient[K comparable, V any](baseURL string, opts ...Option[K, V]) (*client[K, V], error) {
+	r, err := newRemote(baseURL, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &client[K, V]{remote: r}, nil
+}
+
+func (c *client[K, V]) Get(ctx context.Context, k K) (V, error) {
+	var v V
+	body, err := c.do(ctx, http.MethodGet, c.keyPath(k), "", nil, http.StatusOK)
+	if err != nil {
+		return v, err
+	}
+	err = c.opts.codec.Unmarshal(body, &v)
+	return v, err
+}
+
+func (c *client[K, V]) Set(ctx context.Context, k K, v V) error {
+	body, err := c.opts.codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = c.do(ctx, http.MethodPut, c.keyPath(k), c.opts.codec.ContentType(), body, http.StatusNoContent)
+	return err
+}
+
+func (c *client[K, V]) Del(ctx context.Context, k K) error {
+	_, err := c.do(ctx, http.MethodDelete, c.keyPath(k), "", nil, http.StatusNoContent)
+	return err
+}
+
+type batchClient[K comparable, V any] struct {
+	remote[K, V]
+}
+
+// NewBatchClient returns a kv.BatchKV on the server at baseURL, see NewClient.
+func NewBatchClient[K comparable, V any](baseURL string, opts ...Option[K, V]) (*batchClient[K, V], error) {
+	r, err := newRemote(baseURL, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &batchClient[K, V]{remote: r}, nil
+}
+
+// Get returns the values of the keys found; missing keys are left out of the result.
+func (c *batchClient[K, V]) Get(ctx context.Context, keys []K) (map[K]V, error) {
+	if len(keys) == 0 {
+		return map[K]V{}, nil
+	}
+
+	body, err := c.post(ctx, "/_batch/get", keysBody{Keys: c.formatKeys(keys)}, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp valuesBody[V]
+	if err = json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	result := make(map[K]V, len(resp.Values))
+	for s, v := range resp.Values {
+		k, err := c.opts.parseKey(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q: %w", s, err)
+		}
+		result[k] = v
+	}
+	return result, nil
+}
+
+func (c *batchClient[K, V]) Set(ctx context.Context, kvs map[K]V) error {
+	if len(kvs) == 0 {
+		return nil
+	}
+
+	req := valuesBody[V]{Values: make(map[string]V, len(kvs))}
+	for k, v := range kvs {
+		req.Values[c.opts.formatKey(k)] = v
+	}
+	_, err := c.post(ctx, "/_batch/set", req, http.StatusNoContent)
+	return err
+}
+
+func (c *batchClient[K, V]) Del(ctx context.Context, keys []K) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	_, err := c.post(ctx, "/_batch/delete", keysBody{Keys: c.formatKeys(keys)}, http.StatusNoContent)
+	return err
+}
+
+func (c *batchClient[K, V]) post(ctx context.Context, path string, req any, want int) ([]byte, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	data, err := c.do(ctx, http.MethodPost, path, "application/json", body, want)
+	if errors.Is(err, kv.ErrNotFound) {
+		// A batch request is never not found: the server does not serve batches.
+		return nil, &StatusError{Code: http.StatusNotFound, Message: "batch endpoint not found"}
+	}
+	return data, err
+}
+
+func (c *batchClient[K, V]) formatKeys(keys []K) []string {
+	ss := make([]string, len(keys))
+	for i, k := range keys {
+		ss[i] = c.opts.formatKey(k)
+	}
+	return ss
+}
@@ -0,0 +1,188 @@
+package httpkv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	kv "github.com/chenyanchen/kv"
+	"github.com/chenyanchen/kv/cachekv"
+	"github.com/chenyanchen/kv/layerkv"
+)
+
+type user struct {
+	Name string `json:"name"`
+}
+
+// newServer serves store under /users, and counts the connections.
+func newServer(t *testing.T, store kv.KV[int, user], opts ...Option[int, user]) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	h, err := NewHandler(store, opts...)
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+	mux.Handle("/users/", http.StripPrefix("/users", h))
+
+	var conns atomic.Int32
+	srv := httptest.NewUnstartedServer(mux)
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return srv, &conns
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	srv, conns := newServer(t, cachekv.NewRWMutex[int, user]())
+
+	c, err := NewClient[int, user](srv.URL + "/users/")
+	require.NoError(t, err)
+
+	_, err = c.Get(ctx, 1)
+	require.ErrorIs(t, err, kv.ErrNotFound)
+
+	for i := range 10 {
+		require.NoError(t, c.Set(ctx, i, user{Name: fmt.Sprint("user", i)}))
+	}
+	v, err := c.Get(ctx, 3)
+	require.NoError(t, err)
+	assert.Equal(t, user{Name: "user3"}, v)
+
+	require.NoError(t, c.Del(ctx, 3))
+	_, err = c.Get(ctx, 3)
+	require.ErrorIs(t, err, kv.ErrNotFound)
+
+	assert.Equal(t, int32(1), conns.Load(), "connections are kept alive")
+
+	for _, baseURL := range []string{"ftp://host", "://"} {
+		_, err = NewClient[int, user](baseURL)
+		require.Error(t, err, baseURL)
+	}
+}
+
+func TestClient_StringKeys(t *testing.T) {
+	ctx := context.Background()
+	store := cachekv.NewRWMutex[string, []byte]()
+	h, err := NewHandler[string, []byte](store, WithCodec[string, []byte](BytesCodec{}))
+	require.NoError(t, err)
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	c, err := NewClient[string, []byte](srv.URL, WithCodec[string, []byte](BytesCodec{}))
+	require.NoError(t, err)
+
+	// Keys are escaped into the path.
+	for _, k := range []string{"a/b", "with space", "?query#frag", "%41"} {
+		require.NoError(t, c.Set(ctx, k, []byte(k)))
+		v, err := store.Get(ctx, k)
+		require.NoError(t, err, k)
+		assert.Equal(t, []byte(k), v)
+
+		v, err = c.Get(ctx, k)
+		require.NoError(t, err, k)
+		assert.Equal(t, []byte(k), v)
+	}
+}
+
+func TestClient_Errors(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := newServer(t, errKVOf[int, user]{err: errors.New("boom")})
+
+	c, err := NewClient[int, user](srv.URL + "/users")
+	require.NoError(t, err)
+
+	var statusErr *StatusError
+	_, err = c.Get(ctx, 1)
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusInternalServerError, statusErr.Code)
+
+	// The context of the call reaches the request.
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	t.Cleanup(slow.Close)
+
+	c, err = NewClient[int, user](slow.URL)
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	_, err = c.Get(ctx, 1)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestBatchClient(t *testing.T) {
+	ctx := context.Background()
+	srv, conns := newServer(t, cachekv.NewRWMutex[int, user]())
+
+	b, err := NewBatchClient[int, user](srv.URL + "/users")
+	require.NoError(t, err)
+
+	kvs := map[int]user{1: {Name: "a"}, 2: {Name: "b"}, 3: {Name: "c"}}
+	require.NoError(t, b.Set(ctx, kvs))
+	require.NoError(t, b.Del(ctx, []int{3}))
+
+	got, err := b.Get(ctx, []int{1, 2, 3})
+	require.NoError(t, err)
+	assert.Equal(t, map[int]user{1: {Name: "a"}, 2: {Name: "b"}}, got)
+	assert.Equal(t, int32(1), conns.Load())
+
+	got, err = b.Get(ctx, nil)
+	require.NoError(t, err)
+	assert.Empty(t, got)
+
+	// A server without the batch endpoints.
+	other := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(other.Close)
+	b, err = NewBatchClient[int, user](other.URL)
+	require.NoError(t, err)
+	_, err = b.Get(ctx, []int{1})
+	require.Error(t, err)
+	require.NotErrorIs(t, err, kv.ErrNotFound)
+}
+
+func TestClient_Layer(t *testing.T) {
+	ctx := context.Background()
+	shared := cachekv.NewRWMutex[int, user]()
+	srv, _ := newServer(t, shared)
+
+	remote, err := NewClient[int, user](srv.URL + "/users")
+	require.NoError(t, err)
+	local, err := cachekv.NewLRU[int, user](10, nil, 0)
+	require.NoError(t, err)
+	l, err := layerkv.New[int, user](local, remote)
+	require.NoError(t, err)
+
+	require.NoError(t, shared.Set(ctx, 1, user{Name: "shared"}))
+	v, err := l.Get(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, user{Name: "shared"}, v)
+
+	v, err = local.Get(ctx, 1)
+	require.NoError(t, err, "the remote value is cached locally")
+	assert.Equal(t, user{Name: "shared"}, v)
+}
+
+type errKVOf[K comparable, V any] struct{ err error }
+
+func (s errKVOf[K, V]) Get(context.Context, K) (V, error) {
+	var v V
+	return v, s.err
+}
+func (s errKVOf[K, V]) Set(context.Context, K, V) error { return s.err }
+func (s errKVOf[K, V]) Del(context.Context, K) error    { return s.err }
@@ -0,0 +1,88 @@
+package httpkv
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Codec encodes the values of single-key requests and responses.
+type Codec interface {
+	ContentType() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// JSONCodec encodes values with encoding/json.
+type JSONCodec struct{}
+
+func (JSONCodec) ContentType() string { return "application/json" }
+
+func (JSONCodec) Marshal(v any) ([]byte, error) { return json.Marshal(v) }
+
+func (JSONCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+// BytesCodec sends []byte values as they are, for stores of raw bytes.
+type BytesCodec struct{}
+
+func (BytesCodec) ContentType() string { return "application/octet-stream" }
+
+func (BytesCodec) Marshal(v any) ([]byte, error) {
+	switch v := v.(type) {
+	case []byte:
+		return v, nil
+	case *[]byte:
+		return *v, nil
+	default:
+		return nil, fmt.Errorf("BytesCodec cannot marshal %T", v)
+	}
+}
+
+func (BytesCodec) Unmarshal(data []byte, v any) error {
+	p, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("BytesCodec cannot unmarshal into %T", v)
+	}
+	*p = append((*p)[:0], data...)
+	return nil
+}
+
+// parseKey is the default key parser, for string and integer keys.
+func parseKey[K comparable](s string) (K, error) {
+	var k K
+	var err error
+	switch p := any(&k).(type) {
+	case *string:
+		*p = s
+	case *int:
+		*p, err = strconv.Atoi(s)
+	case *int64:
+		*p, err = strconv.ParseInt(s, 10, 64)
+	case *uint64:
+		*p, err = strconv.ParseUint(s, 10, 64)
+	default:
+		err = errors.New("unsupported key type, see WithKeys")
+	}
+	return k, err
+}
+
+// KeyFormatter returns how opts format keys on the wire, for the callers
+// needing the same strings as the clients and handlers given opts.
+func KeyFormatter[K comparable, V any](opts ...Option[K, V]) func(K) string {
+	o := options[K, V]{formatKey: formatKey[K]}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o.formatKey
+}
+
+// formatKey is the default key formatter, the inverse of parseKey.
+func formatKey[K comparable](k K) string {
+	switch k := any(k).(type) {
+	case string:
+		return k
+	default:
+		return fmt.Sprint(k)
+	}
+}
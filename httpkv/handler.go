@@ -0,0 +1,456 @@
+// Package httpkv serves a kv.KV over HTTP, and implements kv.KV and
+// kv.BatchKV on such a server.
+//
+// # Wire protocol
+//
+// Keys are the path of the request, escaped as a path: a key with a "/"
+// is sent as "%2F". Single-key requests carry the value encoded by the
+// Codec, JSON by default, in the body:
+//
+//	GET    /{key}  200 with the value, 404 if the key is not found
+//	PUT    /{key}  204, the value is the request body
+//	DELETE /{key}  204, also if the key is not found
+//
+// Batch requests are POSTed with JSON bodies, whatever the Codec, keys
+// being formatted as for the path:
+//
+//	POST /_batch/get     {"keys": ["a", "b"]}           200 {"values": {"a": 1}}
+//	POST /_batch/set     {"values": {"a": 1, "b": 2}}   204
+//	POST /_batch/delete  {"keys": ["a", "b"]}           204
+//
+// The values of the keys not found are left out of a batch get.
+//
+// GET responses carry an ETag, and a GET with a matching If-None-Match
+// gets 304. If the store implements Versioner, the ETag is the version of
+// the value, and a PUT with If-Match only succeeds if the value still has
+// that version, 412 otherwise. Other errors are 400 for invalid requests,
+// and 500 for errors of the store.
+package httpkv
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	kv "github.com/chenyanchen/kv"
+)
+
+const defaultMaxBodySize = 32 << 20
+
+// ErrVersionMismatch is returned by Versioner.CompareAndSet when the value
+// was modified since the version was read. It is kv.ErrVersionMismatch.
+var ErrVersionMismatch = kv.ErrVersionMismatch
+
+// Versioner is implemented by the stores that version their values, and
+// enables conditional writes. Every kv.CASKV is a Versioner.
+type Versioner[K comparable, V any] interface {
+	// GetVersion returns the value of k and its version.
+	GetVersion(ctx context.Context, k K) (V, uint64, error)
+
+	// CompareAndSet sets the value of k if its version is still version,
+	// and returns ErrVersionMismatch otherwise.
+	CompareAndSet(ctx context.Context, k K, v V, version uint64) error
+}
+
+// Option configures a handler or a client.
+type Option[K comparable, V any] func(*options[K, V])
+
+type options[K comparable, V any] struct {
+	parseKey    func(string) (K, error)
+	formatKey   func(K) string
+	codec       Codec
+	batch       kv.BatchKV[K, V]
+	maxBodySize int64
+	onError     func(*http.Request, error)
+	httpClient  *http.Client
+}
+
+// WithKeys returns an Option that sets how keys are parsed from and
+// formatted to strings. String and integer keys are supported by default.
+func WithKeys[K comparable, V any](parse func(string) (K, error), format func(K) string) Option[K, V] {
+	return func(o *options[K, V]) {
+		if parse != nil && format != nil {
+			o.parseKey, o.formatKey = parse, format
+		}
+	}
+}
+
+// WithCodec returns an Option that sets the codec of single-key values.
+// Defaults to JSONCodec.
+func WithCodec[K comparable, V any](codec Codec) Option[K, V] {
+	return func(o *options[K, V]) {
+		if codec != nil {
+			o.codec = codec
+		}
+	}
+}
+
+// WithBatch returns an Option that serves the batch requests with b.
+// Without it, they are served key by key by the store.
+func WithBatch[K comparable, V any](b kv.BatchKV[K, V]) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.batch = b
+	}
+}
+
+// WithMaxBodySize returns an Option that bounds the size of request bodies.
+// Defaults to 32 MiB.
+func WithMaxBodySize[K comparable, V any](n int64) Option[K, V] {
+	return func(o *options[K, V]) {
+		if n > 0 {
+			o.maxBodySize = n
+		}
+	}
+}
+
+// WithErrorHandler returns an Option that reports the errors of the store
+// answered with a 500, which otherwise do not reach the response.
+func WithErrorHandler[K comparable, V any](fn func(*http.Request, error)) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.onError = fn
+	}
+}
+
+type handler[K comparable, V any] struct {
+	store kv.KV[K, V]
+	opts  options[K, V]
+	mux   *http.ServeMux
+}
+
+// NewHandler returns an http.Handler serving store with the wire protocol
+// of the package. It serves the root path: use http.StripPrefix to mount it
+// elsewhere.
+func NewHandler[K comparable, V any](store kv.KV[K, V], opts ...Option[K, V]) (*handler[K, V], error) {
+	if store == nil {
+		return nil, errors.New("store is nil")
+	}
+
+	o := options[K, V]{
+		parseKey:    parseKey[K],
+		formatKey:   formatKey[K],
+		codec:       JSONCodec{},
+		maxBodySize: defaultMaxBodySize,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	h := &handler[K, V]{store: store, opts: o, mux: http.NewServeMux()}
+	h.mux.HandleFunc("GET /{key...}", h.get)
+	h.mux.HandleFunc("PUT /{key...}", h.set)
+	h.mux.HandleFunc("DELETE /{key...}", h.del)
+	h.mux.HandleFunc("POST /_batch/get", h.batchGet)
+	h.mux.HandleFunc("POST /_batch/set", h.batchSet)
+	h.mux.HandleFunc("POST /_batch/delete", h.batchDel)
+	return h, nil
+}
+
+func (h *handler[K, V]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// badRequest is an error of the client.
+type badRequest struct{ err error }
+
+func (e badRequest) Error() string { return e.err.Error() }
+
+func (e badRequest) Unwrap() error { return e.err }
+
+func (h *handler[K, V]) key(r *http.Request) (K, error) {
+	s := r.PathValue("key")
+	if s == "" {
+		var zero K
+		return zero, badRequest{errors.New("empty key")}
+	}
+	k, err := h.opts.parseKey(s)
+	if err != nil {
+		return k, badRequest{fmt.Errorf("invalid key %q: %w", s, err)}
+	}
+	return k, nil
+}
+
+func (h *handler[K, V]) get(w http.ResponseWriter, r *http.Request) {
+	k, err := h.key(r)
+	if err != nil {
+		h.fail(w, r, err)
+		return
+	}
+
+	var (
+		v    V
+		etag string
+	)
+	if versioner, ok := h.store.(Versioner[K, V]); ok {
+		var version uint64
+		v, version, err = versioner.GetVersion(r.Context(), k)
+		etag = strconv.Quote(strconv.FormatUint(version, 10))
+	} else {
+		v, err = h.store.Get(r.Context(), k)
+	}
+	if err != nil {
+		h.fail(w, r, err)
+		return
+	}
+
+	body, err := h.opts.codec.Marshal(v)
+	if err != nil {
+		h.fail(w, r, err)
+		return
+	}
+	if etag == "" {
+		sum := sha256.Sum256(body)
+		etag = strconv.Quote(hex.EncodeToString(sum[:16]))
+	}
+
+	w.Header().Set("ETag", etag)
+	if matchETag(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", h.opts.codec.ContentType())
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	_, _ = w.Write(body)
+}
+
+func (h *handler[K, V]) set(w http.ResponseWriter, r *http.Request) {
+	k, err := h.key(r)
+	if err != nil {
+		h.fail(w, r, err)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.opts.maxBodySize))
+	if err != nil {
+		h.fail(w, r, err)
+		return
+	}
+	var v V
+	if err = h.opts.codec.Unmarshal(body, &v); err != nil {
+		h.fail(w, r, badRequest{err})
+		return
+	}
+
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		err = h.compareAndSet(r.Context(), k, v, ifMatch)
+	} else {
+		err = h.store.Set(r.Context(), k, v)
+	}
+	if err != nil {
+		h.fail(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// compareAndSet sets v if the version of k matches the ETag in ifMatch.
+func (h *handler[K, V]) compareAndSet(ctx context.Context, k K, v V, ifMatch string) error {
+	versioner, ok := h.store.(Versioner[K, V])
+	if !ok {
+		return badRequest{errors.New("If-Match needs a versioned store")}
+	}
+
+	version, err := strconv.ParseUint(strings.Trim(ifMatch, `"`), 10, 64)
+	if err != nil {
+		// No version matches an ETag that is not one.
+		return ErrVersionMismatch
+	}
+	return versioner.CompareAndSet(ctx, k, v, version)
+}
+
+func (h *handler[K, V]) del(w http.ResponseWriter, r *http.Request) {
+	k, err := h.key(r)
+	if err != nil {
+		h.fail(w, r, err)
+		return
+	}
+	if err = h.store.Del(r.Context(), k); err != nil {
+		h.fail(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type keysBody struct {
+	Keys []string `json:"keys"`
+}
+
+type valuesBody[V any] struct {
+	Values map[string]V `json:"values"`
+}
+
+func (h *handler[K, V]) batchGet(w http.ResponseWriter, r *http.Request) {
+	var req keysBody
+	if err := h.decode(w, r, &req); err != nil {
+		h.fail(w, r, err)
+		return
+	}
+	keys, err := h.parseKeys(req.Keys)
+	if err != nil {
+		h.fail(w, r, err)
+		return
+	}
+
+	var values map[K]V
+	if h.opts.batch != nil {
+		values, err = h.opts.batch.Get(r.Context(), keys)
+	} else {
+		values, err = h.getEach(r.Context(), keys)
+	}
+	if err != nil {
+		h.fail(w, r, err)
+		return
+	}
+
+	resp := valuesBody[V]{Values: make(map[string]V, len(values))}
+	for k, v := range values {
+		resp.Values[h.opts.formatKey(k)] = v
+	}
+	body, err := json.Marshal(resp)
+	if err != nil {
+		h.fail(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(body)
+}
+
+func (h *handler[K, V]) getEach(ctx context.Context, keys []K) (map[K]V, error) {
+	values := make(map[K]V, len(keys))
+	for _, k := range keys {
+		v, err := h.store.Get(ctx, k)
+		if errors.Is(err, kv.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		values[k] = v
+	}
+	return values, nil
+}
+
+func (h *handler[K, V]) batchSet(w http.ResponseWriter, r *http.Request) {
+	var req valuesBody[V]
+	if err := h.decode(w, r, &req); err != nil {
+		h.fail(w, r, err)
+		return
+	}
+
+	kvs := make(map[K]V, len(req.Values))
+	for s, v := range req.Values {
+		k, err := h.opts.parseKey(s)
+		if err != nil {
+			h.fail(w, r, badRequest{fmt.Errorf("invalid key %q: %w", s, err)})
+			return
+		}
+		kvs[k] = v
+	}
+
+	var err error
+	if h.opts.batch != nil {
+		err = h.opts.batch.Set(r.Context(), kvs)
+	} else {
+		for k, v := range kvs {
+			if err = h.store.Set(r.Context(), k, v); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		h.fail(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler[K, V]) batchDel(w http.ResponseWriter, r *http.Request) {
+	var req keysBody
+	if err := h.decode(w, r, &req); err != nil {
+		h.fail(w, r, err)
+		return
+	}
+	keys, err := h.parseKeys(req.Keys)
+	if err != nil {
+		h.fail(w, r, err)
+		return
+	}
+
+	if h.opts.batch != nil {
+		err = h.opts.batch.Del(r.Context(), keys)
+	} else {
+		for _, k := range keys {
+			if err = h.store.Del(r.Context(), k); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		h.fail(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decode decodes the JSON body of r into v.
+func (h *handler[K, V]) decode(w http.ResponseWriter, r *http.Request, v any) error {
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, h.opts.maxBodySize)).Decode(v)
+	var maxBytesErr *http.MaxBytesError
+	if err != nil && !errors.As(err, &maxBytesErr) {
+		return badRequest{err}
+	}
+	return err
+}
+
+func (h *handler[K, V]) parseKeys(ss []string) ([]K, error) {
+	keys := make([]K, len(ss))
+	for i, s := range ss {
+		k, err := h.opts.parseKey(s)
+		if err != nil {
+			return nil, badRequest{fmt.Errorf("invalid key %q: %w", s, err)}
+		}
+		keys[i] = k
+	}
+	return keys, nil
+}
+
+// fail writes the response of err.
+func (h *handler[K, V]) fail(w http.ResponseWriter, r *http.Request, err error) {
+	var (
+		badReq      badRequest
+		maxBytesErr *http.MaxBytesError
+	)
+	switch {
+	case errors.Is(err, kv.ErrNotFound):
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+	case errors.Is(err, ErrVersionMismatch):
+		http.Error(w, http.StatusText(http.StatusPreconditionFailed), http.StatusPreconditionFailed)
+	case errors.As(err, &maxBytesErr):
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+	case errors.As(err, &badReq):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		if h.opts.onError != nil {
+			h.opts.onError(r, err)
+		}
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+// matchETag reports whether the If-None-Match header matches etag, with
+// the weak comparison.
+func matchETag(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
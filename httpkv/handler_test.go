@@ -0,0 +1,247 @@
+package httpkv
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	kv "github.com/chenyanchen/kv"
+	"github.com/chenyanchen/kv/cachekv"
+)
+
+func do(t *testing.T, h http.Handler, method, target, body string, header ...string) *http.Response {
+	t.Helper()
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w.Result()
+}
+
+func readBody(t *testing.T, resp *http.Response) string {
+	t.Helper()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestHandler(t *testing.T) {
+	store := cachekv.NewRWMutex[string, int]()
+	h, err := NewHandler[string, int](store)
+	require.NoError(t, err)
+
+	resp := do(t, h, http.MethodGet, "/a", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp = do(t, h, http.MethodPut, "/a", "1")
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	// Keys may contain escaped slashes.
+	resp = do(t, h, http.MethodPut, "/dir%2Fb", "2")
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	v, err := store.Get(context.Background(), "dir/b")
+	require.NoError(t, err)
+	assert.Equal(t, 2, v)
+
+	resp = do(t, h, http.MethodGet, "/a", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "1", readBody(t, resp))
+
+	resp = do(t, h, http.MethodDelete, "/a", "")
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp = do(t, h, http.MethodGet, "/a", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp = do(t, h, http.MethodPut, "/a", "not json")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = do(t, h, http.MethodGet, "/", "")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = do(t, h, http.MethodPost, "/a", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+	_, err = NewHandler[string, int](nil)
+	require.Error(t, err)
+}
+
+func TestHandler_Keys(t *testing.T) {
+	store := cachekv.NewRWMutex[int64, []byte]()
+	h, err := NewHandler[int64, []byte](store, WithCodec[int64, []byte](BytesCodec{}))
+	require.NoError(t, err)
+
+	resp := do(t, h, http.MethodPut, "/42", "raw bytes")
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp = do(t, h, http.MethodGet, "/42", "")
+	assert.Equal(t, "application/octet-stream", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "raw bytes", readBody(t, resp))
+
+	resp = do(t, h, http.MethodGet, "/nan", "")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	type point struct{ x, y int }
+	h2, err := NewHandler[point, int](cachekv.NewRWMutex[point, int]())
+	require.NoError(t, err)
+	resp = do(t, h2, http.MethodGet, "/1,2", "")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "struct keys need WithKeys")
+}
+
+func TestHandler_Batch(t *testing.T) {
+	tests := map[string][]Option[string, int]{
+		"key by key": nil,
+		"BatchKV": {WithBatch[string, int](cachekv.NewBatch[string, int](
+			cachekv.NewRWMutex[string, int](), nil))},
+	}
+	for name, opts := range tests {
+		t.Run(name, func(t *testing.T) {
+			h, err := NewHandler[string, int](cachekv.NewRWMutex[string, int](), opts...)
+			require.NoError(t, err)
+
+			resp := do(t, h, http.MethodPost, "/_batch/set", `{"values": {"a": 1, "b": 2, "c": 3}}`)
+			assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+			resp = do(t, h, http.MethodPost, "/_batch/delete", `{"keys": ["c"]}`)
+			assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+			resp = do(t, h, http.MethodPost, "/_batch/get", `{"keys": ["a", "b", "c"]}`)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.JSONEq(t, `{"values": {"a": 1, "b": 2}}`, readBody(t, resp))
+
+			resp = do(t, h, http.MethodPost, "/_batch/get", `{"keys": [`)
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		})
+	}
+}
+
+func TestHandler_Errors(t *testing.T) {
+	var reported []error
+	store := errKV{err: errors.New("disk on fire")}
+	h, err := NewHandler[string, int](store,
+		WithMaxBodySize[string, int](4),
+		WithErrorHandler[string, int](func(_ *http.Request, err error) { reported = append(reported, err) }))
+	require.NoError(t, err)
+
+	resp := do(t, h, http.MethodGet, "/a", "")
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.NotContains(t, readBody(t, resp), "disk on fire", "store errors do not leak")
+	assert.Equal(t, []error{store.err}, reported)
+
+	resp = do(t, h, http.MethodPut, "/a", "12345")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+}
+
+func TestHandler_ETag(t *testing.T) {
+	h, err := NewHandler[string, int](cachekv.NewRWMutex[string, int]())
+	require.NoError(t, err)
+
+	do(t, h, http.MethodPut, "/a", "1")
+	etag := do(t, h, http.MethodGet, "/a", "").Header.Get("ETag")
+	require.NotEmpty(t, etag)
+
+	resp := do(t, h, http.MethodGet, "/a", "", "If-None-Match", etag)
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+	assert.Empty(t, readBody(t, resp))
+
+	do(t, h, http.MethodPut, "/a", "2")
+	resp = do(t, h, http.MethodGet, "/a", "", "If-None-Match", etag)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotEqual(t, etag, resp.Header.Get("ETag"))
+
+	resp = do(t, h, http.MethodPut, "/a", "3", "If-Match", etag)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "conditional writes need versions")
+}
+
+func TestHandler_Versioned(t *testing.T) {
+	h, err := NewHandler[string, int](&versionedKV{})
+	require.NoError(t, err)
+
+	do(t, h, http.MethodPut, "/a", "1")
+	resp := do(t, h, http.MethodGet, "/a", "")
+	etag := resp.Header.Get("ETag")
+	assert.Equal(t, `"1"`, etag)
+
+	resp = do(t, h, http.MethodPut, "/a", "2", "If-Match", etag)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp = do(t, h, http.MethodPut, "/a", "3", "If-Match", etag)
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode, "the version moved on")
+
+	resp = do(t, h, http.MethodPut, "/a", "3", "If-Match", `"abc"`)
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+
+	resp = do(t, h, http.MethodGet, "/a", "", "If-None-Match", `"2"`)
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+}
+
+type errKV struct{ err error }
+
+func (s errKV) Get(context.Context, string) (int, error) { return 0, s.err }
+func (s errKV) Set(context.Context, string, int) error   { return s.err }
+func (s errKV) Del(context.Context, string) error        { return s.err }
+
+// Every kv.CASKV serves conditional writes.
+var _ Versioner[string, int] = kv.CASKV[string, int](nil)
+
+// versionedKV is a store that versions its values.
+type versionedKV struct {
+	mu       sync.Mutex
+	values   map[string]int
+	versions map[string]uint64
+}
+
+func (s *versionedKV) Get(ctx context.Context, k string) (int, error) {
+	v, _, err := s.GetVersion(ctx, k)
+	return v, err
+}
+
+func (s *versionedKV) Set(_ context.Context, k string, v int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.set(k, v)
+	return nil
+}
+
+func (s *versionedKV) set(k string, v int) {
+	if s.values == nil {
+		s.values, s.versions = make(map[string]int), make(map[string]uint64)
+	}
+	s.values[k] = v
+	s.versions[k]++
+}
+
+func (s *versionedKV) Del(_ context.Context, k string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.values, k)
+	return nil
+}
+
+func (s *versionedKV) GetVersion(_ context.Context, k string) (int, uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.values[k]
+	if !ok {
+		return 0, 0, kv.ErrNotFound
+	}
+	return v, s.versions[k], nil
+}
+
+func (s *versionedKV) CompareAndSet(_ context.Context, k string, v int, version uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.versions[k] != version {
+		return ErrVersionMismatch
+	}
+	s.set(k, v)
+	return nil
+}
@@ -0,0 +1,73 @@
+// Package ring implements the consistent-hash ring spreading keys over
+// the nodes of a store, such as servers, peers or backends.
+package ring
+
+import (
+	"cmp"
+	"hash/fnv"
+	"slices"
+	"strconv"
+)
+
+// DefaultReplicas is the default number of points of each node on a ring.
+const DefaultReplicas = 160
+
+// Ring maps keys to nodes ketama-style: each node has points on a ring of
+// hashes, and a key belongs to the node of the first point at or after its
+// hash, wrapping around. Adding or removing a node only moves the keys
+// between its points and the previous ones.
+type Ring struct {
+	points []point
+}
+
+type point struct {
+	hash uint64
+	node int
+}
+
+// New returns the ring of the named nodes, with replicas points each.
+// The points of a node depend only on its name, not on its position in
+// names, so that processes listing the same nodes build the same ring.
+func New(names []string, replicas int) Ring {
+	points := make([]point, 0, len(names)*replicas)
+	for i, name := range names {
+		for r := range replicas {
+			points = append(points, point{hash: mix(Hash(name + "-" + strconv.Itoa(r))), node: i})
+		}
+	}
+	slices.SortFunc(points, func(a, b point) int {
+		if c := cmp.Compare(a.hash, b.hash); c != 0 {
+			return c
+		}
+		return cmp.Compare(names[a.node], names[b.node])
+	})
+	return Ring{points: points}
+}
+
+// Get returns the index in names of the node of a key hashed to h.
+func (r Ring) Get(h uint64) int {
+	h = mix(h)
+	i, _ := slices.BinarySearchFunc(r.points, h, func(p point, h uint64) int { return cmp.Compare(p.hash, h) })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.points[i].node
+}
+
+// Hash returns the hash of a string key, the same in every process.
+func Hash(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
+
+// mix is the finalizer of splitmix64, spreading close hashes, such as
+// those of consecutive integers, over the ring.
+func mix(h uint64) uint64 {
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
@@ -0,0 +1,46 @@
+package ring
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRing(t *testing.T) {
+	names := []string{"a", "b", "c"}
+	r := New(names, DefaultReplicas)
+	reordered := []string{"c", "a", "b"}
+	r2 := New(reordered, DefaultReplicas)
+	grown := New(append(names, "d"), DefaultReplicas)
+
+	counts := map[string]int{}
+	moved := 0
+	for i := range 10000 {
+		h := Hash(fmt.Sprint("key", i))
+		node := names[r.Get(h)]
+		counts[node]++
+		assert.Equal(t, node, reordered[r2.Get(h)], "the node of a key does not depend on the order of the names")
+
+		if g := grown.Get(h); g != 3 {
+			assert.Equal(t, node, names[g], "only keys moving to the new node move")
+		} else {
+			moved++
+		}
+	}
+	for _, name := range names {
+		assert.InDelta(t, 3333, counts[name], 700, name)
+	}
+	// About a quarter of the keys move to the new node.
+	assert.InDelta(t, 2500, moved, 500)
+}
+
+func TestRing_Integers(t *testing.T) {
+	// Consecutive hashes are spread over the nodes.
+	r := New([]string{"a", "b"}, DefaultReplicas)
+	counts := make([]int, 2)
+	for i := range 1000 {
+		counts[r.Get(uint64(i))]++
+	}
+	assert.InDelta(t, 500, counts[0], 150)
+}
@@ -0,0 +1,302 @@
+// Package invalidkv invalidates the caches of other processes on writes,
+// for replicas each layering a local cache over a shared store: a write
+// through one replica deletes the key from the caches of the others.
+//
+// Invalidations are best effort and asynchronous: the other caches may
+// serve the old value until the invalidation reaches them, and keep it if
+// it is lost. Bound the staleness with a cache TTL.
+package invalidkv
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	kv "github.com/chenyanchen/kv"
+)
+
+// ErrClosed is returned by the transports once closed.
+var ErrClosed = errors.New("invalidkv: transport closed")
+
+// Transport carries messages between processes. A transport may deliver
+// its own messages back to its process: they are ignored.
+type Transport interface {
+	// Publish sends msg to the other processes.
+	Publish(ctx context.Context, msg []byte) error
+	// Receive returns the next message, waiting for it until ctx is done.
+	// It returns ErrClosed once the transport is closed.
+	Receive(ctx context.Context) ([]byte, error)
+	// Close closes the transport.
+	Close() error
+}
+
+const (
+	defaultFlushInterval = 10 * time.Millisecond
+	defaultBatchSize     = 256
+
+	// closeTimeout bounds the last flush of Close, for a transport blocked
+	// by a peer not to block Close.
+	closeTimeout = time.Second
+)
+
+// Option configures an invalidating KV.
+type Option func(*options)
+
+type options struct {
+	interval  time.Duration
+	batchSize int
+	onError   func(error)
+}
+
+// WithFlushInterval returns an Option that sets how long the keys written
+// are batched before they are published. Defaults to 10ms.
+func WithFlushInterval(d time.Duration) Option {
+	return func(o *options) {
+		if d > 0 {
+			o.interval = d
+		}
+	}
+}
+
+// WithBatchSize returns an Option that sets the most keys of a message,
+// publishing as soon as that many are pending. Defaults to 256.
+func WithBatchSize(n int) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.batchSize = n
+		}
+	}
+}
+
+// WithErrorHandler returns an Option that reports the errors of the
+// background publishes and invalidations, which are otherwise dropped.
+func WithErrorHandler(onError func(error)) Option {
+	return func(o *options) {
+		o.onError = onError
+	}
+}
+
+// message is the invalidation of keys, by the process origin.
+type message[K comparable] struct {
+	Origin string `json:"origin"`
+	Keys   []K    `json:"keys"`
+}
+
+type invalidKV[K comparable, V any] struct {
+	store     kv.KV[K, V]
+	cache     kv.KV[K, V]
+	transport Transport
+	origin    string
+	opts      options
+
+	mu      sync.Mutex
+	pending map[K]struct{}
+	closed  bool
+	// flushMu serializes the flushes, for messages to leave in order.
+	flushMu sync.Mutex
+
+	full chan struct{}
+	// ctx is canceled by Close, to stop the loops.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	once   sync.Once
+}
+
+// New returns a kv.KV writing to store, such as a layerkv over cache, and
+// publishing the keys written to the other processes on transport. It
+// deletes from cache the keys that the others publish, until Close.
+func New[K comparable, V any](store, cache kv.KV[K, V], transport Transport, opts ...Option) (*invalidKV[K, V], error) {
+	if store == nil {
+		return nil, errors.New("store is nil")
+	}
+	if cache == nil {
+		return nil, errors.New("cache is nil")
+	}
+	if transport == nil {
+		return nil, errors.New("transport is nil")
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	o := options{interval: defaultFlushInterval, batchSize: defaultBatchSize}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &invalidKV[K, V]{
+		store:     store,
+		cache:     cache,
+		transport: transport,
+		origin:    hex.EncodeToString(id),
+		opts:      o,
+		pending:   make(map[K]struct{}),
+		full:      make(chan struct{}, 1),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+	s.wg.Add(2)
+	go s.publishLoop()
+	go s.receiveLoop()
+	return s, nil
+}
+
+func (s *invalidKV[K, V]) Get(ctx context.Context, k K) (V, error) {
+	return s.store.Get(ctx, k)
+}
+
+func (s *invalidKV[K, V]) Set(ctx context.Context, k K, v V) error {
+	if err := s.store.Set(ctx, k, v); err != nil {
+		return err
+	}
+	s.invalidate(k)
+	return nil
+}
+
+func (s *invalidKV[K, V]) Del(ctx context.Context, k K) error {
+	if err := s.store.Del(ctx, k); err != nil {
+		return err
+	}
+	s.invalidate(k)
+	return nil
+}
+
+// invalidate queues k for the next message, unless closed.
+func (s *invalidKV[K, V]) invalidate(k K) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.pending[k] = struct{}{}
+	full := len(s.pending) >= s.opts.batchSize
+	s.mu.Unlock()
+
+	if full {
+		select {
+		case s.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (s *invalidKV[K, V]) publishLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.opts.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.full:
+		}
+		// Close flushes the keys pending itself.
+		if s.ctx.Err() != nil {
+			return
+		}
+		// A publish blocked by a peer is interrupted by Close.
+		s.report(s.Flush(s.ctx))
+	}
+}
+
+// Flush publishes the keys written since the last flush now.
+func (s *invalidKV[K, V]) Flush(ctx context.Context) error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = make(map[K]struct{})
+	s.mu.Unlock()
+
+	keys := make([]K, 0, len(pending))
+	for k := range pending {
+		keys = append(keys, k)
+	}
+
+	var errs []error
+	for len(keys) > 0 {
+		n := min(len(keys), s.opts.batchSize)
+		msg, err := json.Marshal(message[K]{Origin: s.origin, Keys: keys[:n]})
+		if err == nil {
+			err = s.transport.Publish(ctx, msg)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("publish %d keys: %w", n, err))
+		}
+		keys = keys[n:]
+	}
+	return errors.Join(errs...)
+}
+
+func (s *invalidKV[K, V]) receiveLoop() {
+	defer s.wg.Done()
+
+	ctx := s.ctx
+	for {
+		data, err := s.transport.Receive(ctx)
+		if ctx.Err() != nil || errors.Is(err, ErrClosed) {
+			return
+		}
+		if err != nil {
+			s.report(fmt.Errorf("receive: %w", err))
+			// Do not spin on a transport failing.
+			select {
+			case <-ctx.Done():
+			case <-time.After(s.opts.interval):
+			}
+			continue
+		}
+
+		var msg message[K]
+		if err = json.Unmarshal(data, &msg); err != nil {
+			s.report(fmt.Errorf("decode message: %w", err))
+			continue
+		}
+		if msg.Origin == s.origin {
+			continue
+		}
+		for _, k := range msg.Keys {
+			if err = s.cache.Del(ctx, k); err != nil {
+				s.report(fmt.Errorf("invalidate %v: %w", k, err))
+			}
+		}
+	}
+}
+
+func (s *invalidKV[K, V]) report(err error) {
+	if err != nil && s.opts.onError != nil {
+		s.opts.onError(err)
+	}
+}
+
+// Close publishes the keys pending, waiting a second at most, stops the
+// invalidations and closes the transport. The writes after Close still
+// reach the store, but their keys are not published.
+func (s *invalidKV[K, V]) Close() error {
+	var err error
+	s.once.Do(func() {
+		s.cancel()
+		s.wg.Wait()
+
+		s.mu.Lock()
+		s.closed = true
+		s.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+		defer cancel()
+		err = errors.Join(s.Flush(ctx), s.transport.Close())
+	})
+	return err
+}
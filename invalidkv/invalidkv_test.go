@@ -0,0 +1,334 @@
+package invalidkv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	kv "github.com/chenyanchen/kv"
+	"github.com/chenyanchen/kv/cachekv"
+	"github.com/chenyanchen/kv/layerkv"
+)
+
+// countingCache counts the deletes of a cache.
+type countingCache struct {
+	kv.KV[string, int]
+	dels atomic.Int32
+}
+
+func (c *countingCache) Del(ctx context.Context, k string) error {
+	c.dels.Add(1)
+	return c.KV.Del(ctx, k)
+}
+
+type replica struct {
+	kv.KV[string, int]
+	cache *countingCache
+}
+
+// newReplicas returns replicas caching a shared store, one per transport.
+func newReplicas(t *testing.T, transports ...Transport) []*replica {
+	t.Helper()
+	store := cachekv.NewRWMutex[string, int]()
+	replicas := make([]*replica, len(transports))
+	for i, transport := range transports {
+		cache := &countingCache{KV: cachekv.NewRWMutex[string, int]()}
+		layer, err := layerkv.New[string, int](cache, store)
+		require.NoError(t, err)
+		s, err := New[string, int](layer, cache, transport, WithFlushInterval(time.Millisecond))
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = s.Close() })
+		replicas[i] = &replica{KV: s, cache: cache}
+	}
+	return replicas
+}
+
+// testInvalidation checks that a write through one replica invalidates
+// the cache of the others.
+func testInvalidation(t *testing.T, replicas []*replica) {
+	t.Helper()
+	ctx := context.Background()
+
+	require.NoError(t, replicas[0].Set(ctx, "a", 1))
+	for _, r := range replicas {
+		v, err := r.Get(ctx, "a")
+		require.NoError(t, err)
+		assert.Equal(t, 1, v)
+	}
+
+	require.NoError(t, replicas[0].Set(ctx, "a", 2))
+	for i, r := range replicas[1:] {
+		require.Eventually(t, func() bool {
+			v, err := r.Get(ctx, "a")
+			return err == nil && v == 2
+		}, 2*time.Second, time.Millisecond, "replica %d", i+1)
+	}
+
+	require.NoError(t, replicas[1].Del(ctx, "a"))
+	require.Eventually(t, func() bool {
+		_, err := replicas[0].Get(ctx, "a")
+		return errors.Is(err, kv.ErrNotFound)
+	}, 2*time.Second, time.Millisecond)
+}
+
+func TestInvalidKV(t *testing.T) {
+	ctx := context.Background()
+	bus := NewMemoryBus()
+	replicas := newReplicas(t, bus.Transport(), bus.Transport(), bus.Transport())
+	testInvalidation(t, replicas)
+
+	// The invalidations in flight are handled.
+	for _, r := range replicas {
+		require.Eventually(t, func() bool {
+			_, err := r.cache.Get(ctx, "a")
+			return errors.Is(err, kv.ErrNotFound)
+		}, time.Second, time.Millisecond)
+	}
+
+	// The memory bus delivers the messages of a replica to itself too,
+	// but they are ignored. It delivers them to replica 0 first, and in
+	// order: once replica 2 got the message of replica 0, and replica 0
+	// handled a later one of replica 1, replica 0 handled its own.
+	dels0, dels2 := replicas[0].cache.dels.Load(), replicas[2].cache.dels.Load()
+	require.NoError(t, replicas[0].Set(ctx, "b", 1))
+	require.Eventually(t, func() bool { return replicas[2].cache.dels.Load() > dels2 }, time.Second, time.Millisecond)
+	require.NoError(t, replicas[0].cache.Set(ctx, "c", 0))
+	require.NoError(t, replicas[1].Set(ctx, "c", 1))
+	require.Eventually(t, func() bool {
+		_, err := replicas[0].cache.Get(ctx, "c")
+		return errors.Is(err, kv.ErrNotFound)
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, dels0+2, replicas[0].cache.dels.Load(), "deleted by the layer and by replica 1 only")
+
+	store := cachekv.NewRWMutex[string, int]()
+	_, err := New[string, int](nil, store, bus.Transport())
+	require.Error(t, err)
+	_, err = New[string, int](store, nil, bus.Transport())
+	require.Error(t, err)
+	_, err = New[string, int](store, store, nil)
+	require.Error(t, err)
+}
+
+// recordingTransport records the keys of the messages published.
+type recordingTransport struct {
+	Transport
+	mu       sync.Mutex
+	messages [][]string
+}
+
+func (r *recordingTransport) Publish(ctx context.Context, msg []byte) error {
+	var m message[string]
+	if err := json.Unmarshal(msg, &m); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.messages = append(r.messages, m.Keys)
+	r.mu.Unlock()
+	return r.Transport.Publish(ctx, msg)
+}
+
+func (r *recordingTransport) keys() (keys []string, messages int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, m := range r.messages {
+		keys = append(keys, m...)
+	}
+	return keys, len(r.messages)
+}
+
+func TestInvalidKV_Batching(t *testing.T) {
+	ctx := context.Background()
+	bus := NewMemoryBus()
+	store := cachekv.NewRWMutex[string, int]()
+
+	transport := &recordingTransport{Transport: bus.Transport()}
+	s, err := New[string, int](store, store, transport, WithFlushInterval(time.Hour))
+	require.NoError(t, err)
+	for _, k := range []string{"a", "b", "a", "a"} {
+		require.NoError(t, s.Set(ctx, k, 1))
+	}
+	require.NoError(t, s.Flush(ctx))
+	keys, messages := transport.keys()
+	assert.Equal(t, 1, messages, "one message for the writes of the interval")
+	assert.ElementsMatch(t, []string{"a", "b"}, keys, "each key once")
+	require.NoError(t, s.Close())
+
+	// Full batches are published without waiting for the interval.
+	transport = &recordingTransport{Transport: bus.Transport()}
+	s, err = New[string, int](store, store, transport, WithFlushInterval(time.Hour), WithBatchSize(2))
+	require.NoError(t, err)
+	defer s.Close()
+	for i := range 5 {
+		require.NoError(t, s.Set(ctx, fmt.Sprint("k", i), i))
+	}
+	require.Eventually(t, func() bool {
+		keys, _ := transport.keys()
+		return len(keys) >= 4
+	}, time.Second, time.Millisecond)
+	require.NoError(t, s.Flush(ctx))
+	keys, _ = transport.keys()
+	assert.Len(t, keys, 5)
+	transport.mu.Lock()
+	defer transport.mu.Unlock()
+	for _, m := range transport.messages {
+		assert.LessOrEqual(t, len(m), 2)
+	}
+}
+
+func TestInvalidKV_Errors(t *testing.T) {
+	ctx := context.Background()
+	errs := make(chan error, 10)
+	bus := NewMemoryBus()
+	store := cachekv.NewRWMutex[string, int]()
+
+	// Messages that do not decode are reported.
+	other := bus.Transport()
+	s, err := New[string, int](store, store, bus.Transport(), WithErrorHandler(func(err error) { errs <- err }))
+	require.NoError(t, err)
+	require.NoError(t, other.Publish(ctx, []byte("not json")))
+	select {
+	case err := <-errs:
+		assert.Contains(t, err.Error(), "decode message")
+	case <-time.After(time.Second):
+		t.Fatal("not reported")
+	}
+
+	require.NoError(t, s.Close())
+	require.NoError(t, s.Close())
+	require.NoError(t, other.Close())
+}
+
+func TestInvalidKV_StuckPeer(t *testing.T) {
+	ctx := context.Background()
+	bus := NewMemoryBus()
+	store := cachekv.NewRWMutex[string, int]()
+
+	// A peer not receiving, with its buffer full, blocks the publishes.
+	stuck := bus.Transport()
+	defer stuck.Close()
+	for range memoryBuffer {
+		require.NoError(t, stuck.Publish(ctx, []byte("{}")))
+	}
+
+	transport := &recordingTransport{Transport: bus.Transport()}
+	s, err := New[string, int](store, store, transport, WithFlushInterval(time.Millisecond))
+	require.NoError(t, err)
+	require.NoError(t, s.Set(ctx, "a", 1))
+	require.Eventually(t, func() bool {
+		_, messages := transport.keys()
+		return messages == 1
+	}, time.Second, time.Millisecond, "publishing")
+
+	// Close interrupts the publish, and bounds its own.
+	require.NoError(t, s.Set(ctx, "b", 1))
+	closed := make(chan error)
+	go func() { closed <- s.Close() }()
+	select {
+	case err := <-closed:
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close blocked by the stuck peer")
+	}
+
+	// The writes after Close are not queued.
+	require.NoError(t, s.Set(ctx, "c", 1))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	assert.Empty(t, s.pending)
+}
+
+// freeAddrs returns addresses of free local TCP ports.
+func freeAddrs(t *testing.T, n int) []string {
+	t.Helper()
+	addrs := make([]string, n)
+	for i := range addrs {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		addrs[i] = ln.Addr().String()
+		require.NoError(t, ln.Close())
+	}
+	return addrs
+}
+
+func TestTCP(t *testing.T) {
+	addrs := freeAddrs(t, 3)
+	transports := make([]Transport, len(addrs))
+	for i, addr := range addrs {
+		var peers []string
+		for j, peer := range addrs {
+			if j != i {
+				peers = append(peers, peer)
+			}
+		}
+		tcp, err := NewTCP(addr, peers...)
+		require.NoError(t, err)
+		assert.Equal(t, addr, tcp.Addr().String())
+		transports[i] = tcp
+	}
+	testInvalidation(t, newReplicas(t, transports...))
+}
+
+func TestTCP_PeerRestart(t *testing.T) {
+	ctx := context.Background()
+	addrs := freeAddrs(t, 2)
+	a, err := NewTCP(addrs[0], addrs[1])
+	require.NoError(t, err)
+	defer a.Close()
+
+	// The peer is down.
+	require.Error(t, a.Publish(ctx, []byte("lost")))
+
+	b, err := NewTCP(addrs[1])
+	require.NoError(t, err)
+	require.NoError(t, a.Publish(ctx, []byte("1")))
+	msg, err := b.Receive(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "1", string(msg))
+
+	// It restarts: a dials it again.
+	require.NoError(t, b.Close())
+	_, err = b.Receive(ctx)
+	require.ErrorIs(t, err, ErrClosed)
+	b, err = NewTCP(addrs[1])
+	require.NoError(t, err)
+	defer b.Close()
+	require.Eventually(t, func() bool {
+		if a.Publish(ctx, []byte("2")) != nil {
+			return false
+		}
+		rctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		msg, err := b.Receive(rctx)
+		return err == nil && string(msg) == "2"
+	}, time.Second, time.Millisecond)
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = b.Receive(cctx)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestUDP(t *testing.T) {
+	group := fmt.Sprintf("239.255.42.%d:%d", 1+time.Now().UnixNano()%250, 20000+time.Now().UnixNano()%20000)
+	transports := make([]Transport, 2)
+	for i := range transports {
+		udp, err := NewUDP(group)
+		if err != nil {
+			t.Skipf("multicast unavailable: %v", err)
+		}
+		transports[i] = udp
+	}
+	testInvalidation(t, newReplicas(t, transports...))
+
+	_, err := NewUDP("127.0.0.1:7946")
+	require.Error(t, err, "not multicast")
+}
@@ -0,0 +1,87 @@
+package invalidkv
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// memoryBuffer is the number of messages buffered for each transport of a
+// MemoryBus; publishing waits for room.
+const memoryBuffer = 1024
+
+// MemoryBus connects transports in the same process, for tests or for
+// several caches of a process.
+type MemoryBus struct {
+	mu         sync.Mutex
+	transports []*memoryTransport
+}
+
+// NewMemoryBus returns an empty bus.
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{}
+}
+
+// Transport returns a new transport on the bus, receiving the messages
+// published by all of the transports of the bus, itself included.
+func (b *MemoryBus) Transport() Transport {
+	t := &memoryTransport{
+		bus:      b,
+		messages: make(chan []byte, memoryBuffer),
+		closed:   make(chan struct{}),
+	}
+	b.mu.Lock()
+	b.transports = append(b.transports, t)
+	b.mu.Unlock()
+	return t
+}
+
+type memoryTransport struct {
+	bus      *MemoryBus
+	messages chan []byte
+	closed   chan struct{}
+	once     sync.Once
+}
+
+func (t *memoryTransport) Publish(ctx context.Context, msg []byte) error {
+	select {
+	case <-t.closed:
+		return ErrClosed
+	default:
+	}
+
+	t.bus.mu.Lock()
+	transports := slices.Clone(t.bus.transports)
+	t.bus.mu.Unlock()
+
+	for _, other := range transports {
+		select {
+		case other.messages <- msg:
+		case <-other.closed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (t *memoryTransport) Receive(ctx context.Context) ([]byte, error) {
+	select {
+	case msg := <-t.messages:
+		return msg, nil
+	case <-t.closed:
+		return nil, ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (t *memoryTransport) Close() error {
+	t.once.Do(func() {
+		close(t.closed)
+		t.bus.mu.Lock()
+		t.bus.transports = slices.DeleteFunc(t.bus.transports, func(other *memoryTransport) bool { return other == t })
+		t.bus.mu.Unlock()
+	})
+	return nil
+}
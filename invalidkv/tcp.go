@@ -0,0 +1,230 @@
+package invalidkv
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// maxFrame is the largest message read from a TCP peer.
+	maxFrame = 16 << 20
+	// tcpTimeout bounds the dials and writes to a peer without a deadline
+	// in the context.
+	tcpTimeout = 5 * time.Second
+	// tcpBuffer is the number of messages received and not yet returned
+	// by Receive, after which the peers are not read.
+	tcpBuffer = 1024
+)
+
+type tcpTransport struct {
+	ln    net.Listener
+	peers []*tcpPeer
+
+	messages chan []byte
+	closed   chan struct{}
+	once     sync.Once
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+	wg    sync.WaitGroup
+}
+
+// tcpPeer is the connection to a peer, dialed on the first message.
+type tcpPeer struct {
+	addr string
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewTCP returns a transport listening on addr, such as ":7946", and
+// publishing to the transports listening on peers, over a connection to
+// each. Every process lists the others as its peers. Messages are lost if
+// a peer is down, and a process does not receive its own.
+func NewTCP(addr string, peers ...string) (*tcpTransport, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &tcpTransport{
+		ln:       ln,
+		messages: make(chan []byte, tcpBuffer),
+		closed:   make(chan struct{}),
+		conns:    make(map[net.Conn]struct{}),
+	}
+	for _, peer := range peers {
+		t.peers = append(t.peers, &tcpPeer{addr: peer})
+	}
+
+	t.wg.Add(1)
+	go t.accept()
+	return t, nil
+}
+
+// Addr returns the address the transport listens on.
+func (t *tcpTransport) Addr() net.Addr {
+	return t.ln.Addr()
+}
+
+func (t *tcpTransport) accept() {
+	defer t.wg.Done()
+	for {
+		conn, err := t.ln.Accept()
+		if err != nil {
+			return
+		}
+		if !t.track(conn) {
+			_ = conn.Close()
+			return
+		}
+
+		t.wg.Add(1)
+		go func() {
+			defer t.wg.Done()
+			defer t.untrack(conn)
+			t.read(conn)
+		}()
+	}
+}
+
+// track records conn to be closed by Close, unless it is closed already.
+func (t *tcpTransport) track(conn net.Conn) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	select {
+	case <-t.closed:
+		return false
+	default:
+		t.conns[conn] = struct{}{}
+		return true
+	}
+}
+
+func (t *tcpTransport) untrack(conn net.Conn) {
+	t.mu.Lock()
+	delete(t.conns, conn)
+	t.mu.Unlock()
+	_ = conn.Close()
+}
+
+// read queues the messages of conn until it fails.
+func (t *tcpTransport) read(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	var size [4]byte
+	for {
+		if _, err := io.ReadFull(r, size[:]); err != nil {
+			return
+		}
+		n := binary.BigEndian.Uint32(size[:])
+		if n > maxFrame {
+			return
+		}
+		msg := make([]byte, n)
+		if _, err := io.ReadFull(r, msg); err != nil {
+			return
+		}
+
+		select {
+		case t.messages <- msg:
+		case <-t.closed:
+			return
+		}
+	}
+}
+
+func (t *tcpTransport) Publish(ctx context.Context, msg []byte) error {
+	select {
+	case <-t.closed:
+		return ErrClosed
+	default:
+	}
+	if len(msg) > maxFrame {
+		return fmt.Errorf("message of %d bytes exceeds %d", len(msg), maxFrame)
+	}
+
+	frame := binary.BigEndian.AppendUint32(make([]byte, 0, 4+len(msg)), uint32(len(msg)))
+	frame = append(frame, msg...)
+
+	var errs []error
+	for _, peer := range t.peers {
+		if err := peer.send(ctx, frame); err != nil {
+			errs = append(errs, fmt.Errorf("peer %s: %w", peer.addr, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// send writes frame to the peer, dialing it again once if the connection
+// failed, e.g. as the peer restarted.
+func (p *tcpPeer) send(ctx context.Context, frame []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(tcpTimeout)
+	}
+
+	var err error
+	for range 2 {
+		if p.conn == nil {
+			d := net.Dialer{Deadline: deadline}
+			if p.conn, err = d.DialContext(ctx, "tcp", p.addr); err != nil {
+				return err
+			}
+		}
+		_ = p.conn.SetWriteDeadline(deadline)
+		if _, err = p.conn.Write(frame); err == nil {
+			return nil
+		}
+		_ = p.conn.Close()
+		p.conn = nil
+	}
+	return err
+}
+
+func (p *tcpPeer) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn != nil {
+		_ = p.conn.Close()
+		p.conn = nil
+	}
+}
+
+func (t *tcpTransport) Receive(ctx context.Context) ([]byte, error) {
+	select {
+	case msg := <-t.messages:
+		return msg, nil
+	case <-t.closed:
+		return nil, ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (t *tcpTransport) Close() error {
+	var err error
+	t.once.Do(func() {
+		t.mu.Lock()
+		close(t.closed)
+		for conn := range t.conns {
+			_ = conn.Close()
+		}
+		t.mu.Unlock()
+
+		err = t.ln.Close()
+		for _, peer := range t.peers {
+			peer.close()
+		}
+		t.wg.Wait()
+	})
+	return err
+}
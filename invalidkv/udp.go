@@ -0,0 +1,80 @@
+package invalidkv
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+// maxDatagram is the largest UDP payload.
+const maxDatagram = 65507
+
+type udpTransport struct {
+	group  *net.UDPAddr
+	listen *net.UDPConn
+	send   *net.UDPConn
+	buf    []byte
+}
+
+// NewUDP returns a transport on an IPv4 UDP multicast group, such as
+// "239.255.0.1:7946", joined on the default interface. Every process of
+// the group receives the messages, the publisher included, and they are
+// lost if the network drops them. A message must fit in a datagram: keep
+// batches small with WithBatchSize.
+func NewUDP(group string) (*udpTransport, error) {
+	addr, err := net.ResolveUDPAddr("udp4", group)
+	if err != nil {
+		return nil, err
+	}
+	if !addr.IP.IsMulticast() {
+		return nil, errors.New("not a multicast address")
+	}
+
+	listen, err := net.ListenMulticastUDP("udp4", nil, addr)
+	if err != nil {
+		return nil, err
+	}
+	send, err := net.DialUDP("udp4", nil, addr)
+	if err != nil {
+		_ = listen.Close()
+		return nil, err
+	}
+	return &udpTransport{group: addr, listen: listen, send: send, buf: make([]byte, maxDatagram)}, nil
+}
+
+func (t *udpTransport) Publish(ctx context.Context, msg []byte) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = t.send.SetWriteDeadline(deadline)
+	}
+	_, err := t.send.Write(msg)
+	return closedErr(err)
+}
+
+func (t *udpTransport) Receive(ctx context.Context) ([]byte, error) {
+	// Interrupt the read once ctx is done.
+	_ = t.listen.SetReadDeadline(time.Time{})
+	stop := context.AfterFunc(ctx, func() { _ = t.listen.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	n, _, err := t.listen.ReadFromUDP(t.buf)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, closedErr(err)
+	}
+	return append([]byte(nil), t.buf[:n]...), nil
+}
+
+func (t *udpTransport) Close() error {
+	return errors.Join(t.listen.Close(), t.send.Close())
+}
+
+// closedErr returns ErrClosed for the errors of a closed connection.
+func closedErr(err error) error {
+	if errors.Is(err, net.ErrClosed) {
+		return ErrClosed
+	}
+	return err
+}
@@ -4,26 +4,46 @@ import (
 	"context"
 	"errors"
 	"maps"
+	"time"
 
 	kv "github.com/chenyanchen/kv"
 )
 
 type batch[K comparable, V any] struct {
-	cache kv.BatchKV[K, V]
-	store kv.BatchKV[K, V]
+	cache        kv.BatchKV[K, V]
+	store        kv.BatchKV[K, V]
+	writeThrough bool
+	leases       *leases[K]
+	deleteDelay  time.Duration
+	// afterFunc schedules the second deletes, time.AfterFunc if nil.
+	afterFunc func(time.Duration, func())
 }
 
-func NewBatch[K comparable, V any](cache, store kv.BatchKV[K, V]) (*batch[K, V], error) {
+// NewBatch creates a layered BatchKV store that checks cache before store,
+// like New, with the same options.
+func NewBatch[K comparable, V any](cache, store kv.BatchKV[K, V], opts ...Option) (*batch[K, V], error) {
 	if cache == nil {
 		return nil, errors.New("cache is nil")
 	}
 	if store == nil {
 		return nil, errors.New("store is nil")
 	}
-	return &batch[K, V]{
-		cache: cache,
-		store: store,
-	}, nil
+
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	l := &batch[K, V]{
+		cache:        cache,
+		store:        store,
+		writeThrough: o.writeThrough,
+		deleteDelay:  o.deleteDelay,
+	}
+	if o.leases {
+		l.leases = newLeases[K]()
+	}
+	return l, nil
 }
 
 func (l batch[K, V]) Get(ctx context.Context, keys []K) (map[K]V, error) {
@@ -43,14 +63,41 @@ func (l batch[K, V]) Get(ctx context.Context, keys []K) (map[K]V, error) {
 		}
 	}
 
+	if l.leases == nil {
+		store, err := l.store.Get(ctx, miss)
+		if err != nil {
+			return nil, err
+		}
+
+		maps.Copy(cache, store)
+
+		return cache, l.cache.Set(ctx, store)
+	}
+
+	tokens := make(map[K]uint64, len(miss))
+	for _, k := range miss {
+		tokens[k] = l.leases.acquire(k)
+	}
 	store, err := l.store.Get(ctx, miss)
+	for k, token := range tokens {
+		if _, ok := store[k]; err != nil || !ok {
+			l.leases.release(k, token)
+			delete(tokens, k)
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	maps.Copy(cache, store)
 
-	return cache, l.cache.Set(ctx, store)
+	return cache, l.leases.fillBatch(tokens, func(held []K) error {
+		fill := make(map[K]V, len(held))
+		for _, k := range held {
+			fill[k] = store[k]
+		}
+		return l.cache.Set(ctx, fill)
+	})
 }
 
 func (l batch[K, V]) Set(ctx context.Context, kvs map[K]V) error {
@@ -63,6 +110,10 @@ func (l batch[K, V]) Set(ctx context.Context, kvs map[K]V) error {
 	for k := range kvs {
 		keys = append(keys, k)
 	}
+	l.revoke(ctx, keys)
+	if l.writeThrough {
+		return l.cache.Set(ctx, kvs)
+	}
 	return l.cache.Del(ctx, keys)
 }
 
@@ -71,5 +122,26 @@ func (l batch[K, V]) Del(ctx context.Context, keys []K) error {
 		return err
 	}
 
+	l.revoke(ctx, keys)
 	return l.cache.Del(ctx, keys)
 }
+
+// revoke discards the fills of keys in flight, see layerKV.revoke.
+func (l batch[K, V]) revoke(ctx context.Context, keys []K) {
+	if l.leases != nil {
+		for _, k := range keys {
+			l.leases.revoke(k)
+		}
+	}
+	if l.deleteDelay <= 0 {
+		return
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	del := func() { _ = l.cache.Del(ctx, keys) }
+	if l.afterFunc != nil {
+		l.afterFunc(l.deleteDelay, del)
+		return
+	}
+	time.AfterFunc(l.deleteDelay, del)
+}
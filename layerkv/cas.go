@@ -0,0 +1,46 @@
+package layerkv
+
+import (
+	"context"
+	"errors"
+
+	kv "github.com/chenyanchen/kv"
+)
+
+type casKV[K comparable, V any] struct {
+	*layerKV[K, V]
+	store kv.CASKV[K, V]
+}
+
+// NewCAS creates a layered KV store like New, over a store implementing
+// kv.CASKV. Versions are those of the store: GetVersion reads the store,
+// and conditional writes go to the store before updating the cache as Set.
+func NewCAS[K comparable, V any](cache kv.KV[K, V], store kv.CASKV[K, V], opts ...Option) (*casKV[K, V], error) {
+	if store == nil {
+		return nil, errors.New("store is nil")
+	}
+
+	l, err := New[K, V](cache, store, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &casKV[K, V]{layerKV: l, store: store}, nil
+}
+
+func (l *casKV[K, V]) GetVersion(ctx context.Context, k K) (V, uint64, error) {
+	return l.store.GetVersion(ctx, k)
+}
+
+func (l *casKV[K, V]) CompareAndSet(ctx context.Context, k K, v V, version uint64) error {
+	if err := l.store.CompareAndSet(ctx, k, v, version); err != nil {
+		return err
+	}
+	return l.written(ctx, k, v)
+}
+
+func (l *casKV[K, V]) SetIfAbsent(ctx context.Context, k K, v V) error {
+	if err := l.store.SetIfAbsent(ctx, k, v); err != nil {
+		return err
+	}
+	return l.written(ctx, k, v)
+}
@@ -0,0 +1,60 @@
+package layerkv
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	kv "github.com/chenyanchen/kv"
+	"github.com/chenyanchen/kv/cachekv"
+)
+
+func TestCASKV(t *testing.T) {
+	ctx := context.Background()
+	for _, writeThrough := range []bool{false, true} {
+		var opts []Option
+		if writeThrough {
+			opts = append(opts, WithWriteThrough())
+		}
+		cache := cachekv.NewRWMutexCAS[string, int]()
+		store := cachekv.NewRWMutexCAS[string, int]()
+		l, err := NewCAS[string, int](cache, store, opts...)
+		require.NoError(t, err)
+
+		require.NoError(t, l.SetIfAbsent(ctx, "a", 1))
+		require.ErrorIs(t, l.SetIfAbsent(ctx, "a", 2), kv.ErrVersionMismatch)
+		v, err := l.Get(ctx, "a")
+		require.NoError(t, err)
+		assert.Equal(t, 1, v)
+
+		// The versions are those of the store, not of the cache.
+		v, version, err := l.GetVersion(ctx, "a")
+		require.NoError(t, err)
+		assert.Equal(t, 1, v)
+		_, storeVersion, err := store.GetVersion(ctx, "a")
+		require.NoError(t, err)
+		assert.Equal(t, storeVersion, version)
+
+		require.NoError(t, l.CompareAndSet(ctx, "a", 2, version))
+		require.ErrorIs(t, l.CompareAndSet(ctx, "a", 3, version), kv.ErrVersionMismatch)
+
+		// The cache does not serve the old value.
+		v, err = l.Get(ctx, "a")
+		require.NoError(t, err)
+		assert.Equal(t, 2, v)
+
+		v, err = kv.Update[string, int](ctx, l, "a", func(old int) (int, error) { return old * 10, nil })
+		require.NoError(t, err)
+		assert.Equal(t, 20, v)
+		v, err = l.Get(ctx, "a")
+		require.NoError(t, err)
+		assert.Equal(t, 20, v)
+	}
+
+	_, err := NewCAS[string, int](cachekv.NewRWMutexCAS[string, int](), nil)
+	require.Error(t, err)
+	_, err = NewCAS[string, int](nil, cachekv.NewRWMutexCAS[string, int]())
+	require.Error(t, err)
+}
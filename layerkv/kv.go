@@ -3,15 +3,18 @@ package layerkv
 import (
 	"context"
 	"errors"
+	"time"
 
 	kv "github.com/chenyanchen/kv"
 )
 
-// Option configures layerKV behavior.
+// Option configures the layers of New and NewBatch.
 type Option func(*options)
 
 type options struct {
 	writeThrough bool
+	leases       bool
+	deleteDelay  time.Duration
 }
 
 // WithWriteThrough returns an Option that enables write-through caching.
@@ -22,10 +25,39 @@ func WithWriteThrough() Option {
 	}
 }
 
+// WithLeases returns an Option that closes the race between a cache miss
+// and a write: without it, a Get reading the old value from the store
+// before a concurrent Set may cache it after the Set invalidated the
+// cache, where it stays until evicted. With it, a miss takes a lease on
+// the key before reading the store, writes revoke the lease, and the
+// value read under a revoked lease is returned but not cached.
+//
+// The leases are held by this store, so they order the reads and writes
+// through it only. For writes from other processes, see WithDoubleDelete.
+func WithLeases() Option {
+	return func(o *options) {
+		o.leases = true
+	}
+}
+
+// WithDoubleDelete returns an Option that deletes a key from the cache
+// again, delay after each write, evicting the old value that a read in
+// flight during the write may have cached meanwhile. delay should exceed
+// the time of a store read. The errors of the second delete are dropped.
+func WithDoubleDelete(delay time.Duration) Option {
+	return func(o *options) {
+		o.deleteDelay = delay
+	}
+}
+
 type layerKV[K comparable, V any] struct {
 	cache        kv.KV[K, V]
 	store        kv.KV[K, V]
 	writeThrough bool
+	leases       *leases[K]
+	deleteDelay  time.Duration
+	// afterFunc schedules the second deletes, time.AfterFunc if nil.
+	afterFunc func(time.Duration, func())
 }
 
 // New creates a layered KV store that checks cache before store.
@@ -43,11 +75,16 @@ func New[K comparable, V any](cache, store kv.KV[K, V], opts ...Option) (*layerK
 		opt(o)
 	}
 
-	return &layerKV[K, V]{
+	l := &layerKV[K, V]{
 		cache:        cache,
 		store:        store,
 		writeThrough: o.writeThrough,
-	}, nil
+		deleteDelay:  o.deleteDelay,
+	}
+	if o.leases {
+		l.leases = newLeases[K]()
+	}
+	return l, nil
 }
 
 func (l *layerKV[K, V]) Get(ctx context.Context, k K) (V, error) {
@@ -60,23 +97,37 @@ func (l *layerKV[K, V]) Get(ctx context.Context, k K) (V, error) {
 		return v, err
 	}
 
+	if l.leases == nil {
+		v, err = l.store.Get(ctx, k)
+		if err != nil {
+			return v, err
+		}
+		return v, l.cache.Set(ctx, k, v)
+	}
+
+	token := l.leases.acquire(k)
 	v, err = l.store.Get(ctx, k)
 	if err != nil {
+		l.leases.release(k, token)
 		return v, err
 	}
-
-	return v, l.cache.Set(ctx, k, v)
+	return v, l.leases.fill(k, token, func() error { return l.cache.Set(ctx, k, v) })
 }
 
 func (l *layerKV[K, V]) Set(ctx context.Context, k K, v V) error {
 	if err := l.store.Set(ctx, k, v); err != nil {
 		return err
 	}
+	return l.written(ctx, k, v)
+}
 
-	if l.writeThrough {
-		return l.cache.Set(ctx, k, v)
+// written updates or invalidates the cache after v is written to the store.
+func (l *layerKV[K, V]) written(ctx context.Context, k K, v V) error {
+	if !l.writeThrough {
+		return l.invalidate(ctx, k)
 	}
-	return l.cache.Del(ctx, k)
+	l.revoke(ctx, k)
+	return l.cache.Set(ctx, k, v)
 }
 
 func (l *layerKV[K, V]) Del(ctx context.Context, k K) error {
@@ -84,5 +135,30 @@ func (l *layerKV[K, V]) Del(ctx context.Context, k K) error {
 		return err
 	}
 
+	return l.invalidate(ctx, k)
+}
+
+// invalidate deletes k from the cache after a write to the store.
+func (l *layerKV[K, V]) invalidate(ctx context.Context, k K) error {
+	l.revoke(ctx, k)
 	return l.cache.Del(ctx, k)
 }
+
+// revoke discards the fills of k in flight: it revokes the lease on k and
+// schedules the second delete of k.
+func (l *layerKV[K, V]) revoke(ctx context.Context, k K) {
+	if l.leases != nil {
+		l.leases.revoke(k)
+	}
+	if l.deleteDelay <= 0 {
+		return
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	del := func() { _ = l.cache.Del(ctx, k) }
+	if l.afterFunc != nil {
+		l.afterFunc(l.deleteDelay, del)
+		return
+	}
+	time.AfterFunc(l.deleteDelay, del)
+}
@@ -0,0 +1,117 @@
+package layerkv
+
+import (
+	"hash/maphash"
+	"sync"
+	"sync/atomic"
+)
+
+// leaseStripes is the number of locks of the leases, so that the cache
+// fills of keys of different stripes do not wait on each other.
+const leaseStripes = 64
+
+// leases tracks the cache fills in flight, as the leases of memcache: a
+// cache miss takes a lease on the key before reading the store, and a
+// write revokes it, so that the value read before the write is not
+// cached after it.
+type leases[K comparable] struct {
+	stripes [leaseStripes]leaseStripe[K]
+	seed    maphash.Seed
+	next    atomic.Uint64
+}
+
+// leaseStripe holds the leases of the keys hashed to it.
+type leaseStripe[K comparable] struct {
+	mu     sync.Mutex
+	tokens map[K]uint64
+}
+
+func newLeases[K comparable]() *leases[K] {
+	l := &leases[K]{seed: maphash.MakeSeed()}
+	for i := range l.stripes {
+		l.stripes[i].tokens = make(map[K]uint64)
+	}
+	return l
+}
+
+func (l *leases[K]) index(k K) uint64 {
+	return maphash.Comparable(l.seed, k) % leaseStripes
+}
+
+func (l *leases[K]) stripe(k K) *leaseStripe[K] {
+	return &l.stripes[l.index(k)]
+}
+
+// acquire returns the token of the lease on k, shared by the misses of k
+// until it is revoked.
+func (l *leases[K]) acquire(k K) uint64 {
+	s := l.stripe(k)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if token, ok := s.tokens[k]; ok {
+		return token
+	}
+	token := l.next.Add(1)
+	s.tokens[k] = token
+	return token
+}
+
+// fill calls set if the lease token on k is still held, and releases it.
+// set runs under the lock of the stripe of k, for a write not to revoke
+// the lease between the check and the fill.
+func (l *leases[K]) fill(k K, token uint64, set func() error) error {
+	s := l.stripe(k)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tokens[k] != token {
+		return nil
+	}
+	delete(s.tokens, k)
+	return set()
+}
+
+// fillBatch calls set with the keys of tokens whose lease token is still
+// held, if any, and releases them. set runs under the locks of their
+// stripes, see fill, taken in order for concurrent batches not to deadlock.
+func (l *leases[K]) fillBatch(tokens map[K]uint64, set func(held []K) error) error {
+	var stripes [leaseStripes]bool
+	for k := range tokens {
+		stripes[l.index(k)] = true
+	}
+	for i, ok := range stripes {
+		if ok {
+			l.stripes[i].mu.Lock()
+			defer l.stripes[i].mu.Unlock()
+		}
+	}
+
+	held := make([]K, 0, len(tokens))
+	for k, token := range tokens {
+		if s := l.stripe(k); s.tokens[k] == token {
+			delete(s.tokens, k)
+			held = append(held, k)
+		}
+	}
+	if len(held) == 0 {
+		return nil
+	}
+	return set(held)
+}
+
+// release gives up the lease token on k without filling the cache.
+func (l *leases[K]) release(k K, token uint64) {
+	s := l.stripe(k)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tokens[k] == token {
+		delete(s.tokens, k)
+	}
+}
+
+// revoke invalidates the lease on k, if any.
+func (l *leases[K]) revoke(k K) {
+	s := l.stripe(k)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tokens, k)
+}
@@ -0,0 +1,283 @@
+package layerkv
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	kv "github.com/chenyanchen/kv"
+	"github.com/chenyanchen/kv/cachekv"
+)
+
+// pausedStore pauses the next Get after reading the store, until resumed.
+type pausedStore struct {
+	kv.KV[string, int]
+	read   chan struct{}
+	resume chan struct{}
+}
+
+func newPausedStore() *pausedStore {
+	return &pausedStore{
+		KV:     cachekv.NewRWMutex[string, int](),
+		read:   make(chan struct{}),
+		resume: make(chan struct{}),
+	}
+}
+
+func (s *pausedStore) Get(ctx context.Context, k string) (int, error) {
+	v, err := s.KV.Get(ctx, k)
+	if s.read != nil {
+		close(s.read)
+		<-s.resume
+		s.read = nil
+	}
+	return v, err
+}
+
+// staleFill reads k = 1 through l, pausing the read after the store
+// returned 1 while l sets k = 2, and returns the value read.
+func staleFill(t *testing.T, l *layerKV[string, int], store *pausedStore) int {
+	t.Helper()
+	ctx := context.Background()
+	require.NoError(t, store.KV.Set(ctx, "k", 1))
+
+	got := make(chan int)
+	go func() {
+		v, err := l.Get(ctx, "k")
+		assert.NoError(t, err)
+		got <- v
+	}()
+	<-store.read
+	require.NoError(t, l.Set(ctx, "k", 2))
+	close(store.resume)
+	return <-got
+}
+
+func TestLayerKV_StaleFill(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		opts      []Option
+		wantCache int // 0 if not cached
+	}{
+		{name: "default", wantCache: 1},
+		{name: "leases", opts: []Option{WithLeases()}},
+		{name: "leases write-through", opts: []Option{WithLeases(), WithWriteThrough()}, wantCache: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := cachekv.NewRWMutex[string, int]()
+			store := newPausedStore()
+			l, err := New[string, int](cache, store, tt.opts...)
+			require.NoError(t, err)
+
+			assert.Equal(t, 1, staleFill(t, l, store), "read before the write")
+			v, err := cache.Get(ctx, "k")
+			if tt.wantCache == 0 {
+				require.ErrorIs(t, err, kv.ErrNotFound, "stale value not cached")
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.wantCache, v)
+			}
+
+			v, err = l.Get(ctx, "k")
+			require.NoError(t, err)
+			if tt.wantCache == 1 {
+				assert.Equal(t, 1, v, "the race leaves the stale value")
+			} else {
+				assert.Equal(t, 2, v)
+			}
+		})
+	}
+}
+
+func TestLayerKV_Leases(t *testing.T) {
+	ctx := context.Background()
+	cache := cachekv.NewRWMutex[string, int]()
+	store := cachekv.NewRWMutex[string, int]()
+	l, err := New[string, int](cache, store, WithLeases())
+	require.NoError(t, err)
+
+	// Misses of absent keys release their lease.
+	_, err = l.Get(ctx, "k")
+	require.ErrorIs(t, err, kv.ErrNotFound)
+	assert.Zero(t, held(l.leases))
+
+	require.NoError(t, store.Set(ctx, "k", 1))
+	v, err := l.Get(ctx, "k")
+	require.NoError(t, err)
+	assert.Equal(t, 1, v)
+	v, err = cache.Get(ctx, "k")
+	require.NoError(t, err, "filled under the lease")
+	assert.Equal(t, 1, v)
+	assert.Zero(t, held(l.leases))
+
+	// Concurrent misses share the lease, and a Del revokes it.
+	token := l.leases.acquire("x")
+	assert.Equal(t, token, l.leases.acquire("x"))
+	require.NoError(t, l.Del(ctx, "x"))
+	assert.NotEqual(t, token, l.leases.acquire("x"))
+
+	// Fill errors are returned.
+	token = l.leases.acquire("y")
+	assert.ErrorIs(t, l.leases.fill("y", token, func() error { return assert.AnError }), assert.AnError)
+	assert.NoError(t, l.leases.fill("y", token, func() error { return errors.New("not filled") }))
+}
+
+// held returns the number of leases held.
+func held[K comparable](l *leases[K]) int {
+	n := 0
+	for i := range l.stripes {
+		s := &l.stripes[i]
+		s.mu.Lock()
+		n += len(s.tokens)
+		s.mu.Unlock()
+	}
+	return n
+}
+
+func TestLeases_Stripes(t *testing.T) {
+	l := newLeases[int]()
+
+	// A slow fill holds the stripe of its key only.
+	filling, release := make(chan struct{}), make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- l.fill(0, l.acquire(0), func() error {
+			close(filling)
+			<-release
+			return nil
+		})
+	}()
+	<-filling
+
+	k := 1
+	for l.stripe(k) == l.stripe(0) {
+		k++
+	}
+	filled := false
+	require.NoError(t, l.fill(k, l.acquire(k), func() error { filled = true; return nil }))
+	assert.True(t, filled)
+	l.revoke(k)
+
+	close(release)
+	require.NoError(t, <-done)
+	assert.Zero(t, held(l))
+}
+
+func TestLayerKV_DoubleDelete(t *testing.T) {
+	ctx := context.Background()
+	cache := cachekv.NewRWMutex[string, int]()
+	store := newPausedStore()
+	l, err := New[string, int](cache, store, WithDoubleDelete(time.Second))
+	require.NoError(t, err)
+
+	var delays []time.Duration
+	var deletes []func()
+	l.afterFunc = func(d time.Duration, f func()) {
+		delays = append(delays, d)
+		deletes = append(deletes, f)
+	}
+
+	assert.Equal(t, 1, staleFill(t, l, store))
+	v, err := cache.Get(ctx, "k")
+	require.NoError(t, err)
+	assert.Equal(t, 1, v, "stale until the second delete")
+
+	require.Len(t, deletes, 1)
+	assert.Equal(t, time.Second, delays[0])
+	deletes[0]()
+	v, err = l.Get(ctx, "k")
+	require.NoError(t, err)
+	assert.Equal(t, 2, v)
+
+	require.NoError(t, l.Del(ctx, "k"))
+	assert.Len(t, deletes, 2)
+}
+
+// pausedBatch pauses the next Get after reading the store, until resumed.
+type pausedBatch struct {
+	kv.BatchKV[string, int]
+	read   chan struct{}
+	resume chan struct{}
+}
+
+func (s *pausedBatch) Get(ctx context.Context, keys []string) (map[string]int, error) {
+	kvs, err := s.BatchKV.Get(ctx, keys)
+	if s.read != nil {
+		close(s.read)
+		<-s.resume
+		s.read = nil
+	}
+	return kvs, err
+}
+
+func TestBatch_StaleFill(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		opts   []Option
+		wantA  int // 0 if not cached
+		second bool
+	}{
+		{name: "default", wantA: 1},
+		{name: "leases", opts: []Option{WithLeases()}},
+		{name: "leases write-through", opts: []Option{WithLeases(), WithWriteThrough()}, wantA: 2},
+		{name: "double delete", opts: []Option{WithDoubleDelete(time.Second)}, wantA: 1, second: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := cachekv.NewBatch[string, int](cachekv.NewRWMutex[string, int](), nil)
+			store := &pausedBatch{
+				BatchKV: cachekv.NewBatch[string, int](cachekv.NewRWMutex[string, int](), nil),
+				read:    make(chan struct{}),
+				resume:  make(chan struct{}),
+			}
+			require.NoError(t, store.BatchKV.Set(ctx, map[string]int{"a": 1, "b": 1}))
+			l, err := NewBatch[string, int](cache, store, tt.opts...)
+			require.NoError(t, err)
+			var deletes []func()
+			l.afterFunc = func(_ time.Duration, f func()) { deletes = append(deletes, f) }
+
+			// a is written while the batch read of a and b is paused.
+			got := make(chan map[string]int)
+			go func() {
+				kvs, err := l.Get(ctx, []string{"a", "b"})
+				assert.NoError(t, err)
+				got <- kvs
+			}()
+			<-store.read
+			require.NoError(t, l.Set(ctx, map[string]int{"a": 2}))
+			close(store.resume)
+			assert.Equal(t, map[string]int{"a": 1, "b": 1}, <-got, "read before the write")
+
+			cached, err := cache.Get(ctx, []string{"a", "b"})
+			require.NoError(t, err)
+			assert.Equal(t, 1, cached["b"], "the other keys are filled")
+			if tt.wantA == 0 {
+				assert.NotContains(t, cached, "a", "stale value not cached")
+			} else {
+				assert.Equal(t, tt.wantA, cached["a"])
+			}
+
+			if tt.second {
+				require.Len(t, deletes, 1)
+				deletes[0]()
+				kvs, err := l.Get(ctx, []string{"a"})
+				require.NoError(t, err)
+				assert.Equal(t, 2, kvs["a"], "fresh after the second delete")
+			} else {
+				assert.Empty(t, deletes)
+			}
+			if l.leases != nil {
+				assert.Zero(t, held(l.leases))
+			}
+		})
+	}
+}
@@ -0,0 +1,360 @@
+package memcachekv
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	kv "github.com/chenyanchen/kv"
+	"github.com/chenyanchen/kv/internal/ring"
+)
+
+const (
+	defaultPoolSize    = 10
+	defaultDialTimeout = 5 * time.Second
+)
+
+// ErrClosed is returned by a closed Client.
+var ErrClosed = errors.New("client is closed")
+
+// ClientOption configures a Client.
+type ClientOption func(*clientOptions)
+
+type clientOptions struct {
+	poolSize    int
+	dialTimeout time.Duration
+}
+
+// WithPoolSize returns a ClientOption that sets the maximum number of
+// connections open at the same time to each server. Defaults to 10.
+func WithPoolSize(n int) ClientOption {
+	return func(o *clientOptions) {
+		if n > 0 {
+			o.poolSize = n
+		}
+	}
+}
+
+// WithDialTimeout returns a ClientOption that bounds the time to open a
+// connection. Defaults to 5 seconds.
+func WithDialTimeout(d time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		if d > 0 {
+			o.dialTimeout = d
+		}
+	}
+}
+
+// Client is a memcached text protocol client. Keys are spread across the
+// servers by consistent hashing, and each server has a connection pool.
+// It is safe for concurrent use.
+type Client struct {
+	servers []*server
+	ring    ring.Ring
+}
+
+// NewClient returns a Client of the servers at addrs. Connections are
+// opened when needed.
+func NewClient(addrs []string, opts ...ClientOption) (*Client, error) {
+	if len(addrs) == 0 {
+		return nil, errors.New("no server address")
+	}
+
+	o := clientOptions{poolSize: defaultPoolSize, dialTimeout: defaultDialTimeout}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	servers := make([]*server, len(addrs))
+	for i, addr := range addrs {
+		servers[i] = &server{
+			addr: addr,
+			opts: o,
+			sem:  make(chan struct{}, o.poolSize),
+			idle: make(chan *conn, o.poolSize),
+		}
+	}
+	return &Client{servers: servers, ring: ring.New(addrs, ring.DefaultReplicas)}, nil
+}
+
+// Get returns the items of the keys found, read with get.
+func (c *Client) Get(ctx context.Context, keys ...string) (map[string]*Item, error) {
+	return c.retrieve(ctx, "get", keys)
+}
+
+// Gets returns the items of the keys found, read with gets, so that their
+// CAS value is set.
+func (c *Client) Gets(ctx context.Context, keys ...string) (map[string]*Item, error) {
+	return c.retrieve(ctx, "gets", keys)
+}
+
+func (c *Client) retrieve(ctx context.Context, cmd string, keys []string) (map[string]*Item, error) {
+	items := make(map[string]*Item, len(keys))
+	var mu sync.Mutex
+
+	err := c.each(ctx, keys, func(cn *conn, keys []string) error {
+		writeRetrieval(cn.bw, cmd, keys)
+		if err := cn.bw.Flush(); err != nil {
+			return err
+		}
+		return readValues(cn.br, func(it *Item) {
+			mu.Lock()
+			items[it.Key] = it
+			mu.Unlock()
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// Set stores the items, pipelined per server. The errors of the items not
+// stored are joined.
+func (c *Client) Set(ctx context.Context, items ...*Item) error {
+	return c.store(ctx, "set", items)
+}
+
+// CompareAndSwap stores the item if it was not modified since its CAS value
+// was read by Gets. It returns ErrCASConflict if it was, and kv.ErrNotFound
+// if the item no longer exists.
+func (c *Client) CompareAndSwap(ctx context.Context, it *Item) error {
+	return c.store(ctx, "cas", []*Item{it})
+}
+
+func (c *Client) store(ctx context.Context, cmd string, items []*Item) error {
+	byKey := make(map[string]*Item, len(items))
+	keys := make([]string, 0, len(items))
+	for _, it := range items {
+		byKey[it.Key] = it
+		keys = append(keys, it.Key)
+	}
+
+	return c.each(ctx, keys, func(cn *conn, keys []string) error {
+		for _, k := range keys {
+			writeStorage(cn.bw, cmd, byKey[k])
+		}
+		if err := cn.bw.Flush(); err != nil {
+			return err
+		}
+
+		var errs []error
+		for range keys {
+			if err := readStorage(cn.br); err != nil {
+				if !isResult(err) {
+					return err
+				}
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	})
+}
+
+// Delete deletes the keys, pipelined per server. Missing keys are not an error.
+func (c *Client) Delete(ctx context.Context, keys ...string) error {
+	return c.each(ctx, keys, func(cn *conn, keys []string) error {
+		for _, k := range keys {
+			writeDelete(cn.bw, k)
+		}
+		if err := cn.bw.Flush(); err != nil {
+			return err
+		}
+		for range keys {
+			if err := readDelete(cn.br); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Close closes the idle connections. Connections in use are closed when
+// they are released.
+func (c *Client) Close() error {
+	var errs []error
+	for _, s := range c.servers {
+		errs = append(errs, s.close())
+	}
+	return errors.Join(errs...)
+}
+
+// each groups keys by server and calls fn with a connection to each server
+// and its keys, in parallel.
+func (c *Client) each(ctx context.Context, keys []string, fn func(cn *conn, keys []string) error) error {
+	groups := make(map[int][]string)
+	for _, k := range keys {
+		if !validKey(k) {
+			return ErrInvalidKey
+		}
+		i := c.ring.Get(ring.Hash(k))
+		groups[i] = append(groups[i], k)
+	}
+
+	if len(groups) == 1 {
+		for i, keys := range groups {
+			return c.servers[i].do(ctx, keys, fn)
+		}
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for i, keys := range groups {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := c.servers[i].do(ctx, keys, fn); err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// isResult reports whether err is the result of a command rather than a
+// failure, and leaves the connection usable. After an ERROR or CLIENT_ERROR,
+// the server may have misread the rest of the pipeline.
+func isResult(err error) bool {
+	var serverErr ServerError
+	if errors.As(err, &serverErr) {
+		return strings.HasPrefix(string(serverErr), "SERVER_ERROR")
+	}
+	return errors.Is(err, ErrNotStored) || errors.Is(err, ErrCASConflict) || errors.Is(err, kv.ErrNotFound)
+}
+
+// server is a memcached server and its connection pool.
+type server struct {
+	addr string
+	opts clientOptions
+
+	// sem holds a token for every open connection.
+	sem chan struct{}
+
+	// idle holds the connections not in use.
+	idle chan *conn
+
+	mu     sync.Mutex
+	closed bool
+}
+
+type conn struct {
+	net.Conn
+	br *bufio.Reader
+	bw *bufio.Writer
+}
+
+// do calls fn with a connection to s. The deadline of ctx applies to the
+// connection, and canceling ctx interrupts the IO.
+func (s *server) do(ctx context.Context, keys []string, fn func(cn *conn, keys []string) error) error {
+	cn, err := s.get(ctx)
+	if err != nil {
+		return err
+	}
+
+	deadline, _ := ctx.Deadline()
+	if err = cn.SetDeadline(deadline); err != nil {
+		s.put(cn, true)
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() {
+		_ = cn.SetDeadline(time.Unix(1, 0))
+	})
+	err = fn(cn, keys)
+	// Once started, the interruption may run after the exchange succeeded,
+	// failing the next one.
+	interrupted := !stop()
+
+	// The replies of a failed exchange may still be on the wire.
+	s.put(cn, interrupted || err != nil && !isResult(err))
+	if err != nil {
+		return contextErr(ctx, err)
+	}
+	return nil
+}
+
+// contextErr returns the error of ctx if it interrupted the IO. The IO may
+// time out at the deadline of ctx just before ctx is done.
+func contextErr(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	if deadline, ok := ctx.Deadline(); ok && errors.Is(err, os.ErrDeadlineExceeded) && !time.Now().Before(deadline) {
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+// get returns an idle connection, or opens one if the pool is not full,
+// or waits for one to be released.
+func (s *server) get(ctx context.Context) (*conn, error) {
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+	if closed {
+		return nil, ErrClosed
+	}
+
+	select {
+	case cn := <-s.idle:
+		return cn, nil
+	default:
+	}
+
+	select {
+	case cn := <-s.idle:
+		return cn, nil
+	case s.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	d := net.Dialer{Timeout: s.opts.dialTimeout}
+	nc, err := d.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		<-s.sem
+		return nil, err
+	}
+	return &conn{Conn: nc, br: bufio.NewReader(nc), bw: bufio.NewWriter(nc)}, nil
+}
+
+// put returns cn to the pool, or closes it if it is broken.
+func (s *server) put(cn *conn, broken bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if broken || s.closed {
+		_ = cn.Close()
+		<-s.sem
+		return
+	}
+	// Never blocks: there are no more connections than tokens.
+	s.idle <- cn
+}
+
+func (s *server) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	var errs []error
+	for {
+		select {
+		case cn := <-s.idle:
+			errs = append(errs, cn.Close())
+			<-s.sem
+		default:
+			return errors.Join(errs...)
+		}
+	}
+}
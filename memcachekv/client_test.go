@@ -0,0 +1,87 @@
+package memcachekv
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// silentServer accepts connections and never replies.
+func silentServer(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var conns []net.Conn
+	t.Cleanup(func() {
+		_ = ln.Close()
+		mu.Lock()
+		for _, c := range conns {
+			_ = c.Close()
+		}
+		mu.Unlock()
+		wg.Wait()
+	})
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, c)
+			mu.Unlock()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// lateCtx is a context at its deadline but not done yet, as when its
+// timer has not fired.
+type lateCtx struct {
+	context.Context
+	deadline time.Time
+}
+
+func (c lateCtx) Deadline() (time.Time, bool) { return c.deadline, true }
+
+func TestClient_DeadlineExceeded(t *testing.T) {
+	c := newClient(t, []string{silentServer(t)})
+
+	// The read times out at the deadline, before ctx is done.
+	ctx := lateCtx{Context: context.Background(), deadline: time.Now().Add(20 * time.Millisecond)}
+	_, err := c.Get(ctx, "k")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.NoError(t, ctx.Err())
+}
+
+func TestServer_Interrupted(t *testing.T) {
+	client, peer := net.Pipe()
+	defer peer.Close()
+
+	s := &server{sem: make(chan struct{}, 1), idle: make(chan *conn, 1)}
+	s.sem <- struct{}{}
+	s.idle <- &conn{Conn: client}
+
+	// The exchange succeeds after ctx ended.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.NoError(t, s.do(ctx, nil, func(*conn, []string) error { return nil }))
+
+	// A past deadline may still be set: the connection is closed.
+	assert.Empty(t, s.idle)
+	assert.Empty(t, s.sem)
+	_, err := client.Write([]byte("x"))
+	require.ErrorIs(t, err, io.ErrClosedPipe)
+}
@@ -0,0 +1,129 @@
+// Package memcachekv implements kv.KV and kv.BatchKV on memcached, with a
+// text protocol client and no dependency.
+package memcachekv
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	kv "github.com/chenyanchen/kv"
+)
+
+// Option configures the stores.
+type Option func(*options)
+
+type options struct {
+	ttl time.Duration
+}
+
+// WithTTL returns an Option that sets the expiration of every write.
+// Memcached expires items with a resolution of one second.
+func WithTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.ttl = ttl
+	}
+}
+
+func newOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+type memcacheKV struct {
+	client *Client
+	opts   options
+}
+
+// New returns a kv.KV on the memcached servers of client.
+func New(client *Client, opts ...Option) (*memcacheKV, error) {
+	if client == nil {
+		return nil, errors.New("client is nil")
+	}
+	return &memcacheKV{client: client, opts: newOptions(opts)}, nil
+}
+
+func (s *memcacheKV) Get(ctx context.Context, k string) ([]byte, error) {
+	items, err := s.client.Get(ctx, k)
+	if err != nil {
+		return nil, err
+	}
+	it, ok := items[k]
+	if !ok {
+		return nil, kv.ErrNotFound
+	}
+	return it.Value, nil
+}
+
+func (s *memcacheKV) Set(ctx context.Context, k string, v []byte) error {
+	return s.client.Set(ctx, &Item{Key: k, Value: v, Expiration: s.opts.ttl})
+}
+
+func (s *memcacheKV) Del(ctx context.Context, k string) error {
+	return s.client.Delete(ctx, k)
+}
+
+// Gets returns the value of k and its CAS value, for CompareAndSwap.
+func (s *memcacheKV) Gets(ctx context.Context, k string) ([]byte, uint64, error) {
+	items, err := s.client.Gets(ctx, k)
+	if err != nil {
+		return nil, 0, err
+	}
+	it, ok := items[k]
+	if !ok {
+		return nil, 0, kv.ErrNotFound
+	}
+	return it.Value, it.CAS, nil
+}
+
+// CompareAndSwap sets the value of k if it was not modified since cas was
+// read by Gets. It returns ErrCASConflict if it was, and kv.ErrNotFound if
+// k no longer exists.
+func (s *memcacheKV) CompareAndSwap(ctx context.Context, k string, v []byte, cas uint64) error {
+	return s.client.CompareAndSwap(ctx, &Item{Key: k, Value: v, Expiration: s.opts.ttl, CAS: cas})
+}
+
+type batchKV struct {
+	client *Client
+	opts   options
+}
+
+// NewBatch returns a kv.BatchKV on the memcached servers of client. The
+// keys of a batch are grouped by server, and the servers are called in parallel.
+func NewBatch(client *Client, opts ...Option) (*batchKV, error) {
+	if client == nil {
+		return nil, errors.New("client is nil")
+	}
+	return &batchKV{client: client, opts: newOptions(opts)}, nil
+}
+
+// Get reads the keys with a multi-key get per server; missing keys are
+// left out of the result.
+func (b *batchKV) Get(ctx context.Context, keys []string) (map[string][]byte, error) {
+	items, err := b.client.Get(ctx, keys...)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string][]byte, len(items))
+	for k, it := range items {
+		result[k] = it.Value
+	}
+	return result, nil
+}
+
+// Set pipelines the writes per server. It is not atomic: on error, some of
+// the pairs may have been written.
+func (b *batchKV) Set(ctx context.Context, kvs map[string][]byte) error {
+	items := make([]*Item, 0, len(kvs))
+	for k, v := range kvs {
+		items = append(items, &Item{Key: k, Value: v, Expiration: b.opts.ttl})
+	}
+	return b.client.Set(ctx, items...)
+}
+
+func (b *batchKV) Del(ctx context.Context, keys []string) error {
+	return b.client.Delete(ctx, keys...)
+}
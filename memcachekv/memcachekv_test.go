@@ -0,0 +1,139 @@
+package memcachekv
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	kv "github.com/chenyanchen/kv"
+)
+
+func newClient(t *testing.T, addrs []string, opts ...ClientOption) *Client {
+	t.Helper()
+	c, err := NewClient(addrs, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func TestMemcacheKV(t *testing.T) {
+	ctx := context.Background()
+	srv := newFakeServer(t)
+
+	s, err := New(newClient(t, []string{srv.addr}))
+	require.NoError(t, err)
+
+	_, err = s.Get(ctx, "a")
+	require.ErrorIs(t, err, kv.ErrNotFound)
+
+	require.NoError(t, s.Set(ctx, "a", []byte("1")))
+	require.NoError(t, s.Set(ctx, "b", []byte{}))
+
+	v, err := s.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("1"), v)
+
+	v, err = s.Get(ctx, "b")
+	require.NoError(t, err, "an empty value is not a missing one")
+	assert.Empty(t, v)
+
+	require.NoError(t, s.Del(ctx, "a"))
+	require.NoError(t, s.Del(ctx, "a"))
+	_, err = s.Get(ctx, "a")
+	require.ErrorIs(t, err, kv.ErrNotFound)
+
+	for _, k := range []string{"", "with space", "new\nline", strings.Repeat("k", 251)} {
+		require.ErrorIs(t, s.Set(ctx, k, nil), ErrInvalidKey, k)
+	}
+
+	_, err = New(nil)
+	require.Error(t, err)
+}
+
+func TestMemcacheKV_CompareAndSwap(t *testing.T) {
+	ctx := context.Background()
+	srv := newFakeServer(t)
+
+	s, err := New(newClient(t, []string{srv.addr}))
+	require.NoError(t, err)
+
+	_, _, err = s.Gets(ctx, "a")
+	require.ErrorIs(t, err, kv.ErrNotFound)
+	require.ErrorIs(t, s.CompareAndSwap(ctx, "a", []byte("1"), 1), kv.ErrNotFound)
+
+	require.NoError(t, s.Set(ctx, "a", []byte("1")))
+	v, cas, err := s.Gets(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("1"), v)
+
+	require.NoError(t, s.CompareAndSwap(ctx, "a", []byte("2"), cas))
+	require.ErrorIs(t, s.CompareAndSwap(ctx, "a", []byte("3"), cas), ErrCASConflict)
+
+	v, err = s.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("2"), v)
+	assert.Equal(t, int32(1), srv.conns.Load(), "conflicts leave the connection usable")
+}
+
+func TestMemcacheKV_TTL(t *testing.T) {
+	ctx := context.Background()
+	srv := newFakeServer(t)
+
+	assert.Equal(t, int64(1), exptime(time.Millisecond))
+	assert.Greater(t, exptime(60*24*time.Hour), time.Now().Unix(), "long expirations are absolute")
+
+	s, err := New(newClient(t, []string{srv.addr}), WithTTL(time.Second))
+	require.NoError(t, err)
+
+	require.NoError(t, s.Set(ctx, "a", []byte("1")))
+	_, err = s.Get(ctx, "a")
+	require.NoError(t, err)
+
+	time.Sleep(1100 * time.Millisecond)
+	_, err = s.Get(ctx, "a")
+	require.ErrorIs(t, err, kv.ErrNotFound)
+}
+
+func TestBatchKV(t *testing.T) {
+	ctx := context.Background()
+	servers := []*fakeServer{newFakeServer(t), newFakeServer(t), newFakeServer(t)}
+	addrs := make([]string, len(servers))
+	for i, srv := range servers {
+		addrs[i] = srv.addr
+	}
+
+	b, err := NewBatch(newClient(t, addrs))
+	require.NoError(t, err)
+
+	kvs := make(map[string][]byte)
+	keys := make([]string, 0, 300)
+	for i := range 300 {
+		k := fmt.Sprint("key", i)
+		kvs[k] = []byte(fmt.Sprint("value", i))
+		keys = append(keys, k)
+	}
+	require.NoError(t, b.Set(ctx, kvs))
+
+	for _, srv := range servers {
+		assert.Greater(t, srv.len(), 50, "keys are spread across the servers")
+		assert.Equal(t, int32(1), srv.conns.Load(), "a batch uses one connection per server")
+	}
+
+	got, err := b.Get(ctx, append(keys, "missing"))
+	require.NoError(t, err)
+	assert.Equal(t, kvs, got)
+
+	require.NoError(t, b.Del(ctx, keys[:150]))
+	got, err = b.Get(ctx, keys)
+	require.NoError(t, err)
+	assert.Len(t, got, 150)
+
+	got, err = b.Get(ctx, nil)
+	require.NoError(t, err)
+	assert.Empty(t, got)
+}
@@ -0,0 +1,210 @@
+package memcachekv
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	kv "github.com/chenyanchen/kv"
+)
+
+const (
+	// maxKeyLen is the longest key the protocol accepts.
+	maxKeyLen = 250
+
+	// maxValueLen bounds the values read, as the largest item size memcached
+	// can be configured with.
+	maxValueLen = 1 << 30
+)
+
+// maxRelativeExptime is the longest expiration sent in seconds; longer ones
+// must be sent as a Unix time.
+const maxRelativeExptime = 30 * 24 * time.Hour
+
+var (
+	// ErrInvalidKey is returned for a key longer than 250 bytes, or with
+	// whitespace or control characters, which the protocol does not allow.
+	ErrInvalidKey = errors.New("invalid key")
+
+	// ErrCASConflict is returned by a compare-and-swap when the item was
+	// modified since it was read.
+	ErrCASConflict = errors.New("cas conflict")
+
+	// ErrNotStored is returned when the server did not store an item.
+	ErrNotStored = errors.New("not stored")
+
+	errProtocol = errors.New("memcache protocol error")
+)
+
+// ServerError is an ERROR, CLIENT_ERROR or SERVER_ERROR reply.
+type ServerError string
+
+func (e ServerError) Error() string { return string(e) }
+
+// Item is an item stored in memcached.
+type Item struct {
+	Key   string
+	Value []byte
+	Flags uint32
+
+	// Expiration is the time to live of the item, zero for none.
+	Expiration time.Duration
+
+	// CAS is the unique value of the item, as read by Gets, for CompareAndSwap.
+	CAS uint64
+}
+
+func validKey(k string) bool {
+	if len(k) == 0 || len(k) > maxKeyLen {
+		return false
+	}
+	for i := range len(k) {
+		if k[i] <= ' ' || k[i] == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// exptime returns the protocol expiration of ttl.
+func exptime(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+	if ttl > maxRelativeExptime {
+		return time.Now().Add(ttl).Unix()
+	}
+	// Round up: a zero exptime would never expire.
+	return int64((ttl + time.Second - 1) / time.Second)
+}
+
+// The write functions ignore errors: they are kept by the bufio.Writer and
+// returned by Flush.
+
+// writeRetrieval writes a get or gets command of keys.
+func writeRetrieval(w *bufio.Writer, cmd string, keys []string) {
+	_, _ = w.WriteString(cmd)
+	for _, k := range keys {
+		_ = w.WriteByte(' ')
+		_, _ = w.WriteString(k)
+	}
+	_, _ = w.WriteString("\r\n")
+}
+
+// readValues reads the VALUE lines of a retrieval up to END.
+func readValues(r *bufio.Reader, fn func(it *Item)) error {
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			return err
+		}
+		if line == "END" {
+			return nil
+		}
+
+		// VALUE <key> <flags> <bytes> [<cas unique>]
+		fields := strings.Fields(line)
+		if len(fields) < 4 || len(fields) > 5 || fields[0] != "VALUE" {
+			return fmt.Errorf("%w: unexpected line %q", errProtocol, line)
+		}
+		flags, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			return fmt.Errorf("%w: %w", errProtocol, err)
+		}
+		size, err := strconv.Atoi(fields[3])
+		if err != nil || size < 0 || size > maxValueLen {
+			return fmt.Errorf("%w: bad size %q", errProtocol, fields[3])
+		}
+		it := &Item{Key: fields[1], Flags: uint32(flags)}
+		if len(fields) == 5 {
+			if it.CAS, err = strconv.ParseUint(fields[4], 10, 64); err != nil {
+				return fmt.Errorf("%w: %w", errProtocol, err)
+			}
+		}
+
+		data := make([]byte, size+2)
+		if _, err = io.ReadFull(r, data); err != nil {
+			return err
+		}
+		if data[size] != '\r' || data[size+1] != '\n' {
+			return fmt.Errorf("%w: value not terminated", errProtocol)
+		}
+		it.Value = data[:size]
+		fn(it)
+	}
+}
+
+// writeStorage writes a set or cas command of it.
+func writeStorage(w *bufio.Writer, cmd string, it *Item) {
+	_, _ = fmt.Fprintf(w, "%s %s %d %d %d", cmd, it.Key, it.Flags, exptime(it.Expiration), len(it.Value))
+	if cmd == "cas" {
+		_, _ = fmt.Fprintf(w, " %d", it.CAS)
+	}
+	_, _ = w.WriteString("\r\n")
+	_, _ = w.Write(it.Value)
+	_, _ = w.WriteString("\r\n")
+}
+
+// readStorage reads the reply of a storage command. A cas of a missing item
+// returns kv.ErrNotFound.
+func readStorage(r *bufio.Reader) error {
+	line, err := readLine(r)
+	if err != nil {
+		return err
+	}
+	switch line {
+	case "STORED":
+		return nil
+	case "NOT_STORED":
+		return ErrNotStored
+	case "EXISTS":
+		return ErrCASConflict
+	case "NOT_FOUND":
+		return kv.ErrNotFound
+	default:
+		return fmt.Errorf("%w: unexpected reply %q", errProtocol, line)
+	}
+}
+
+func writeDelete(w *bufio.Writer, k string) {
+	_, _ = w.WriteString("delete " + k + "\r\n")
+}
+
+// readDelete reads the reply of a delete. A missing key is not an error.
+func readDelete(r *bufio.Reader) error {
+	line, err := readLine(r)
+	if err != nil {
+		return err
+	}
+	switch line {
+	case "DELETED", "NOT_FOUND":
+		return nil
+	default:
+		return fmt.Errorf("%w: unexpected reply %q", errProtocol, line)
+	}
+}
+
+// readLine reads a line terminated by CRLF, without the terminator. Error
+// replies are returned as ServerError.
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return "", fmt.Errorf("%w: line too long", errProtocol)
+	}
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("%w: line not terminated by CRLF", errProtocol)
+	}
+
+	s := string(line[:len(line)-2])
+	if s == "ERROR" || strings.HasPrefix(s, "CLIENT_ERROR ") || strings.HasPrefix(s, "SERVER_ERROR ") {
+		return "", ServerError(s)
+	}
+	return s, nil
+}
@@ -0,0 +1,198 @@
+package memcachekv
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeServer is an in-process server of the text protocol commands used by
+// the client.
+type fakeServer struct {
+	addr string
+
+	// conns counts the accepted connections.
+	conns atomic.Int32
+
+	mu    sync.Mutex
+	items map[string]*fakeItem
+	cas   uint64
+}
+
+type fakeItem struct {
+	value    []byte
+	flags    uint32
+	cas      uint64
+	expireAt time.Time
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &fakeServer{addr: ln.Addr().String(), items: make(map[string]*fakeItem)}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var conns []net.Conn
+	t.Cleanup(func() {
+		_ = ln.Close()
+		mu.Lock()
+		for _, c := range conns {
+			_ = c.Close()
+		}
+		mu.Unlock()
+		wg.Wait()
+	})
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.conns.Add(1)
+			mu.Lock()
+			conns = append(conns, c)
+			mu.Unlock()
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.serve(c)
+			}()
+		}
+	}()
+	return s
+}
+
+// len returns the number of items stored.
+func (s *fakeServer) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.items)
+}
+
+func (s *fakeServer) serve(c net.Conn) {
+	defer c.Close()
+
+	br := bufio.NewReader(c)
+	bw := bufio.NewWriter(c)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			_, _ = bw.WriteString("ERROR\r\n")
+		} else if err = s.exec(br, bw, fields); err != nil {
+			return
+		}
+
+		// Flush once the pipelined commands are all read.
+		if br.Buffered() == 0 {
+			if err = bw.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *fakeServer) exec(br *bufio.Reader, bw *bufio.Writer, fields []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch cmd, args := fields[0], fields[1:]; cmd {
+	case "get", "gets":
+		for _, k := range args {
+			it := s.get(k)
+			if it == nil {
+				continue
+			}
+			fmt.Fprintf(bw, "VALUE %s %d %d", k, it.flags, len(it.value))
+			if cmd == "gets" {
+				fmt.Fprintf(bw, " %d", it.cas)
+			}
+			fmt.Fprintf(bw, "\r\n%s\r\n", it.value)
+		}
+		_, _ = bw.WriteString("END\r\n")
+
+	case "set", "cas":
+		if len(args) < 4 {
+			_, _ = bw.WriteString("ERROR\r\n")
+			return nil
+		}
+		flags, _ := strconv.ParseUint(args[1], 10, 32)
+		exptime, _ := strconv.ParseInt(args[2], 10, 64)
+		size, err := strconv.Atoi(args[3])
+		if err != nil {
+			_, _ = bw.WriteString("CLIENT_ERROR bad data chunk\r\n")
+			return nil
+		}
+		data := make([]byte, size+2)
+		if _, err = io.ReadFull(br, data); err != nil {
+			return err
+		}
+
+		k := args[0]
+		if cmd == "cas" {
+			unique, _ := strconv.ParseUint(args[4], 10, 64)
+			it := s.get(k)
+			switch {
+			case it == nil:
+				_, _ = bw.WriteString("NOT_FOUND\r\n")
+				return nil
+			case it.cas != unique:
+				_, _ = bw.WriteString("EXISTS\r\n")
+				return nil
+			}
+		}
+
+		s.cas++
+		it := &fakeItem{value: data[:size], flags: uint32(flags), cas: s.cas}
+		if exptime > 0 {
+			it.expireAt = time.Now().Add(time.Duration(exptime) * time.Second)
+		}
+		s.items[k] = it
+		_, _ = bw.WriteString("STORED\r\n")
+
+	case "delete":
+		if s.get(args[0]) == nil {
+			_, _ = bw.WriteString("NOT_FOUND\r\n")
+			return nil
+		}
+		delete(s.items, args[0])
+		_, _ = bw.WriteString("DELETED\r\n")
+
+	default:
+		_, _ = bw.WriteString("ERROR\r\n")
+	}
+	return nil
+}
+
+// get returns the item of k, or nil if it is missing or expired.
+func (s *fakeServer) get(k string) *fakeItem {
+	it, ok := s.items[k]
+	if !ok {
+		return nil
+	}
+	if !it.expireAt.IsZero() && time.Now().After(it.expireAt) {
+		delete(s.items, k)
+		return nil
+	}
+	return it
+}
@@ -0,0 +1,209 @@
+// Package migratekv moves a store to a new implementation without
+// downtime, by phases switched at runtime:
+//
+//  1. PhaseWriteBoth: reads from the old store, writes to both.
+//  2. PhaseShadowRead: also reads from the new store, in the background,
+//     and reports the values that differ from the old ones.
+//  3. PhaseReadNew: reads from the new store, writes to both, so that
+//     going back to the old store is still possible.
+//  4. PhaseNewOnly: reads from and writes to the new store only.
+//
+// The store read from is the source of truth: a write fails if writing
+// to it fails, and the errors of the other store are only reported.
+package migratekv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+
+	kv "github.com/chenyanchen/kv"
+)
+
+// Phase is a phase of a migration.
+type Phase int32
+
+const (
+	PhaseWriteBoth Phase = iota
+	PhaseShadowRead
+	PhaseReadNew
+	PhaseNewOnly
+)
+
+func (p Phase) String() string {
+	switch p {
+	case PhaseWriteBoth:
+		return "write both"
+	case PhaseShadowRead:
+		return "shadow read"
+	case PhaseReadNew:
+		return "read new"
+	case PhaseNewOnly:
+		return "new only"
+	default:
+		return fmt.Sprintf("Phase(%d)", int32(p))
+	}
+}
+
+// Mismatch is a value of the new store differing from the old store.
+// A value not found is the zero value, with found false.
+type Mismatch[K comparable, V any] struct {
+	Key      K
+	Old, New V
+	OldFound bool
+	NewFound bool
+}
+
+// Option configures a migration.
+type Option[K comparable, V any] func(*options[K, V])
+
+type options[K comparable, V any] struct {
+	phase      Phase
+	equal      func(a, b V) bool
+	onMismatch func(Mismatch[K, V])
+	onError    func(error)
+}
+
+// WithPhase returns an Option that sets the phase to start with.
+// Defaults to PhaseWriteBoth.
+func WithPhase[K comparable, V any](p Phase) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.phase = p
+	}
+}
+
+// WithEqual returns an Option that sets how shadow reads compare values.
+// Defaults to reflect.DeepEqual.
+func WithEqual[K comparable, V any](equal func(a, b V) bool) Option[K, V] {
+	return func(o *options[K, V]) {
+		if equal != nil {
+			o.equal = equal
+		}
+	}
+}
+
+// WithMismatchHandler returns an Option that sets the function called
+// with the mismatches found by shadow reads.
+func WithMismatchHandler[K comparable, V any](fn func(Mismatch[K, V])) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.onMismatch = fn
+	}
+}
+
+// WithErrorHandler returns an Option that sets the function called with
+// the errors not returned: those of the store not read from, and those
+// of shadow reads.
+func WithErrorHandler[K comparable, V any](fn func(error)) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.onError = fn
+	}
+}
+
+type migrateKV[K comparable, V any] struct {
+	old, new kv.KV[K, V]
+	phase    atomic.Int32
+	opts     options[K, V]
+}
+
+// New returns a KV migrating from oldKV to newKV.
+func New[K comparable, V any](oldKV, newKV kv.KV[K, V], opts ...Option[K, V]) (*migrateKV[K, V], error) {
+	if oldKV == nil {
+		return nil, errors.New("old store is nil")
+	}
+	if newKV == nil {
+		return nil, errors.New("new store is nil")
+	}
+
+	o := options[K, V]{equal: func(a, b V) bool { return reflect.DeepEqual(a, b) }}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	m := &migrateKV[K, V]{old: oldKV, new: newKV, opts: o}
+	if err := m.SetPhase(o.phase); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Phase returns the current phase.
+func (m *migrateKV[K, V]) Phase() Phase {
+	return Phase(m.phase.Load())
+}
+
+// SetPhase switches to phase p, for the operations started after it.
+func (m *migrateKV[K, V]) SetPhase(p Phase) error {
+	if p < PhaseWriteBoth || p > PhaseNewOnly {
+		return fmt.Errorf("invalid phase %d", p)
+	}
+	m.phase.Store(int32(p))
+	return nil
+}
+
+func (m *migrateKV[K, V]) Get(ctx context.Context, k K) (V, error) {
+	phase := m.Phase()
+	if phase >= PhaseReadNew {
+		return m.new.Get(ctx, k)
+	}
+
+	v, err := m.old.Get(ctx, k)
+	if phase == PhaseShadowRead && (err == nil || errors.Is(err, kv.ErrNotFound)) {
+		go m.shadowRead(context.WithoutCancel(ctx), k, v, err == nil)
+	}
+	return v, err
+}
+
+// shadowRead reads k from the new store, and reports a mismatch with the
+// value of the old store.
+func (m *migrateKV[K, V]) shadowRead(ctx context.Context, k K, old V, oldFound bool) {
+	v, err := m.new.Get(ctx, k)
+	if err != nil && !errors.Is(err, kv.ErrNotFound) {
+		m.report(fmt.Errorf("shadow read: %w", err))
+		return
+	}
+
+	newFound := err == nil
+	if oldFound == newFound && (!oldFound || m.opts.equal(old, v)) {
+		return
+	}
+	if m.opts.onMismatch != nil {
+		m.opts.onMismatch(Mismatch[K, V]{Key: k, Old: old, New: v, OldFound: oldFound, NewFound: newFound})
+	}
+}
+
+func (m *migrateKV[K, V]) Set(ctx context.Context, k K, v V) error {
+	return m.write(func(s kv.KV[K, V]) error { return s.Set(ctx, k, v) })
+}
+
+func (m *migrateKV[K, V]) Del(ctx context.Context, k K) error {
+	return m.write(func(s kv.KV[K, V]) error { return s.Del(ctx, k) })
+}
+
+// write calls fn with the store read from, then with the other one if
+// the phase writes to both.
+func (m *migrateKV[K, V]) write(fn func(kv.KV[K, V]) error) error {
+	phase := m.Phase()
+	if phase == PhaseNewOnly {
+		return fn(m.new)
+	}
+
+	primary, secondary, name := m.old, m.new, "new"
+	if phase == PhaseReadNew {
+		primary, secondary, name = m.new, m.old, "old"
+	}
+	if err := fn(primary); err != nil {
+		return err
+	}
+	if err := fn(secondary); err != nil {
+		m.report(fmt.Errorf("write %s store: %w", name, err))
+	}
+	return nil
+}
+
+func (m *migrateKV[K, V]) report(err error) {
+	if m.opts.onError != nil {
+		m.opts.onError(err)
+	}
+}
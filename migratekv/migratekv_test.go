@@ -0,0 +1,142 @@
+package migratekv
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	kv "github.com/chenyanchen/kv"
+	"github.com/chenyanchen/kv/cachekv"
+)
+
+func TestMigrateKV(t *testing.T) {
+	ctx := context.Background()
+	oldKV := cachekv.NewRWMutex[string, int]()
+	newKV := cachekv.NewRWMutex[string, int]()
+	m, err := New[string, int](oldKV, newKV)
+	require.NoError(t, err)
+	assert.Equal(t, PhaseWriteBoth, m.Phase())
+
+	require.NoError(t, oldKV.Set(ctx, "legacy", 1))
+	require.NoError(t, m.Set(ctx, "a", 1))
+
+	// Reads from the old store, writes to both.
+	v, err := m.Get(ctx, "legacy")
+	require.NoError(t, err)
+	assert.Equal(t, 1, v)
+	v, err = newKV.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, 1, v)
+
+	require.NoError(t, m.SetPhase(PhaseReadNew))
+	_, err = m.Get(ctx, "legacy")
+	require.ErrorIs(t, err, kv.ErrNotFound, "not backfilled")
+	require.NoError(t, m.Del(ctx, "a"))
+	_, err = oldKV.Get(ctx, "a")
+	require.ErrorIs(t, err, kv.ErrNotFound, "still written to both")
+
+	require.NoError(t, m.SetPhase(PhaseNewOnly))
+	require.NoError(t, m.Set(ctx, "b", 2))
+	_, err = oldKV.Get(ctx, "b")
+	require.ErrorIs(t, err, kv.ErrNotFound)
+	v, err = m.Get(ctx, "b")
+	require.NoError(t, err)
+	assert.Equal(t, 2, v)
+
+	require.Error(t, m.SetPhase(Phase(7)))
+	assert.Equal(t, "Phase(7)", Phase(7).String())
+	assert.Equal(t, "new only", m.Phase().String())
+
+	_, err = New[string, int](nil, newKV)
+	require.Error(t, err)
+	_, err = New[string, int](oldKV, nil)
+	require.Error(t, err)
+	_, err = New[string, int](oldKV, newKV, WithPhase[string, int](-1))
+	require.Error(t, err)
+}
+
+func TestMigrateKV_ShadowRead(t *testing.T) {
+	ctx := context.Background()
+	oldKV := cachekv.NewRWMutex[string, int]()
+	newKV := cachekv.NewRWMutex[string, int]()
+
+	mismatches := make(chan Mismatch[string, int], 10)
+	m, err := New[string, int](oldKV, newKV,
+		WithPhase[string, int](PhaseShadowRead),
+		WithEqual[string, int](func(a, b int) bool { return a/10 == b/10 }),
+		WithMismatchHandler[string, int](func(mm Mismatch[string, int]) { mismatches <- mm }))
+	require.NoError(t, err)
+
+	require.NoError(t, oldKV.Set(ctx, "same", 1))
+	require.NoError(t, newKV.Set(ctx, "same", 2)) // equal by WithEqual
+	require.NoError(t, oldKV.Set(ctx, "differ", 1))
+	require.NoError(t, newKV.Set(ctx, "differ", 11))
+	require.NoError(t, oldKV.Set(ctx, "missing", 1))
+
+	for _, k := range []string{"same", "differ", "missing", "absent"} {
+		_, _ = m.Get(ctx, k)
+	}
+
+	var got []Mismatch[string, int]
+	for range 2 {
+		select {
+		case mm := <-mismatches:
+			got = append(got, mm)
+		case <-time.After(time.Second):
+			t.Fatal("no mismatch reported")
+		}
+	}
+	assert.ElementsMatch(t, []Mismatch[string, int]{
+		{Key: "differ", Old: 1, New: 11, OldFound: true, NewFound: true},
+		{Key: "missing", Old: 1, OldFound: true},
+	}, got)
+
+	select {
+	case mm := <-mismatches:
+		t.Fatalf("unexpected mismatch %+v", mm)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestMigrateKV_Errors(t *testing.T) {
+	ctx := context.Background()
+	errDown := errors.New("store down")
+	good := cachekv.NewRWMutex[string, int]()
+
+	errs := make(chan error, 10)
+	onError := WithErrorHandler[string, int](func(err error) { errs <- err })
+
+	// The new store failing does not fail the writes while reading the old one.
+	m, err := New[string, int](good, errKV{err: errDown}, onError, WithPhase[string, int](PhaseShadowRead))
+	require.NoError(t, err)
+	require.NoError(t, m.Set(ctx, "a", 1))
+	require.ErrorIs(t, <-errs, errDown)
+
+	v, err := m.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, 1, v)
+	err = <-errs
+	require.ErrorIs(t, err, errDown)
+	assert.Contains(t, err.Error(), "shadow read")
+
+	// But it does once reading the new store.
+	require.NoError(t, m.SetPhase(PhaseReadNew))
+	require.ErrorIs(t, m.Set(ctx, "a", 1), errDown)
+
+	m, err = New[string, int](errKV{err: errDown}, good, onError, WithPhase[string, int](PhaseReadNew))
+	require.NoError(t, err)
+	require.NoError(t, m.Del(ctx, "a"))
+	err = <-errs
+	require.ErrorIs(t, err, errDown)
+	assert.Contains(t, err.Error(), "old store")
+}
+
+type errKV struct{ err error }
+
+func (s errKV) Get(context.Context, string) (int, error) { return 0, s.err }
+func (s errKV) Set(context.Context, string, int) error   { return s.err }
+func (s errKV) Del(context.Context, string) error        { return s.err }
@@ -0,0 +1,226 @@
+// Package peerkv is a groupcache-style cache shared by a set of peers,
+// such as the replicas of a service.
+//
+// Each key is owned by one peer, chosen by consistent hashing, and only
+// the owner loads it from the store: the other peers get it from the
+// owner over HTTP. With a cache in front of the store of each peer, a key
+// is then loaded once for all the peers instead of once per peer. The
+// peers talk the wire protocol of httpkv.
+package peerkv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/chenyanchen/sync/singleflight"
+
+	kv "github.com/chenyanchen/kv"
+	"github.com/chenyanchen/kv/httpkv"
+	"github.com/chenyanchen/kv/internal/ring"
+)
+
+// Option configures a peerKV.
+type Option[K comparable, V any] func(*options[K, V])
+
+type options[K comparable, V any] struct {
+	peers    []string
+	replicas int
+	hot      kv.KV[K, V]
+	httpOpts []httpkv.Option[K, V]
+}
+
+// WithPeers returns an Option that sets the base URLs of the peers, self
+// included. Every peer must be given the same URLs, in any order.
+// Defaults to self alone.
+func WithPeers[K comparable, V any](urls ...string) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.peers = append(o.peers, urls...)
+	}
+}
+
+// WithReplicas returns an Option that sets the number of points of each
+// peer on the hash ring. More points spread the keys more evenly.
+// Defaults to 160.
+func WithReplicas[K comparable, V any](n int) Option[K, V] {
+	return func(o *options[K, V]) {
+		if n > 0 {
+			o.replicas = n
+		}
+	}
+}
+
+// WithHotCache returns an Option that keeps the values got from other
+// peers in cache, so that hot keys are served locally. Writes through
+// other peers do not reach this cache, so it should be small and expire
+// its values soon, e.g. a cachekv LRU with a TTL.
+func WithHotCache[K comparable, V any](cache kv.KV[K, V]) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.hot = cache
+	}
+}
+
+// WithHTTPOptions returns an Option that configures the handler serving
+// the peers and the clients of the other peers, e.g. with httpkv.WithKeys
+// or httpkv.WithCodec.
+func WithHTTPOptions[K comparable, V any](opts ...httpkv.Option[K, V]) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.httpOpts = append(o.httpOpts, opts...)
+	}
+}
+
+type peerKV[K comparable, V any] struct {
+	store   kv.KV[K, V]
+	hot     kv.KV[K, V]
+	ring    ring.Ring
+	names   []string
+	peers   map[string]kv.KV[K, V]
+	handler http.Handler
+
+	// formatKey formats the keys as on the wire, to hash them.
+	formatKey func(K) string
+
+	loads   singleflight.Group[K, V]
+	fetches singleflight.Group[K, V]
+}
+
+// New returns a KV of the store shared with the peers, which is served to
+// them at the base URL self: the returned value is an http.Handler to be
+// mounted there.
+//
+// Gets of the keys owned by self load from the store, once for concurrent
+// gets of a key; those of the other keys go to their owner, or to the
+// store if the owner cannot be reached. Sets and deletes go to the owner.
+func New[K comparable, V any](self string, store kv.KV[K, V], opts ...Option[K, V]) (*peerKV[K, V], error) {
+	if store == nil {
+		return nil, errors.New("store is nil")
+	}
+
+	o := options[K, V]{replicas: ring.DefaultReplicas}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	self = strings.TrimSuffix(self, "/")
+	peers := []string{self}
+	for _, peer := range o.peers {
+		peers = append(peers, strings.TrimSuffix(peer, "/"))
+	}
+	slices.Sort(peers)
+	peers = slices.Compact(peers)
+
+	p := &peerKV[K, V]{
+		store:     store,
+		hot:       o.hot,
+		ring:      ring.New(peers, o.replicas),
+		names:     peers,
+		formatKey: httpkv.KeyFormatter(o.httpOpts...),
+		peers:     make(map[string]kv.KV[K, V], len(peers)-1),
+	}
+	for _, peer := range peers {
+		if peer == self {
+			continue
+		}
+		c, err := httpkv.NewClient(peer, o.httpOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("peer %q: %w", peer, err)
+		}
+		p.peers[peer] = c
+	}
+
+	h, err := httpkv.NewHandler[K, V](owner[K, V]{p}, o.httpOpts...)
+	if err != nil {
+		return nil, err
+	}
+	p.handler = h
+
+	return p, nil
+}
+
+// ServeHTTP serves the requests of the other peers, for the keys they
+// think are owned by self. They are served from the store even if self
+// disagrees, so that requests never bounce between peers.
+func (p *peerKV[K, V]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.handler.ServeHTTP(w, r)
+}
+
+// ownerOf returns the client of the owner of k, or nil if self owns k.
+// It hashes k as formatted on the wire, which every peer formats alike.
+func (p *peerKV[K, V]) ownerOf(k K) kv.KV[K, V] {
+	return p.peers[p.names[p.ring.Get(ring.Hash(p.formatKey(k)))]]
+}
+
+func (p *peerKV[K, V]) Get(ctx context.Context, k K) (V, error) {
+	peer := p.ownerOf(k)
+	if peer == nil {
+		return p.load(ctx, k)
+	}
+
+	if p.hot != nil {
+		if v, err := p.hot.Get(ctx, k); err == nil {
+			return v, nil
+		}
+	}
+
+	v, err, _ := p.fetches.Do(k, func() (V, error) { return peer.Get(ctx, k) })
+	if err == nil {
+		if p.hot != nil {
+			_ = p.hot.Set(ctx, k, v)
+		}
+		return v, nil
+	}
+	if errors.Is(err, kv.ErrNotFound) || ctx.Err() != nil {
+		return v, err
+	}
+
+	// The owner is down, or failing: load the key rather than failing.
+	return p.load(ctx, k)
+}
+
+func (p *peerKV[K, V]) load(ctx context.Context, k K) (V, error) {
+	v, err, _ := p.loads.Do(k, func() (V, error) { return p.store.Get(ctx, k) })
+	return v, err
+}
+
+func (p *peerKV[K, V]) Set(ctx context.Context, k K, v V) error {
+	peer := p.ownerOf(k)
+	if peer == nil {
+		return p.store.Set(ctx, k, v)
+	}
+	if err := peer.Set(ctx, k, v); err != nil {
+		return err
+	}
+	return p.dropHot(ctx, k)
+}
+
+func (p *peerKV[K, V]) Del(ctx context.Context, k K) error {
+	peer := p.ownerOf(k)
+	if peer == nil {
+		return p.store.Del(ctx, k)
+	}
+	if err := peer.Del(ctx, k); err != nil {
+		return err
+	}
+	return p.dropHot(ctx, k)
+}
+
+func (p *peerKV[K, V]) dropHot(ctx context.Context, k K) error {
+	if p.hot == nil {
+		return nil
+	}
+	return p.hot.Del(ctx, k)
+}
+
+// owner is the KV served to the other peers.
+type owner[K comparable, V any] struct {
+	p *peerKV[K, V]
+}
+
+func (o owner[K, V]) Get(ctx context.Context, k K) (V, error) { return o.p.load(ctx, k) }
+
+func (o owner[K, V]) Set(ctx context.Context, k K, v V) error { return o.p.store.Set(ctx, k, v) }
+
+func (o owner[K, V]) Del(ctx context.Context, k K) error { return o.p.store.Del(ctx, k) }
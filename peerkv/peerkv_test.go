@@ -0,0 +1,254 @@
+package peerkv
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	kv "github.com/chenyanchen/kv"
+	"github.com/chenyanchen/kv/cachekv"
+	"github.com/chenyanchen/kv/httpkv"
+	"github.com/chenyanchen/kv/layerkv"
+)
+
+// countingKV is the database shared by the peers, counting its loads.
+type countingKV struct {
+	kv.KV[string, int]
+	loads sync.Map // key -> *atomic.Int32
+}
+
+func (c *countingKV) Get(ctx context.Context, k string) (int, error) {
+	n, _ := c.loads.LoadOrStore(k, new(atomic.Int32))
+	n.(*atomic.Int32).Add(1)
+	time.Sleep(time.Millisecond) // let concurrent gets pile up
+	return c.KV.Get(ctx, k)
+}
+
+func (c *countingKV) count(k string) int32 {
+	n, ok := c.loads.Load(k)
+	if !ok {
+		return 0
+	}
+	return n.(*atomic.Int32).Load()
+}
+
+type cluster struct {
+	db      *countingKV
+	servers []*httptest.Server
+	peers   []*peerKV[string, int]
+	caches  []kv.KV[string, int]
+}
+
+// newCluster starts n peers on localhost, each caching the database in an LRU.
+func newCluster(t *testing.T, n int, opts ...Option[string, int]) *cluster {
+	t.Helper()
+	c := &cluster{db: &countingKV{KV: cachekv.NewRWMutex[string, int]()}}
+
+	// The URLs of the peers are needed before the peers.
+	handlers := make([]http.Handler, n)
+	urls := make([]string, n)
+	for i := range n {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handlers[i].ServeHTTP(w, r)
+		}))
+		t.Cleanup(srv.Close)
+		c.servers = append(c.servers, srv)
+		urls[i] = srv.URL + "/_peer/"
+	}
+
+	for i := range n {
+		cache, err := cachekv.NewLRU[string, int](100, nil, 0)
+		require.NoError(t, err)
+		store, err := layerkv.New[string, int](cache, c.db)
+		require.NoError(t, err)
+
+		p, err := New[string, int](urls[i], store, append([]Option[string, int]{WithPeers[string, int](urls...)}, opts...)...)
+		require.NoError(t, err)
+		handlers[i] = http.StripPrefix("/_peer", p)
+		c.peers = append(c.peers, p)
+		c.caches = append(c.caches, cache)
+	}
+	return c
+}
+
+func TestPeerKV(t *testing.T) {
+	ctx := context.Background()
+	c := newCluster(t, 3)
+
+	const keys = 30
+	for i := range keys {
+		require.NoError(t, c.db.KV.Set(ctx, fmt.Sprint("k", i), i))
+	}
+
+	// Every peer gets every key, concurrently.
+	var wg sync.WaitGroup
+	for _, p := range c.peers {
+		for i := range keys {
+			for range 3 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					v, err := p.Get(ctx, fmt.Sprint("k", i))
+					assert.NoError(t, err)
+					assert.Equal(t, i, v)
+				}()
+			}
+		}
+	}
+	wg.Wait()
+
+	owned := make([]int, len(c.peers))
+	for i := range keys {
+		k := fmt.Sprint("k", i)
+		assert.Equal(t, int32(1), c.db.count(k), "%s is loaded once for all the peers", k)
+
+		// Only the owner caches the key.
+		cached := 0
+		for j, cache := range c.caches {
+			if _, err := cache.Get(ctx, k); err == nil {
+				cached++
+				owned[j]++
+			}
+		}
+		assert.Equal(t, 1, cached, k)
+	}
+	for i, n := range owned {
+		assert.NotZero(t, n, "peer %d owns keys", i)
+	}
+
+	_, err := c.peers[0].Get(ctx, "missing")
+	require.ErrorIs(t, err, kv.ErrNotFound)
+
+	_, err = New[string, int]("http://localhost", nil)
+	require.Error(t, err)
+	_, err = New[string, int]("http://localhost", c.db, WithPeers[string, int]("ftp://peer"))
+	require.Error(t, err)
+}
+
+func TestPeerKV_Writes(t *testing.T) {
+	ctx := context.Background()
+	c := newCluster(t, 3)
+
+	for i := range 10 {
+		k := fmt.Sprint("k", i)
+		require.NoError(t, c.peers[i%3].Set(ctx, k, i))
+
+		for _, p := range c.peers {
+			v, err := p.Get(ctx, k)
+			require.NoError(t, err)
+			assert.Equal(t, i, v)
+		}
+
+		// A write through any peer invalidates the cache of the owner.
+		require.NoError(t, c.peers[(i+1)%3].Set(ctx, k, -i))
+		v, err := c.peers[(i+2)%3].Get(ctx, k)
+		require.NoError(t, err)
+		assert.Equal(t, -i, v)
+
+		require.NoError(t, c.peers[i%3].Del(ctx, k))
+		_, err = c.peers[(i+1)%3].Get(ctx, k)
+		require.ErrorIs(t, err, kv.ErrNotFound)
+	}
+}
+
+// tenantKey is a key whose String is not unique.
+type tenantKey struct{ tenant, id int }
+
+func (k tenantKey) String() string { return fmt.Sprint("tenant ", k.tenant) }
+
+func TestPeerKV_Owner(t *testing.T) {
+	// Keys are owned as formatted on the wire, not as printed.
+	format := func(k tenantKey) string { return fmt.Sprintf("%d/%d", k.tenant, k.id) }
+	parse := func(s string) (tenantKey, error) {
+		var k tenantKey
+		_, err := fmt.Sscanf(s, "%d/%d", &k.tenant, &k.id)
+		return k, err
+	}
+	urls := []string{"http://a", "http://b", "http://c"}
+	peers := make([]*peerKV[tenantKey, int], len(urls))
+	for i, url := range urls {
+		p, err := New(url, kv.KV[tenantKey, int](cachekv.NewRWMutex[tenantKey, int]()),
+			WithPeers[tenantKey, int](urls...),
+			WithHTTPOptions(httpkv.WithKeys[tenantKey, int](parse, format)))
+		require.NoError(t, err)
+		peers[i] = p
+	}
+
+	owned := make([]int, len(peers))
+	for id := range 300 {
+		k := tenantKey{tenant: 1, id: id}
+		owners := 0
+		for i, p := range peers {
+			if p.ownerOf(k) == nil {
+				owned[i]++
+				owners++
+			}
+		}
+		assert.Equal(t, 1, owners, "%v is owned by one peer", k)
+	}
+	for i, n := range owned {
+		assert.NotZero(t, n, "peer %d owns keys", i)
+	}
+}
+
+func TestPeerKV_HotCache(t *testing.T) {
+	ctx := context.Background()
+	hot, err := cachekv.NewLRU[string, int](10, nil, time.Minute)
+	require.NoError(t, err)
+
+	c := newCluster(t, 2, WithHotCache[string, int](hot))
+
+	k := keyOwnedBy(t, c, 1)
+	require.NoError(t, c.db.KV.Set(ctx, k, 1))
+
+	v, err := c.peers[0].Get(ctx, k)
+	require.NoError(t, err)
+	assert.Equal(t, 1, v)
+
+	v, err = hot.Get(ctx, k)
+	require.NoError(t, err, "the value of the other peer is kept")
+	assert.Equal(t, 1, v)
+
+	// Served from the hot cache with the owner gone.
+	c.servers[1].Close()
+	v, err = c.peers[0].Get(ctx, k)
+	require.NoError(t, err)
+	assert.Equal(t, 1, v)
+	assert.Equal(t, int32(1), c.db.count(k))
+}
+
+func TestPeerKV_OwnerDown(t *testing.T) {
+	ctx := context.Background()
+	c := newCluster(t, 2)
+
+	k := keyOwnedBy(t, c, 1)
+	require.NoError(t, c.db.KV.Set(ctx, k, 1))
+	c.servers[1].Close()
+
+	v, err := c.peers[0].Get(ctx, k)
+	require.NoError(t, err, "loaded from the store")
+	assert.Equal(t, 1, v)
+
+	require.Error(t, c.peers[0].Set(ctx, k, 2), "writes need the owner")
+}
+
+// keyOwnedBy returns a key owned by the i-th peer of c.
+func keyOwnedBy(t *testing.T, c *cluster, i int) string {
+	t.Helper()
+	for n := range 1000 {
+		k := fmt.Sprint("key", n)
+		if c.peers[i].ownerOf(k) == nil {
+			return k
+		}
+	}
+	t.Fatal("no key owned by the peer")
+	return ""
+}
@@ -0,0 +1,155 @@
+package quorumkv
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	kv "github.com/chenyanchen/kv"
+)
+
+type batchKV[K comparable, V any] struct {
+	replicas []kv.BatchKV[K, V]
+	opts     options[V]
+}
+
+// NewBatch returns a BatchKV replicated over replicas, see New. The
+// quorum of a write is that of the whole batch, and the quorum of a read
+// is reached key by key.
+func NewBatch[K comparable, V any](replicas []kv.BatchKV[K, V], opts ...Option[K, V]) (*batchKV[K, V], error) {
+	if slices.Contains(replicas, nil) {
+		return nil, errors.New("replica is nil")
+	}
+	o, err := newOptions(len(replicas), opts)
+	if err != nil {
+		return nil, err
+	}
+	return &batchKV[K, V]{replicas: slices.Clone(replicas), opts: o}, nil
+}
+
+type batchAnswer[K comparable, V any] struct {
+	replica int
+	values  map[K]V
+	err     error
+}
+
+// Get returns the values of the keys found; missing keys are left out of the result.
+func (b *batchKV[K, V]) Get(ctx context.Context, keys []K) (map[K]V, error) {
+	if len(keys) == 0 {
+		return map[K]V{}, nil
+	}
+
+	answers := make(chan batchAnswer[K, V], len(b.replicas))
+	for i, replica := range b.replicas {
+		go func() {
+			values, err := replica.Get(ctx, keys)
+			answers <- batchAnswer[K, V]{replica: i, values: values, err: err}
+		}()
+	}
+
+	tallies := make(map[K]*tally[V], len(keys))
+	for _, k := range keys {
+		tallies[k] = &tally[V]{}
+	}
+	quorums := make(map[K]class[V], len(keys))
+	var failed []*ReplicaError
+
+	for received := 1; received <= len(b.replicas); received++ {
+		a := <-answers
+		if a.err != nil {
+			failed = append(failed, &ReplicaError{Replica: a.replica, Err: a.err})
+		}
+
+		left := len(b.replicas) - received
+		for k, t := range tallies {
+			if _, ok := quorums[k]; ok {
+				continue
+			}
+			if a.err == nil {
+				v, found := a.values[k]
+				if c := t.add(a.replica, v, found, b.opts.equal); len(c.replicas) == b.opts.r {
+					quorums[k] = *c
+					continue
+				}
+			}
+			if left+t.max() < b.opts.r {
+				return nil, newQuorumError("get", b.opts.r, failed)
+			}
+		}
+
+		if len(quorums) == len(tallies) {
+			if b.opts.readRepair {
+				go b.repair(ctx, tallies, quorums, answers, left)
+			}
+
+			result := make(map[K]V, len(quorums))
+			for k, c := range quorums {
+				if c.found {
+					result[k] = c.v
+				}
+			}
+			return result, nil
+		}
+	}
+
+	// Unreachable: the quorum of every key is reached or known to be out
+	// of reach once all the replicas answered.
+	return nil, newQuorumError("get", b.opts.r, failed)
+}
+
+// repair waits for the answers left, and repairs the replicas disagreeing
+// with the quorums, with a batch per replica.
+func (b *batchKV[K, V]) repair(ctx context.Context, tallies map[K]*tally[V], quorums map[K]class[V], answers <-chan batchAnswer[K, V], left int) {
+	for range left {
+		a := <-answers
+		if a.err != nil {
+			continue
+		}
+		for k, t := range tallies {
+			v, found := a.values[k]
+			t.add(a.replica, v, found, b.opts.equal)
+		}
+	}
+
+	sets := make(map[int]map[K]V)
+	dels := make(map[int][]K)
+	for k, t := range tallies {
+		c := quorums[k]
+		for _, i := range t.disagreeing(c, b.opts.equal) {
+			if !c.found {
+				dels[i] = append(dels[i], k)
+				continue
+			}
+			if sets[i] == nil {
+				sets[i] = make(map[K]V)
+			}
+			sets[i][k] = c.v
+		}
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	for i, kvs := range sets {
+		_ = b.replicas[i].Set(ctx, kvs)
+	}
+	for i, keys := range dels {
+		_ = b.replicas[i].Del(ctx, keys)
+	}
+}
+
+func (b *batchKV[K, V]) Set(ctx context.Context, kvs map[K]V) error {
+	if len(kvs) == 0 {
+		return nil
+	}
+	return write(len(b.replicas), b.opts.w, "set", func(i int) error {
+		return b.replicas[i].Set(ctx, kvs)
+	})
+}
+
+func (b *batchKV[K, V]) Del(ctx context.Context, keys []K) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return write(len(b.replicas), b.opts.w, "del", func(i int) error {
+		return b.replicas[i].Del(ctx, keys)
+	})
+}
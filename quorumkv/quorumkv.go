@@ -0,0 +1,309 @@
+// Package quorumkv replicates a store over several backends, with quorum
+// writes and reads.
+//
+// With n replicas, a write succeeds once W replicas acknowledged it, and
+// a read returns once R replicas agree on the value, or on the key not
+// being found. With W + R > n, a read sees the last successful write.
+package quorumkv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	kv "github.com/chenyanchen/kv"
+)
+
+// ReplicaError is the error of one replica.
+type ReplicaError struct {
+	Replica int
+	Err     error
+}
+
+func (e *ReplicaError) Error() string {
+	return fmt.Sprintf("replica %d: %v", e.Replica, e.Err)
+}
+
+func (e *ReplicaError) Unwrap() error { return e.Err }
+
+// QuorumError is returned when an operation cannot reach its quorum. It
+// holds the errors of the replicas that failed, which may be none if the
+// replicas answered but disagreed.
+type QuorumError struct {
+	Op     string // "get", "set" or "del"
+	Quorum int
+	Errors []*ReplicaError
+}
+
+func (e *QuorumError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "quorumkv: %s: quorum of %d not reached", e.Op, e.Quorum)
+	if len(e.Errors) == 0 {
+		b.WriteString(": replicas disagree")
+	}
+	for i, err := range e.Errors {
+		if i == 0 {
+			b.WriteString(": ")
+		} else {
+			b.WriteString(", ")
+		}
+		b.WriteString(err.Error())
+	}
+	return b.String()
+}
+
+func (e *QuorumError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, err := range e.Errors {
+		errs[i] = err
+	}
+	return errs
+}
+
+// Option configures a quorumKV.
+type Option[K comparable, V any] func(*options[V])
+
+type options[V any] struct {
+	w, r       int
+	readRepair bool
+	equal      func(a, b V) bool
+}
+
+// WithWriteQuorum returns an Option that sets the number of replicas
+// acknowledging a write for it to succeed. Defaults to a majority.
+func WithWriteQuorum[K comparable, V any](w int) Option[K, V] {
+	return func(o *options[V]) {
+		o.w = w
+	}
+}
+
+// WithReadQuorum returns an Option that sets the number of replicas
+// agreeing on a read for it to succeed. Defaults to a majority.
+func WithReadQuorum[K comparable, V any](r int) Option[K, V] {
+	return func(o *options[V]) {
+		o.r = r
+	}
+}
+
+// WithReadRepair returns an Option that makes reads repair the replicas
+// disagreeing with the quorum, in the background: the value of the
+// quorum is set on them, or deleted if the quorum did not find the key.
+func WithReadRepair[K comparable, V any]() Option[K, V] {
+	return func(o *options[V]) {
+		o.readRepair = true
+	}
+}
+
+// WithEqual returns an Option that sets how values are compared to find
+// agreeing replicas. Defaults to reflect.DeepEqual.
+func WithEqual[K comparable, V any](equal func(a, b V) bool) Option[K, V] {
+	return func(o *options[V]) {
+		if equal != nil {
+			o.equal = equal
+		}
+	}
+}
+
+func newOptions[K comparable, V any](n int, opts []Option[K, V]) (options[V], error) {
+	if n == 0 {
+		return options[V]{}, errors.New("no replicas")
+	}
+
+	o := options[V]{
+		w:     n/2 + 1,
+		r:     n/2 + 1,
+		equal: func(a, b V) bool { return reflect.DeepEqual(a, b) },
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.w < 1 || o.w > n {
+		return o, fmt.Errorf("write quorum %d out of [1, %d]", o.w, n)
+	}
+	if o.r < 1 || o.r > n {
+		return o, fmt.Errorf("read quorum %d out of [1, %d]", o.r, n)
+	}
+	return o, nil
+}
+
+type quorumKV[K comparable, V any] struct {
+	replicas []kv.KV[K, V]
+	opts     options[V]
+}
+
+// New returns a KV replicated over replicas. Replicas that have not
+// answered when a quorum is reached keep going in the background, with
+// the context of the call.
+func New[K comparable, V any](replicas []kv.KV[K, V], opts ...Option[K, V]) (*quorumKV[K, V], error) {
+	if slices.Contains(replicas, nil) {
+		return nil, errors.New("replica is nil")
+	}
+	o, err := newOptions(len(replicas), opts)
+	if err != nil {
+		return nil, err
+	}
+	return &quorumKV[K, V]{replicas: slices.Clone(replicas), opts: o}, nil
+}
+
+type answer[V any] struct {
+	replica int
+	v       V
+	found   bool
+	err     error
+}
+
+func (q *quorumKV[K, V]) Get(ctx context.Context, k K) (V, error) {
+	answers := make(chan answer[V], len(q.replicas))
+	for i, replica := range q.replicas {
+		go func() {
+			v, err := replica.Get(ctx, k)
+			if errors.Is(err, kv.ErrNotFound) {
+				answers <- answer[V]{replica: i}
+				return
+			}
+			answers <- answer[V]{replica: i, v: v, found: err == nil, err: err}
+		}()
+	}
+
+	var t tally[V]
+	var failed []*ReplicaError
+	for received := 1; received <= len(q.replicas); received++ {
+		a := <-answers
+		if a.err != nil {
+			failed = append(failed, &ReplicaError{Replica: a.replica, Err: a.err})
+		} else if c := t.add(a.replica, a.v, a.found, q.opts.equal); len(c.replicas) == q.opts.r {
+			if q.opts.readRepair {
+				go q.repair(ctx, k, t, *c, answers, len(q.replicas)-received)
+			}
+			if !c.found {
+				return c.v, kv.ErrNotFound
+			}
+			return c.v, nil
+		}
+
+		if len(q.replicas)-received+t.max() < q.opts.r {
+			break
+		}
+	}
+
+	var v V
+	return v, newQuorumError("get", q.opts.r, failed)
+}
+
+// repair waits for the answers left, and repairs the replicas disagreeing
+// with the quorum c.
+func (q *quorumKV[K, V]) repair(ctx context.Context, k K, t tally[V], c class[V], answers <-chan answer[V], left int) {
+	for range left {
+		if a := <-answers; a.err == nil {
+			t.add(a.replica, a.v, a.found, q.opts.equal)
+		}
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	for _, i := range t.disagreeing(c, q.opts.equal) {
+		if c.found {
+			_ = q.replicas[i].Set(ctx, k, c.v)
+		} else {
+			_ = q.replicas[i].Del(ctx, k)
+		}
+	}
+}
+
+func (q *quorumKV[K, V]) Set(ctx context.Context, k K, v V) error {
+	return write(len(q.replicas), q.opts.w, "set", func(i int) error {
+		return q.replicas[i].Set(ctx, k, v)
+	})
+}
+
+func (q *quorumKV[K, V]) Del(ctx context.Context, k K) error {
+	return write(len(q.replicas), q.opts.w, "del", func(i int) error {
+		return q.replicas[i].Del(ctx, k)
+	})
+}
+
+// write calls fn for the n replicas in parallel, and returns once w calls
+// succeeded, or once w calls cannot succeed anymore.
+func write(n, w int, op string, fn func(replica int) error) error {
+	errs := make(chan *ReplicaError, n)
+	for i := range n {
+		go func() {
+			if err := fn(i); err != nil {
+				errs <- &ReplicaError{Replica: i, Err: err}
+				return
+			}
+			errs <- nil
+		}()
+	}
+
+	acks := 0
+	var failed []*ReplicaError
+	for range n {
+		err := <-errs
+		if err == nil {
+			if acks++; acks == w {
+				return nil
+			}
+			continue
+		}
+		if failed = append(failed, err); n-len(failed) < w {
+			break
+		}
+	}
+	return newQuorumError(op, w, failed)
+}
+
+func newQuorumError(op string, quorum int, failed []*ReplicaError) *QuorumError {
+	slices.SortFunc(failed, func(a, b *ReplicaError) int { return a.Replica - b.Replica })
+	return &QuorumError{Op: op, Quorum: quorum, Errors: failed}
+}
+
+// tally groups the replicas by their answer for a key.
+type tally[V any] struct {
+	classes []class[V]
+}
+
+// class is the replicas answering the same for a key.
+type class[V any] struct {
+	v        V
+	found    bool
+	replicas []int
+}
+
+func (c class[V]) agrees(v V, found bool, equal func(a, b V) bool) bool {
+	return c.found == found && (!found || equal(c.v, v))
+}
+
+// add adds the answer of a replica, and returns its class.
+func (t *tally[V]) add(replica int, v V, found bool, equal func(a, b V) bool) *class[V] {
+	for i := range t.classes {
+		if c := &t.classes[i]; c.agrees(v, found, equal) {
+			c.replicas = append(c.replicas, replica)
+			return c
+		}
+	}
+	t.classes = append(t.classes, class[V]{v: v, found: found, replicas: []int{replica}})
+	return &t.classes[len(t.classes)-1]
+}
+
+// max returns the size of the largest class.
+func (t *tally[V]) max() int {
+	n := 0
+	for _, c := range t.classes {
+		n = max(n, len(c.replicas))
+	}
+	return n
+}
+
+// disagreeing returns the replicas whose answer differs from c.
+func (t *tally[V]) disagreeing(c class[V], equal func(a, b V) bool) []int {
+	var replicas []int
+	for _, other := range t.classes {
+		if !other.agrees(c.v, c.found, equal) {
+			replicas = append(replicas, other.replicas...)
+		}
+	}
+	return replicas
+}
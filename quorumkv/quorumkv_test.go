@@ -0,0 +1,270 @@
+package quorumkv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	kv "github.com/chenyanchen/kv"
+	"github.com/chenyanchen/kv/cachekv"
+)
+
+var errDown = errors.New("replica down")
+
+// replica is a store that can be down, or slow.
+type replica struct {
+	kv.KV[string, int]
+	down  atomic.Bool
+	delay time.Duration
+}
+
+func (r *replica) wait() error {
+	time.Sleep(r.delay)
+	if r.down.Load() {
+		return errDown
+	}
+	return nil
+}
+
+func (r *replica) Get(ctx context.Context, k string) (int, error) {
+	if err := r.wait(); err != nil {
+		return 0, err
+	}
+	return r.KV.Get(ctx, k)
+}
+
+func (r *replica) Set(ctx context.Context, k string, v int) error {
+	if err := r.wait(); err != nil {
+		return err
+	}
+	return r.KV.Set(ctx, k, v)
+}
+
+func (r *replica) Del(ctx context.Context, k string) error {
+	if err := r.wait(); err != nil {
+		return err
+	}
+	return r.KV.Del(ctx, k)
+}
+
+func newReplicas(n int) ([]*replica, []kv.KV[string, int]) {
+	replicas := make([]*replica, n)
+	stores := make([]kv.KV[string, int], n)
+	for i := range n {
+		replicas[i] = &replica{KV: cachekv.NewRWMutex[string, int]()}
+		stores[i] = replicas[i]
+	}
+	return replicas, stores
+}
+
+func TestQuorumKV(t *testing.T) {
+	ctx := context.Background()
+	replicas, stores := newReplicas(3)
+	q, err := New(stores)
+	require.NoError(t, err)
+
+	_, err = q.Get(ctx, "a")
+	require.ErrorIs(t, err, kv.ErrNotFound)
+
+	// A majority is enough.
+	replicas[2].down.Store(true)
+	require.NoError(t, q.Set(ctx, "a", 1))
+	v, err := q.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, 1, v)
+
+	// But a minority is not.
+	replicas[1].down.Store(true)
+	err = q.Set(ctx, "a", 2)
+	var quorumErr *QuorumError
+	require.ErrorAs(t, err, &quorumErr)
+	assert.Equal(t, "set", quorumErr.Op)
+	assert.Equal(t, 2, quorumErr.Quorum)
+	require.Len(t, quorumErr.Errors, 2)
+	assert.Equal(t, 1, quorumErr.Errors[0].Replica)
+	assert.Equal(t, 2, quorumErr.Errors[1].Replica)
+	require.ErrorIs(t, err, errDown)
+	assert.EqualError(t, err, "quorumkv: set: quorum of 2 not reached: replica 1: replica down, replica 2: replica down")
+
+	_, err = q.Get(ctx, "a")
+	require.ErrorAs(t, err, &quorumErr)
+	assert.Equal(t, "get", quorumErr.Op)
+
+	replicas[1].down.Store(false)
+	replicas[2].down.Store(false)
+	require.NoError(t, q.Del(ctx, "a"))
+	_, err = q.Get(ctx, "a")
+	require.ErrorIs(t, err, kv.ErrNotFound)
+
+	for _, opts := range [][]Option[string, int]{
+		{WithWriteQuorum[string, int](0)},
+		{WithReadQuorum[string, int](4)},
+	} {
+		_, err = New(stores, opts...)
+		require.Error(t, err)
+	}
+	_, err = New[string, int](nil)
+	require.Error(t, err)
+	_, err = New([]kv.KV[string, int]{nil})
+	require.Error(t, err)
+}
+
+func TestQuorumKV_Agreement(t *testing.T) {
+	ctx := context.Background()
+	replicas, stores := newReplicas(3)
+	q, err := New(stores)
+	require.NoError(t, err)
+
+	// Replica 0 lags, and answers first.
+	require.NoError(t, replicas[1].KV.Set(ctx, "a", 2))
+	require.NoError(t, replicas[2].KV.Set(ctx, "a", 2))
+	replicas[1].delay = 10 * time.Millisecond
+	replicas[2].delay = 20 * time.Millisecond
+
+	v, err := q.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, 2, v, "the first agreeing answers win")
+
+	// All disagree.
+	require.NoError(t, replicas[0].KV.Set(ctx, "b", 0))
+	require.NoError(t, replicas[1].KV.Set(ctx, "b", 1))
+	_, err = q.Get(ctx, "b")
+	var quorumErr *QuorumError
+	require.ErrorAs(t, err, &quorumErr)
+	assert.Empty(t, quorumErr.Errors)
+	assert.EqualError(t, err, "quorumkv: get: quorum of 2 not reached: replicas disagree")
+
+	// Values agree with a custom equality.
+	q, err = New(stores, WithEqual[string, int](func(a, b int) bool { return a%2 == b%2 }))
+	require.NoError(t, err)
+	require.NoError(t, replicas[2].KV.Set(ctx, "b", 2))
+	v, err = q.Get(ctx, "b")
+	require.NoError(t, err)
+	assert.Equal(t, 0, v%2)
+}
+
+func TestQuorumKV_ReadRepair(t *testing.T) {
+	ctx := context.Background()
+	replicas, stores := newReplicas(3)
+	q, err := New(stores, WithReadRepair[string, int]())
+	require.NoError(t, err)
+
+	require.NoError(t, replicas[0].KV.Set(ctx, "a", 1))
+	require.NoError(t, replicas[1].KV.Set(ctx, "a", 1))
+	require.NoError(t, replicas[2].KV.Set(ctx, "deleted", 1))
+	replicas[2].delay = 10 * time.Millisecond
+
+	v, err := q.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, 1, v)
+	_, err = q.Get(ctx, "deleted")
+	require.ErrorIs(t, err, kv.ErrNotFound)
+
+	assert.Eventually(t, func() bool {
+		v, err := replicas[2].KV.Get(ctx, "a")
+		return err == nil && v == 1
+	}, time.Second, time.Millisecond, "the lagging replica gets the value")
+	assert.Eventually(t, func() bool {
+		_, err := replicas[2].KV.Get(ctx, "deleted")
+		return errors.Is(err, kv.ErrNotFound)
+	}, time.Second, time.Millisecond, "the lagging replica drops the value")
+}
+
+func TestQuorumKV_Quorums(t *testing.T) {
+	ctx := context.Background()
+	replicas, stores := newReplicas(3)
+	q, err := New(stores, WithWriteQuorum[string, int](3), WithReadQuorum[string, int](1))
+	require.NoError(t, err)
+
+	replicas[0].down.Store(true)
+	replicas[0].delay = 10 * time.Millisecond
+	require.Error(t, q.Set(ctx, "a", 1), "W=3 needs all the replicas")
+
+	// Replicas 1 and 2 got the write anyway, and answer first.
+	v, err := q.Get(ctx, "a")
+	require.NoError(t, err, "R=1 needs a single replica")
+	assert.Equal(t, 1, v)
+}
+
+func newBatchReplicas(n int) ([]kv.KV[string, int], []kv.BatchKV[string, int]) {
+	stores := make([]kv.KV[string, int], n)
+	batches := make([]kv.BatchKV[string, int], n)
+	for i := range n {
+		store := cachekv.NewRWMutex[string, int]()
+		stores[i] = store
+		batches[i] = cachekv.NewBatch[string, int](store, nil)
+	}
+	return stores, batches
+}
+
+// downBatch is a replica that is down.
+type downBatch struct{ kv.BatchKV[string, int] }
+
+func (downBatch) Get(context.Context, []string) (map[string]int, error) { return nil, errDown }
+func (downBatch) Set(context.Context, map[string]int) error             { return errDown }
+func (downBatch) Del(context.Context, []string) error                   { return errDown }
+
+func TestBatchKV(t *testing.T) {
+	ctx := context.Background()
+	stores, batches := newBatchReplicas(3)
+	// Writes to all the replicas, for the test to make replica 0 lag.
+	b, err := NewBatch(batches, WithWriteQuorum[string, int](3), WithReadRepair[string, int]())
+	require.NoError(t, err)
+
+	kvs := map[string]int{}
+	keys := []string{}
+	for i := range 10 {
+		k := fmt.Sprint("key", i)
+		kvs[k] = i
+		keys = append(keys, k)
+	}
+	require.NoError(t, b.Set(ctx, kvs))
+	require.NoError(t, b.Del(ctx, keys[:2]))
+
+	// Replica 0 lags on some keys.
+	require.NoError(t, stores[0].Set(ctx, "key2", -2))
+	require.NoError(t, stores[0].Del(ctx, "key3"))
+	require.NoError(t, stores[0].Set(ctx, "key0", 0))
+
+	got, err := b.Get(ctx, keys)
+	require.NoError(t, err)
+	for _, k := range keys[2:] {
+		assert.Equal(t, kvs[k], got[k], k)
+	}
+	assert.Len(t, got, 8)
+
+	assert.Eventually(t, func() bool {
+		v2, err2 := stores[0].Get(ctx, "key2")
+		v3, err3 := stores[0].Get(ctx, "key3")
+		_, err0 := stores[0].Get(ctx, "key0")
+		return err2 == nil && v2 == 2 && err3 == nil && v3 == 3 && errors.Is(err0, kv.ErrNotFound)
+	}, time.Second, time.Millisecond, "replica 0 is repaired")
+
+	got, err = b.Get(ctx, nil)
+	require.NoError(t, err)
+	assert.Empty(t, got)
+
+	// With a replica down.
+	batches[1] = downBatch{}
+	b, err = NewBatch(batches)
+	require.NoError(t, err)
+	got, err = b.Get(ctx, keys)
+	require.NoError(t, err)
+	assert.Len(t, got, 8)
+	require.NoError(t, b.Set(ctx, map[string]int{"key0": 0}))
+
+	batches[2] = downBatch{}
+	b, err = NewBatch(batches)
+	require.NoError(t, err)
+	_, err = b.Get(ctx, keys)
+	var quorumErr *QuorumError
+	require.ErrorAs(t, err, &quorumErr)
+	require.Len(t, quorumErr.Errors, 2)
+	require.ErrorIs(t, b.Del(ctx, keys), errDown)
+}
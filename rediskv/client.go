@@ -0,0 +1,324 @@
+package rediskv
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultPoolSize    = 10
+	defaultDialTimeout = 5 * time.Second
+)
+
+// ErrClosed is returned by a closed Client.
+var ErrClosed = errors.New("client is closed")
+
+// ClientOption configures a Client.
+type ClientOption func(*clientOptions)
+
+type clientOptions struct {
+	password    string
+	db          int
+	poolSize    int
+	dialTimeout time.Duration
+}
+
+// WithPassword returns a ClientOption that authenticates new connections
+// with AUTH.
+func WithPassword(password string) ClientOption {
+	return func(o *clientOptions) {
+		o.password = password
+	}
+}
+
+// WithDB returns a ClientOption that selects the database of new connections.
+func WithDB(db int) ClientOption {
+	return func(o *clientOptions) {
+		o.db = db
+	}
+}
+
+// WithPoolSize returns a ClientOption that sets the maximum number of
+// connections open at the same time. Defaults to 10.
+func WithPoolSize(n int) ClientOption {
+	return func(o *clientOptions) {
+		if n > 0 {
+			o.poolSize = n
+		}
+	}
+}
+
+// WithDialTimeout returns a ClientOption that bounds the time to open a
+// connection. Defaults to 5 seconds.
+func WithDialTimeout(d time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		if d > 0 {
+			o.dialTimeout = d
+		}
+	}
+}
+
+// Client is a minimal RESP2 client with a connection pool. It is safe for
+// concurrent use.
+type Client struct {
+	addr string
+	opts clientOptions
+
+	// sem holds a token for every open connection.
+	sem chan struct{}
+
+	// idle holds the connections not in use.
+	idle chan *conn
+
+	mu     sync.Mutex
+	closed bool
+}
+
+type conn struct {
+	net.Conn
+	br *bufio.Reader
+	bw *bufio.Writer
+	// interrupted is set once the interruption of a round trip may still
+	// set a past deadline: the connection must not be reused.
+	interrupted bool
+}
+
+// NewClient returns a Client of the server at addr. Connections are opened
+// when needed.
+func NewClient(addr string, opts ...ClientOption) (*Client, error) {
+	if addr == "" {
+		return nil, errors.New("addr is empty")
+	}
+
+	o := clientOptions{poolSize: defaultPoolSize, dialTimeout: defaultDialTimeout}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return &Client{
+		addr: addr,
+		opts: o,
+		sem:  make(chan struct{}, o.poolSize),
+		idle: make(chan *conn, o.poolSize),
+	}, nil
+}
+
+// Do sends a command and returns its reply, see readReply for the types.
+// An error reply is returned as an Error. The arguments may be strings,
+// byte slices or integers.
+func (c *Client) Do(ctx context.Context, args ...any) (any, error) {
+	replies, err := c.Pipeline(ctx, [][]any{args})
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := replies[0].(Error); ok {
+		return nil, e
+	}
+	return replies[0], nil
+}
+
+// Pipeline sends the commands in one round trip and returns their replies
+// in order. Error replies are returned as Error values among the replies.
+func (c *Client) Pipeline(ctx context.Context, cmds [][]any) ([]any, error) {
+	encoded := make([][][]byte, len(cmds))
+	for i, cmd := range cmds {
+		args, err := encodeArgs(cmd)
+		if err != nil {
+			return nil, err
+		}
+		encoded[i] = args
+	}
+
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	replies, err := cn.roundTrip(ctx, encoded)
+	// The replies of a failed round trip may still be on the wire.
+	c.put(cn, err != nil || cn.interrupted)
+	return replies, err
+}
+
+// Close closes the idle connections. Connections in use are closed when
+// they are released.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	var errs []error
+	for {
+		select {
+		case cn := <-c.idle:
+			errs = append(errs, cn.Close())
+			<-c.sem
+		default:
+			return errors.Join(errs...)
+		}
+	}
+}
+
+// get returns an idle connection, or opens one if the pool is not full,
+// or waits for one to be released.
+func (c *Client) get(ctx context.Context) (*conn, error) {
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if closed {
+		return nil, ErrClosed
+	}
+
+	select {
+	case cn := <-c.idle:
+		return cn, nil
+	default:
+	}
+
+	select {
+	case cn := <-c.idle:
+		return cn, nil
+	case c.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	cn, err := c.dial(ctx)
+	if err != nil {
+		<-c.sem
+		return nil, err
+	}
+	return cn, nil
+}
+
+// put returns cn to the pool, or closes it if it is broken.
+func (c *Client) put(cn *conn, broken bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if broken || c.closed {
+		_ = cn.Close()
+		<-c.sem
+		return
+	}
+	// Never blocks: there are no more connections than tokens.
+	c.idle <- cn
+}
+
+func (c *Client) dial(ctx context.Context) (*conn, error) {
+	d := net.Dialer{Timeout: c.opts.dialTimeout}
+	nc, err := d.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, err
+	}
+	cn := &conn{Conn: nc, br: bufio.NewReader(nc), bw: bufio.NewWriter(nc)}
+
+	var setup [][]any
+	if c.opts.password != "" {
+		setup = append(setup, []any{"AUTH", c.opts.password})
+	}
+	if c.opts.db != 0 {
+		setup = append(setup, []any{"SELECT", c.opts.db})
+	}
+	if len(setup) == 0 {
+		return cn, nil
+	}
+
+	cmds := make([][][]byte, len(setup))
+	for i, cmd := range setup {
+		cmds[i], _ = encodeArgs(cmd)
+	}
+	replies, err := cn.roundTrip(ctx, cmds)
+	if err == nil && cn.interrupted {
+		err = ctx.Err()
+	}
+	if err == nil {
+		for _, reply := range replies {
+			if e, ok := reply.(Error); ok {
+				err = e
+				break
+			}
+		}
+	}
+	if err != nil {
+		_ = cn.Close()
+		return nil, fmt.Errorf("setup connection: %w", err)
+	}
+	return cn, nil
+}
+
+// roundTrip writes the commands and reads their replies. The deadline of
+// ctx applies to the connection, and canceling ctx interrupts the IO.
+func (cn *conn) roundTrip(ctx context.Context, cmds [][][]byte) ([]any, error) {
+	deadline, _ := ctx.Deadline()
+	if err := cn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	stop := context.AfterFunc(ctx, func() {
+		_ = cn.SetDeadline(time.Unix(1, 0))
+	})
+	defer func() {
+		// Once started, the interruption may run after the round trip
+		// succeeded, failing the next one.
+		if !stop() {
+			cn.interrupted = true
+		}
+	}()
+
+	for _, args := range cmds {
+		if err := writeCommand(cn.bw, args); err != nil {
+			return nil, contextErr(ctx, err)
+		}
+	}
+	if err := cn.bw.Flush(); err != nil {
+		return nil, contextErr(ctx, err)
+	}
+
+	replies := make([]any, len(cmds))
+	for i := range replies {
+		reply, err := readReply(cn.br)
+		if err != nil {
+			return nil, contextErr(ctx, err)
+		}
+		replies[i] = reply
+	}
+	return replies, nil
+}
+
+// contextErr returns the error of ctx if it interrupted the IO. The IO may
+// time out at the deadline of ctx just before ctx is done.
+func contextErr(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	if deadline, ok := ctx.Deadline(); ok && errors.Is(err, os.ErrDeadlineExceeded) && !time.Now().Before(deadline) {
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+func encodeArgs(args []any) ([][]byte, error) {
+	encoded := make([][]byte, len(args))
+	for i, arg := range args {
+		switch arg := arg.(type) {
+		case string:
+			encoded[i] = []byte(arg)
+		case []byte:
+			encoded[i] = arg
+		case int:
+			encoded[i] = strconv.AppendInt(nil, int64(arg), 10)
+		case int64:
+			encoded[i] = strconv.AppendInt(nil, arg, 10)
+		default:
+			return nil, fmt.Errorf("unsupported argument type %T", arg)
+		}
+	}
+	return encoded, nil
+}
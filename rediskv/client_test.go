@@ -0,0 +1,174 @@
+package rediskv
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_Do(t *testing.T) {
+	ctx := context.Background()
+	srv := newFakeServer(t, "")
+	c := newClient(t, srv.addr)
+
+	reply, err := c.Do(ctx, "PING")
+	require.NoError(t, err)
+	assert.Equal(t, "PONG", reply)
+
+	reply, err = c.Do(ctx, "DEL", "a", []byte("b"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), reply)
+
+	_, err = c.Do(ctx, "NOPE")
+	var e Error
+	require.ErrorAs(t, err, &e)
+	assert.True(t, strings.HasPrefix(string(e), "ERR unknown command"))
+
+	_, err = c.Do(ctx, "SET", "a", 1.5)
+	require.Error(t, err)
+
+	// Error replies stay in the pipeline, the connection is reused.
+	replies, err := c.Pipeline(ctx, [][]any{{"NOPE"}, {"SET", "a", 1}, {"GET", "a"}})
+	require.NoError(t, err)
+	assert.Equal(t, []any{Error("ERR unknown command 'NOPE'"), "OK", []byte("1")}, replies)
+	assert.Equal(t, int32(1), srv.conns.Load())
+}
+
+func TestClient_Auth(t *testing.T) {
+	ctx := context.Background()
+	srv := newFakeServer(t, "secret")
+
+	_, err := newClient(t, srv.addr).Do(ctx, "PING")
+	require.ErrorContains(t, err, "NOAUTH")
+
+	_, err = newClient(t, srv.addr, WithPassword("wrong")).Do(ctx, "PING")
+	require.ErrorContains(t, err, "WRONGPASS")
+
+	reply, err := newClient(t, srv.addr, WithPassword("secret"), WithDB(1)).Do(ctx, "PING")
+	require.NoError(t, err)
+	assert.Equal(t, "PONG", reply)
+}
+
+func TestClient_Pool(t *testing.T) {
+	ctx := context.Background()
+	srv := newFakeServer(t, "")
+	srv.delay.Store(int64(5 * time.Millisecond))
+	c := newClient(t, srv.addr, WithPoolSize(2))
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.Do(ctx, "PING")
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, srv.conns.Load(), int32(2))
+
+	require.NoError(t, c.Close())
+	_, err := c.Do(ctx, "PING")
+	require.ErrorIs(t, err, ErrClosed)
+}
+
+func TestClient_Context(t *testing.T) {
+	srv := newFakeServer(t, "")
+	srv.delay.Store(int64(time.Second))
+	c := newClient(t, srv.addr)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := c.Do(ctx, "PING")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+
+	// The interrupted connection is not reused.
+	srv.delay.Store(0)
+	reply, err := c.Do(context.Background(), "PING")
+	require.NoError(t, err)
+	assert.Equal(t, "PONG", reply)
+	assert.Equal(t, int32(2), srv.conns.Load())
+}
+
+func TestConn_Interrupted(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	// The reply is buffered, so the round trip succeeds after ctx ended.
+	cn := &conn{Conn: client, br: bufio.NewReader(strings.NewReader("+PONG\r\n")), bw: bufio.NewWriter(io.Discard)}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	replies, err := cn.roundTrip(ctx, [][][]byte{{[]byte("PING")}})
+	require.NoError(t, err)
+	assert.Equal(t, []any{"PONG"}, replies)
+	assert.True(t, cn.interrupted, "a past deadline may still be set")
+}
+
+// lateCtx is a context at its deadline but not done yet, as when its
+// timer has not fired.
+type lateCtx struct {
+	context.Context
+	deadline time.Time
+}
+
+func (c lateCtx) Deadline() (time.Time, bool) { return c.deadline, true }
+
+func TestClient_DeadlineExceeded(t *testing.T) {
+	srv := newFakeServer(t, "")
+	c := newClient(t, srv.addr)
+	_, err := c.Do(context.Background(), "PING")
+	require.NoError(t, err)
+
+	// The read times out at the deadline, before ctx is done.
+	srv.delay.Store(int64(time.Second))
+	ctx := lateCtx{Context: context.Background(), deadline: time.Now().Add(20 * time.Millisecond)}
+	_, err = c.Do(ctx, "PING")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.NoError(t, ctx.Err())
+}
+
+func TestReadReply(t *testing.T) {
+	tests := []struct {
+		in   string
+		want any
+	}{
+		{in: "+OK\r\n", want: "OK"},
+		{in: "-ERR bad\r\n", want: Error("ERR bad")},
+		{in: ":-42\r\n", want: int64(-42)},
+		{in: "$5\r\nhe\r\no\r\n", want: []byte("he\r\no")},
+		{in: "$-1\r\n", want: nil},
+		{in: "*-1\r\n", want: nil},
+		{in: "*2\r\n$1\r\na\r\n$-1\r\n", want: []any{[]byte("a"), nil}},
+	}
+	for _, tt := range tests {
+		got, err := readReply(bufio.NewReader(strings.NewReader(tt.in)))
+		require.NoError(t, err, tt.in)
+		assert.Equal(t, tt.want, got, tt.in)
+	}
+
+	for _, in := range []string{"?\r\n", "+OK\n", ":x\r\n", "$3\r\nabcd\r\n", "$3\r\nab"} {
+		_, err := readReply(bufio.NewReader(strings.NewReader(in)))
+		require.Error(t, err, in)
+	}
+
+	// The elements of an array are allocated as they are read.
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err := readReply(bufio.NewReader(strings.NewReader("*536870912\r\n:1\r\n")))
+	runtime.ReadMemStats(&after)
+	require.ErrorIs(t, err, io.EOF)
+	assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(1<<20))
+}
@@ -0,0 +1,226 @@
+// Package rediskv implements kv.KV and kv.BatchKV on Redis, with a minimal
+// RESP2 client and no dependency.
+package rediskv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	kv "github.com/chenyanchen/kv"
+)
+
+// Option configures the stores.
+type Option func(*options)
+
+type options struct {
+	ttl time.Duration
+}
+
+// WithTTL returns an Option that sets an expiration on every write, with
+// SET EX, or SET PX for a ttl that is not a whole number of seconds.
+func WithTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.ttl = ttl
+	}
+}
+
+func newOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// setArgs returns the SET command of k and v.
+func (o options) setArgs(k string, v []byte) []any {
+	switch {
+	case o.ttl <= 0:
+		return []any{"SET", k, v}
+	case o.ttl%time.Second == 0:
+		return []any{"SET", k, v, "EX", int64(o.ttl / time.Second)}
+	default:
+		return []any{"SET", k, v, "PX", max(o.ttl.Milliseconds(), 1)}
+	}
+}
+
+type redisKV struct {
+	client *Client
+	opts   options
+}
+
+// New returns a kv.KV on the Redis server of client.
+func New(client *Client, opts ...Option) (*redisKV, error) {
+	if client == nil {
+		return nil, errors.New("client is nil")
+	}
+	return &redisKV{client: client, opts: newOptions(opts)}, nil
+}
+
+func (s *redisKV) Get(ctx context.Context, k string) ([]byte, error) {
+	reply, err := s.client.Do(ctx, "GET", k)
+	if err != nil {
+		return nil, err
+	}
+	return bulk(reply)
+}
+
+func (s *redisKV) Set(ctx context.Context, k string, v []byte) error {
+	_, err := s.client.Do(ctx, s.opts.setArgs(k, v)...)
+	return err
+}
+
+func (s *redisKV) Del(ctx context.Context, k string) error {
+	_, err := s.client.Do(ctx, "DEL", k)
+	return err
+}
+
+// Incr adds delta to the counter k with INCRBY, see kv.Counter. Counters
+// are decimal strings, as Redis stores them. With WithTTL, the counters
+// created expire ttl after.
+func (s *redisKV) Incr(ctx context.Context, k string, delta int64) (int64, error) {
+	return s.IncrWithTTL(ctx, k, delta, s.opts.ttl)
+}
+
+// IncrWithTTL adds delta to the counter k, see kv.ExpiringCounter. It
+// creates k at 0 with the expiration by SET NX, then runs INCRBY, in a
+// MULTI/EXEC transaction so that k cannot expire in between. A
+// non-positive ttl never expires the counters created.
+func (s *redisKV) IncrWithTTL(ctx context.Context, k string, delta int64, ttl time.Duration) (int64, error) {
+	if ttl <= 0 {
+		reply, err := s.client.Do(ctx, "INCRBY", k, delta)
+		if err != nil {
+			return 0, err
+		}
+		return integer(reply)
+	}
+
+	create := append(options{ttl: ttl}.setArgs(k, []byte("0")), "NX")
+	replies, err := s.client.Pipeline(ctx, [][]any{{"MULTI"}, create, {"INCRBY", k, delta}, {"EXEC"}})
+	if err != nil {
+		return 0, err
+	}
+	for _, reply := range replies {
+		if e, ok := reply.(Error); ok {
+			return 0, e
+		}
+	}
+	exec, ok := replies[3].([]any)
+	if !ok || len(exec) != 2 {
+		return 0, fmt.Errorf("unexpected EXEC reply %T", replies[3])
+	}
+	if e, ok := exec[1].(Error); ok {
+		return 0, e
+	}
+	return integer(exec[1])
+}
+
+// integer returns the value of an integer reply.
+func integer(reply any) (int64, error) {
+	n, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("unexpected reply %T", reply)
+	}
+	return n, nil
+}
+
+// bulk returns the value of a bulk string reply, and kv.ErrNotFound for nil.
+func bulk(reply any) ([]byte, error) {
+	switch reply := reply.(type) {
+	case nil:
+		return nil, kv.ErrNotFound
+	case []byte:
+		return reply, nil
+	default:
+		return nil, fmt.Errorf("unexpected reply %T", reply)
+	}
+}
+
+type batchKV struct {
+	client *Client
+	opts   options
+}
+
+// NewBatch returns a kv.BatchKV on the Redis server of client.
+func NewBatch(client *Client, opts ...Option) (*batchKV, error) {
+	if client == nil {
+		return nil, errors.New("client is nil")
+	}
+	return &batchKV{client: client, opts: newOptions(opts)}, nil
+}
+
+// Get reads the keys with MGET; missing keys are left out of the result.
+func (b *batchKV) Get(ctx context.Context, keys []string) (map[string][]byte, error) {
+	if len(keys) == 0 {
+		return map[string][]byte{}, nil
+	}
+
+	args := make([]any, 0, len(keys)+1)
+	args = append(args, "MGET")
+	for _, k := range keys {
+		args = append(args, k)
+	}
+	reply, err := b.client.Do(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	values, ok := reply.([]any)
+	if !ok || len(values) != len(keys) {
+		return nil, fmt.Errorf("unexpected MGET reply %T", reply)
+	}
+
+	result := make(map[string][]byte, len(keys))
+	for i, value := range values {
+		v, err := bulk(value)
+		if errors.Is(err, kv.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		result[keys[i]] = v
+	}
+	return result, nil
+}
+
+// Set pipelines a SET per pair, so that each gets the TTL. It is not
+// atomic: on error, some of the pairs may have been written.
+func (b *batchKV) Set(ctx context.Context, kvs map[string][]byte) error {
+	if len(kvs) == 0 {
+		return nil
+	}
+
+	cmds := make([][]any, 0, len(kvs))
+	for k, v := range kvs {
+		cmds = append(cmds, b.opts.setArgs(k, v))
+	}
+	replies, err := b.client.Pipeline(ctx, cmds)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, reply := range replies {
+		if e, ok := reply.(Error); ok {
+			errs = append(errs, e)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (b *batchKV) Del(ctx context.Context, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	args := make([]any, 0, len(keys)+1)
+	args = append(args, "DEL")
+	for _, k := range keys {
+		args = append(args, k)
+	}
+	_, err := b.client.Do(ctx, args...)
+	return err
+}
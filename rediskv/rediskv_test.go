@@ -0,0 +1,140 @@
+package rediskv
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	kv "github.com/chenyanchen/kv"
+)
+
+func newClient(t *testing.T, addr string, opts ...ClientOption) *Client {
+	t.Helper()
+	c, err := NewClient(addr, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func TestRedisKV(t *testing.T) {
+	ctx := context.Background()
+	srv := newFakeServer(t, "")
+
+	s, err := New(newClient(t, srv.addr))
+	require.NoError(t, err)
+
+	_, err = s.Get(ctx, "a")
+	require.ErrorIs(t, err, kv.ErrNotFound)
+
+	require.NoError(t, s.Set(ctx, "a", []byte("1")))
+	require.NoError(t, s.Set(ctx, "b", []byte{}))
+
+	v, err := s.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("1"), v)
+
+	v, err = s.Get(ctx, "b")
+	require.NoError(t, err, "an empty value is not a missing one")
+	assert.Empty(t, v)
+
+	require.NoError(t, s.Del(ctx, "a"))
+	_, err = s.Get(ctx, "a")
+	require.ErrorIs(t, err, kv.ErrNotFound)
+
+	_, err = New(nil)
+	require.Error(t, err)
+}
+
+func TestRedisKV_TTL(t *testing.T) {
+	ctx := context.Background()
+	srv := newFakeServer(t, "")
+
+	assert.Equal(t, []any{"SET", "k", []byte("v"), "EX", int64(2)},
+		options{ttl: 2 * time.Second}.setArgs("k", []byte("v")))
+
+	s, err := New(newClient(t, srv.addr), WithTTL(50*time.Millisecond))
+	require.NoError(t, err)
+
+	require.NoError(t, s.Set(ctx, "a", []byte("1")))
+	_, err = s.Get(ctx, "a")
+	require.NoError(t, err)
+
+	time.Sleep(60 * time.Millisecond)
+	_, err = s.Get(ctx, "a")
+	require.ErrorIs(t, err, kv.ErrNotFound)
+}
+
+func TestRedisKV_Incr(t *testing.T) {
+	ctx := context.Background()
+	srv := newFakeServer(t, "")
+
+	s, err := New(newClient(t, srv.addr))
+	require.NoError(t, err)
+
+	n, err := s.Incr(ctx, "views", 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	n, err = s.Incr(ctx, "views", -3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), n)
+	v, err := s.Get(ctx, "views")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("-1"), v, "stored as a decimal string")
+
+	require.NoError(t, s.Set(ctx, "name", []byte("a")))
+	_, err = s.Incr(ctx, "name", 1)
+	var redisErr Error
+	require.ErrorAs(t, err, &redisErr)
+	_, err = s.IncrWithTTL(ctx, "name", 1, time.Minute)
+	require.ErrorAs(t, err, &redisErr, "failing in the transaction")
+
+	// The window starts with the first increment.
+	n, err = s.IncrWithTTL(ctx, "hits", 1, 50*time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	time.Sleep(30 * time.Millisecond)
+	n, err = s.IncrWithTTL(ctx, "hits", 1, 50*time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	time.Sleep(30 * time.Millisecond)
+	n, err = s.IncrWithTTL(ctx, "hits", 1, 50*time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n, "not extended by the second increment")
+}
+
+func TestBatchKV(t *testing.T) {
+	ctx := context.Background()
+	srv := newFakeServer(t, "")
+
+	b, err := NewBatch(newClient(t, srv.addr), WithTTL(time.Minute))
+	require.NoError(t, err)
+
+	kvs := make(map[string][]byte)
+	keys := make([]string, 0, 100)
+	for i := range 100 {
+		k := fmt.Sprint("key", i)
+		kvs[k] = []byte(fmt.Sprint("value", i))
+		keys = append(keys, k)
+	}
+	require.NoError(t, b.Set(ctx, kvs))
+	assert.Equal(t, int32(1), srv.conns.Load(), "a pipeline uses one connection")
+
+	got, err := b.Get(ctx, append(keys, "missing"))
+	require.NoError(t, err)
+	assert.Equal(t, kvs, got)
+
+	require.NoError(t, b.Del(ctx, keys[:50]))
+	got, err = b.Get(ctx, keys)
+	require.NoError(t, err)
+	assert.Len(t, got, 50)
+
+	got, err = b.Get(ctx, nil)
+	require.NoError(t, err)
+	assert.Empty(t, got)
+	require.NoError(t, b.Set(ctx, nil))
+	require.NoError(t, b.Del(ctx, nil))
+}
@@ -0,0 +1,132 @@
+package rediskv
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Error is an error reply of the server, such as "WRONGTYPE Operation
+// against a key holding the wrong kind of value".
+type Error string
+
+func (e Error) Error() string { return string(e) }
+
+// maxBulkLen is the largest bulk string the server accepts.
+const maxBulkLen = 512 << 20
+
+// maxArrayPrealloc bounds the elements allocated for an array before they
+// are read, for a bad array length not to allocate gigabytes.
+const maxArrayPrealloc = 1024
+
+var errProtocol = errors.New("redis protocol error")
+
+// writeCommand writes a command as a RESP array of bulk strings.
+func writeCommand(w *bufio.Writer, args [][]byte) error {
+	buf := w.AvailableBuffer()
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+	if _, err := w.Write(buf); err != nil {
+		return err
+	}
+
+	for _, arg := range args {
+		buf = w.AvailableBuffer()
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, '\r', '\n')
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+		if _, err := w.Write(arg); err != nil {
+			return err
+		}
+		if _, err := w.WriteString("\r\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readReply reads a RESP2 reply. Simple strings are returned as string,
+// errors as Error, integers as int64, bulk strings as []byte, arrays as
+// []any, and null bulk strings and arrays as nil.
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, fmt.Errorf("%w: empty line", errProtocol)
+	}
+
+	switch line[0] {
+	case '+':
+		return string(line[1:]), nil
+	case '-':
+		return Error(line[1:]), nil
+	case ':':
+		return parseInt(line[1:])
+	case '$':
+		n, err := parseInt(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		if n > maxBulkLen {
+			return nil, fmt.Errorf("%w: bulk length %d", errProtocol, n)
+		}
+		p := make([]byte, n+2)
+		if _, err = io.ReadFull(r, p); err != nil {
+			return nil, err
+		}
+		if p[n] != '\r' || p[n+1] != '\n' {
+			return nil, fmt.Errorf("%w: bulk string not terminated", errProtocol)
+		}
+		return p[:n], nil
+	case '*':
+		n, err := parseInt(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		if n > maxBulkLen {
+			return nil, fmt.Errorf("%w: array length %d", errProtocol, n)
+		}
+		a := make([]any, 0, min(n, maxArrayPrealloc))
+		for range n {
+			e, err := readReply(r)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, e)
+		}
+		return a, nil
+	default:
+		return nil, fmt.Errorf("%w: unexpected type %q", errProtocol, line[0])
+	}
+}
+
+// readLine reads a line terminated by CRLF, without the terminator.
+func readLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return nil, fmt.Errorf("%w: line too long", errProtocol)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("%w: line not terminated by CRLF", errProtocol)
+	}
+	return line[:len(line)-2], nil
+}
+
+func parseInt(p []byte) (int64, error) {
+	n, err := strconv.ParseInt(string(p), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", errProtocol, err)
+	}
+	return n, nil
+}
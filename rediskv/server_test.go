@@ -0,0 +1,268 @@
+package rediskv
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeServer is an in-process server of the few commands used by the stores.
+type fakeServer struct {
+	addr     string
+	password string
+
+	// delay is slept before each reply.
+	delay atomic.Int64
+	// conns counts the accepted connections.
+	conns atomic.Int32
+
+	mu      sync.Mutex
+	data    map[string][]byte
+	expires map[string]time.Time
+}
+
+func newFakeServer(t *testing.T, password string) *fakeServer {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &fakeServer{
+		addr:     ln.Addr().String(),
+		password: password,
+		data:     make(map[string][]byte),
+		expires:  make(map[string]time.Time),
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var conns []net.Conn
+	t.Cleanup(func() {
+		_ = ln.Close()
+		mu.Lock()
+		for _, c := range conns {
+			_ = c.Close()
+		}
+		mu.Unlock()
+		wg.Wait()
+	})
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.conns.Add(1)
+			mu.Lock()
+			conns = append(conns, c)
+			mu.Unlock()
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.serve(c)
+			}()
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) serve(c net.Conn) {
+	defer c.Close()
+
+	br := bufio.NewReader(c)
+	bw := bufio.NewWriter(c)
+	authed := s.password == ""
+	// queued are the commands of the transaction started by MULTI, nil
+	// out of one.
+	var queued [][]string
+	for {
+		req, err := readReply(br)
+		if err != nil {
+			return
+		}
+		args, ok := req.([]any)
+		if !ok || len(args) == 0 {
+			return
+		}
+		cmd := make([]string, len(args))
+		for i, arg := range args {
+			cmd[i] = string(arg.([]byte))
+		}
+
+		var reply any
+		switch name := strings.ToUpper(cmd[0]); {
+		case name == "AUTH":
+			authed = cmd[1] == s.password
+			reply = "OK"
+			if !authed {
+				reply = Error("WRONGPASS invalid password")
+			}
+		case !authed:
+			reply = Error("NOAUTH Authentication required.")
+		case name == "MULTI":
+			queued = [][]string{}
+			reply = "OK"
+		case name == "EXEC":
+			reply = s.execAll(queued)
+			queued = nil
+		case queued != nil:
+			queued = append(queued, cmd)
+			reply = "QUEUED"
+		default:
+			reply = s.exec(name, cmd[1:])
+		}
+
+		time.Sleep(time.Duration(s.delay.Load()))
+		writeReply(bw, reply)
+		// Flush once the pipelined commands are all read.
+		if br.Buffered() == 0 {
+			if err = bw.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *fakeServer) exec(name string, args []string) any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.run(name, args)
+}
+
+// execAll runs the commands of a transaction at once, or fails if there
+// is none.
+func (s *fakeServer) execAll(cmds [][]string) any {
+	if cmds == nil {
+		return Error("ERR EXEC without MULTI")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	replies := make([]any, len(cmds))
+	for i, cmd := range cmds {
+		replies[i] = s.run(strings.ToUpper(cmd[0]), cmd[1:])
+	}
+	return replies
+}
+
+// run runs a command. It must be called with s.mu held.
+func (s *fakeServer) run(name string, args []string) any {
+	switch name {
+	case "PING":
+		return "PONG"
+	case "SELECT":
+		return "OK"
+	case "GET":
+		return s.get(args[0])
+	case "MGET":
+		values := make([]any, len(args))
+		for i, k := range args {
+			values[i] = s.get(k)
+		}
+		return values
+	case "SET":
+		k := args[0]
+		var expires time.Time
+		for i := 2; i < len(args); i++ {
+			switch opt := strings.ToUpper(args[i]); opt {
+			case "NX":
+				if s.get(k) != nil {
+					return nil
+				}
+			case "EX", "PX":
+				i++
+				n, err := strconv.ParseInt(args[i], 10, 64)
+				if err != nil || n <= 0 {
+					return Error("ERR invalid expire time in 'set' command")
+				}
+				unit := time.Second
+				if opt == "PX" {
+					unit = time.Millisecond
+				}
+				expires = time.Now().Add(time.Duration(n) * unit)
+			}
+		}
+		s.data[k] = []byte(args[1])
+		delete(s.expires, k)
+		if !expires.IsZero() {
+			s.expires[k] = expires
+		}
+		return "OK"
+	case "INCRBY":
+		k := args[0]
+		var n int64
+		if v, ok := s.get(k).([]byte); ok {
+			var err error
+			if n, err = strconv.ParseInt(string(v), 10, 64); err != nil {
+				return Error("ERR value is not an integer or out of range")
+			}
+		}
+		delta, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return Error("ERR value is not an integer or out of range")
+		}
+		n += delta
+		s.data[k] = strconv.AppendInt(nil, n, 10)
+		return n
+	case "DEL":
+		var n int64
+		for _, k := range args {
+			if s.get(k) != nil {
+				n++
+			}
+			delete(s.data, k)
+			delete(s.expires, k)
+		}
+		return n
+	default:
+		return Error("ERR unknown command '" + name + "'")
+	}
+}
+
+// get returns the value of k, or nil if it is missing or expired.
+func (s *fakeServer) get(k string) any {
+	if at, ok := s.expires[k]; ok && time.Now().After(at) {
+		delete(s.data, k)
+		delete(s.expires, k)
+	}
+	if v, ok := s.data[k]; ok {
+		return v
+	}
+	return nil
+}
+
+func writeReply(w *bufio.Writer, reply any) {
+	switch reply := reply.(type) {
+	case nil:
+		_, _ = w.WriteString("$-1\r\n")
+	case string:
+		_, _ = w.WriteString("+" + reply + "\r\n")
+	case Error:
+		_, _ = w.WriteString("-" + string(reply) + "\r\n")
+	case int64:
+		_, _ = w.WriteString(":" + strconv.FormatInt(reply, 10) + "\r\n")
+	case []byte:
+		_, _ = w.WriteString("$" + strconv.Itoa(len(reply)) + "\r\n")
+		_, _ = w.Write(reply)
+		_, _ = w.WriteString("\r\n")
+	case []any:
+		_, _ = w.WriteString("*" + strconv.Itoa(len(reply)) + "\r\n")
+		for _, r := range reply {
+			writeReply(w, r)
+		}
+	default:
+		panic(errors.New("unsupported reply"))
+	}
+}
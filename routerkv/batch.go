@@ -0,0 +1,95 @@
+package routerkv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"sync"
+
+	kv "github.com/chenyanchen/kv"
+)
+
+type batchKV[K comparable, V any] struct {
+	router[K, kv.BatchKV[K, V]]
+}
+
+// NewBatch returns a BatchKV routing keys to the backends as New does.
+// A batch is split by backend, and the backends are called in parallel.
+func NewBatch[K comparable, V any](backends map[string]kv.BatchKV[K, V], opts ...Option[K]) (*batchKV[K, V], error) {
+	r, err := newRouter(backends, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &batchKV[K, V]{router: r}, nil
+}
+
+// Get returns the values of the keys found; missing keys are left out of the result.
+func (b *batchKV[K, V]) Get(ctx context.Context, keys []K) (map[K]V, error) {
+	result := make(map[K]V, len(keys))
+	var mu sync.Mutex
+
+	err := each(b.router, b.split(keys), func(backend kv.BatchKV[K, V], keys []K) error {
+		values, err := backend.Get(ctx, keys)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		maps.Copy(result, values)
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (b *batchKV[K, V]) Set(ctx context.Context, kvs map[K]V) error {
+	groups := make(map[int]map[K]V)
+	for k, v := range kvs {
+		i := b.route(k)
+		if groups[i] == nil {
+			groups[i] = make(map[K]V)
+		}
+		groups[i][k] = v
+	}
+	return each(b.router, groups, func(backend kv.BatchKV[K, V], kvs map[K]V) error {
+		return backend.Set(ctx, kvs)
+	})
+}
+
+func (b *batchKV[K, V]) Del(ctx context.Context, keys []K) error {
+	return each(b.router, b.split(keys), func(backend kv.BatchKV[K, V], keys []K) error {
+		return backend.Del(ctx, keys)
+	})
+}
+
+// split groups keys by the index of their backend.
+func (b *batchKV[K, V]) split(keys []K) map[int][]K {
+	groups := make(map[int][]K)
+	for _, k := range keys {
+		i := b.route(k)
+		groups[i] = append(groups[i], k)
+	}
+	return groups
+}
+
+// each calls fn for every group in parallel, with the backend of the
+// group, and returns the errors of the backends joined.
+func each[K comparable, B, G any](r router[K, B], groups map[int]G, fn func(B, G) error) error {
+	errs := make([]error, len(r.backends))
+	var wg sync.WaitGroup
+	for i, group := range groups {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := fn(r.backends[i], group); err != nil {
+				errs[i] = fmt.Errorf("backend %q: %w", r.names[i], err)
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,38 @@
+package routerkv
+
+import (
+	"hash/maphash"
+	"reflect"
+
+	"github.com/chenyanchen/kv/internal/ring"
+)
+
+// seed seeds the default hash of the keys of other kinds than strings and
+// integers, the same for all the routers of the process.
+var seed = maphash.MakeSeed()
+
+// defaultHash returns the default hash of the keys: for a string or
+// integer kind, the same in every process, and otherwise maphash.Comparable,
+// the same in this process only.
+func defaultHash[K comparable]() func(K) uint64 {
+	switch reflect.TypeFor[K]().Kind() {
+	case reflect.String:
+		return func(k K) uint64 {
+			if s, ok := any(k).(string); ok {
+				return ring.Hash(s)
+			}
+			return ring.Hash(reflect.ValueOf(k).String())
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(k K) uint64 {
+			if i, ok := any(k).(int); ok {
+				return uint64(i)
+			}
+			return uint64(reflect.ValueOf(k).Int())
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return func(k K) uint64 { return reflect.ValueOf(k).Uint() }
+	default:
+		return func(k K) uint64 { return maphash.Comparable(seed, k) }
+	}
+}
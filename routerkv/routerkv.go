@@ -0,0 +1,126 @@
+// Package routerkv spreads keys over several backend stores, such as
+// Redis or SQL instances, by consistent hashing.
+//
+// The processes routing to the same backends must route each key alike.
+// Keys of a string or integer kind are, by default: their hash does not
+// depend on the process. Other keys, such as structs or arrays, are hashed
+// with maphash.Comparable by default, whose seed is random per process:
+// they are routed alike by the routers of a process only, which is enough
+// for a single process owning the backends. Give the others WithHash.
+package routerkv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	kv "github.com/chenyanchen/kv"
+	"github.com/chenyanchen/kv/internal/ring"
+)
+
+// Option configures a router.
+type Option[K comparable] func(*options[K])
+
+type options[K comparable] struct {
+	replicas int
+	hash     func(K) uint64
+}
+
+// WithReplicas returns an Option that sets the number of points of each
+// backend on the hash ring. More points spread the keys more evenly.
+// Defaults to 160.
+func WithReplicas[K comparable](n int) Option[K] {
+	return func(o *options[K]) {
+		if n > 0 {
+			o.replicas = n
+		}
+	}
+}
+
+// WithHash returns an Option that sets the hash of the keys, which must be
+// the same in every process routing to the backends. The default hash of
+// the keys of other kinds than strings and integers is not, see the
+// package documentation.
+func WithHash[K comparable](hash func(K) uint64) Option[K] {
+	return func(o *options[K]) {
+		if hash != nil {
+			o.hash = hash
+		}
+	}
+}
+
+// router maps keys to backends of type B.
+type router[K comparable, B any] struct {
+	names    []string
+	backends []B
+	ring     ring.Ring
+	hash     func(K) uint64
+}
+
+func newRouter[K comparable, B any](backends map[string]B, opts []Option[K]) (router[K, B], error) {
+	if len(backends) == 0 {
+		return router[K, B]{}, errors.New("no backends")
+	}
+
+	o := options[K]{replicas: ring.DefaultReplicas}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.hash == nil {
+		o.hash = defaultHash[K]()
+	}
+
+	r := router[K, B]{hash: o.hash}
+	for _, name := range slices.Sorted(maps.Keys(backends)) {
+		b := backends[name]
+		if any(b) == nil {
+			return router[K, B]{}, fmt.Errorf("backend %q is nil", name)
+		}
+		r.names = append(r.names, name)
+		r.backends = append(r.backends, b)
+	}
+	r.ring = ring.New(r.names, o.replicas)
+	return r, nil
+}
+
+func (r router[K, B]) route(k K) int {
+	return r.ring.Get(r.hash(k))
+}
+
+// Backend returns the name of the backend of k.
+func (r router[K, B]) Backend(k K) string {
+	return r.names[r.route(k)]
+}
+
+type routerKV[K comparable, V any] struct {
+	router[K, kv.KV[K, V]]
+}
+
+// New returns a KV routing every key to one of the backends, by their
+// name: a backend keeps its keys when others are added or removed, or
+// when it is renumbered, as long as its name stays.
+func New[K comparable, V any](backends map[string]kv.KV[K, V], opts ...Option[K]) (*routerKV[K, V], error) {
+	r, err := newRouter(backends, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &routerKV[K, V]{router: r}, nil
+}
+
+func (r *routerKV[K, V]) backend(k K) kv.KV[K, V] {
+	return r.backends[r.route(k)]
+}
+
+func (r *routerKV[K, V]) Get(ctx context.Context, k K) (V, error) {
+	return r.backend(k).Get(ctx, k)
+}
+
+func (r *routerKV[K, V]) Set(ctx context.Context, k K, v V) error {
+	return r.backend(k).Set(ctx, k, v)
+}
+
+func (r *routerKV[K, V]) Del(ctx context.Context, k K) error {
+	return r.backend(k).Del(ctx, k)
+}
@@ -0,0 +1,225 @@
+package routerkv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	kv "github.com/chenyanchen/kv"
+	"github.com/chenyanchen/kv/cachekv"
+)
+
+func newBackends(names ...string) map[string]kv.KV[string, int] {
+	backends := make(map[string]kv.KV[string, int], len(names))
+	for _, name := range names {
+		backends[name] = cachekv.NewRWMutex[string, int]()
+	}
+	return backends
+}
+
+func TestRouterKV(t *testing.T) {
+	ctx := context.Background()
+	backends := newBackends("a", "b", "c")
+	r, err := New(backends)
+	require.NoError(t, err)
+
+	const keys = 3000
+	for i := range keys {
+		require.NoError(t, r.Set(ctx, fmt.Sprint("key", i), i))
+	}
+
+	counts := map[string]int{}
+	for i := range keys {
+		k := fmt.Sprint("key", i)
+		v, err := r.Get(ctx, k)
+		require.NoError(t, err)
+		assert.Equal(t, i, v)
+
+		// The key is in its backend only.
+		name := r.Backend(k)
+		counts[name]++
+		for other, backend := range backends {
+			_, err := backend.Get(ctx, k)
+			if other == name {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, kv.ErrNotFound)
+			}
+		}
+	}
+	for name := range backends {
+		assert.InDelta(t, keys/3, counts[name], keys/10, name)
+	}
+
+	require.NoError(t, r.Del(ctx, "key1"))
+	_, err = r.Get(ctx, "key1")
+	require.ErrorIs(t, err, kv.ErrNotFound)
+
+	_, err = New[string, int](nil)
+	require.Error(t, err)
+	_, err = New(map[string]kv.KV[string, int]{"a": nil})
+	require.Error(t, err)
+}
+
+func TestRouterKV_Rebalance(t *testing.T) {
+	r3, err := New(newBackends("a", "b", "c"))
+	require.NoError(t, err)
+	r4, err := New(newBackends("a", "b", "c", "d"))
+	require.NoError(t, err)
+
+	const keys = 10000
+	moved := 0
+	for i := range keys {
+		k := fmt.Sprint("key", i)
+		before, after := r3.Backend(k), r4.Backend(k)
+		if before != after {
+			assert.Equal(t, "d", after, "keys only move to the new backend")
+			moved++
+		}
+	}
+	assert.InDelta(t, keys/4, moved, keys/20, "a quarter of the keys move")
+
+	// And back: removing d only moves the keys of d.
+	for i := range keys {
+		k := fmt.Sprint("key", i)
+		if after := r4.Backend(k); after != "d" {
+			assert.Equal(t, after, r3.Backend(k))
+		}
+	}
+}
+
+func TestRouterKV_Hash(t *testing.T) {
+	// Integer keys route the same in every router, the hash is not seeded.
+	ints := map[string]kv.KV[int, int]{"a": cachekv.NewRWMutex[int, int](), "b": cachekv.NewRWMutex[int, int]()}
+	r1, err := New(ints)
+	require.NoError(t, err)
+	r2, err := New(ints)
+	require.NoError(t, err)
+	for i := range 100 {
+		assert.Equal(t, r1.Backend(i), r2.Backend(i))
+	}
+
+	// So do keys of named string types.
+	type name string
+	names := map[string]kv.KV[name, int]{"a": cachekv.NewRWMutex[name, int](), "b": cachekv.NewRWMutex[name, int]()}
+	rn, err := New(names)
+	require.NoError(t, err)
+	rs, err := New(newBackends("a", "b"))
+	require.NoError(t, err)
+	for i := range 100 {
+		k := fmt.Sprint("key", i)
+		assert.Equal(t, rs.Backend(k), rn.Backend(name(k)))
+	}
+
+	// Other keys route the same in the routers of the process.
+	type key struct{ tenant, id int }
+	structs := map[string]kv.KV[key, int]{"a": cachekv.NewRWMutex[key, int](), "b": cachekv.NewRWMutex[key, int]()}
+	rs1, err := New(structs)
+	require.NoError(t, err)
+	rs2, err := New(structs)
+	require.NoError(t, err)
+	backends := map[string]int{}
+	for i := range 100 {
+		k := key{tenant: i, id: i}
+		assert.Equal(t, rs1.Backend(k), rs2.Backend(k))
+		backends[rs1.Backend(k)]++
+	}
+	assert.Len(t, backends, 2, "spread over the backends")
+
+	// Or as WithHash routes them.
+	r, err := New(structs, WithHash(func(k key) uint64 { return uint64(k.tenant) }), WithReplicas[key](10))
+	require.NoError(t, err)
+	for i := range 100 {
+		assert.Equal(t, r.Backend(key{tenant: 1}), r.Backend(key{tenant: 1, id: i}), "routed by tenant")
+	}
+}
+
+// recordingBatch records the batches it is called with, and waits for
+// all the backends to be called, so that calls must be parallel.
+type recordingBatch struct {
+	kv.BatchKV[string, int]
+	mu      sync.Mutex
+	batches [][]string
+	barrier *sync.WaitGroup
+	err     error
+}
+
+func (b *recordingBatch) Get(ctx context.Context, keys []string) (map[string]int, error) {
+	b.mu.Lock()
+	b.batches = append(b.batches, keys)
+	b.mu.Unlock()
+
+	if b.barrier != nil {
+		b.barrier.Done()
+		done := make(chan struct{})
+		go func() { b.barrier.Wait(); close(done) }()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			return nil, errors.New("backends called one at a time")
+		}
+	}
+	if b.err != nil {
+		return nil, b.err
+	}
+	return b.BatchKV.Get(ctx, keys)
+}
+
+func TestBatchKV(t *testing.T) {
+	ctx := context.Background()
+	backends := map[string]*recordingBatch{}
+	batches := map[string]kv.BatchKV[string, int]{}
+	for _, name := range []string{"a", "b", "c"} {
+		backends[name] = &recordingBatch{BatchKV: cachekv.NewBatch[string, int](cachekv.NewRWMutex[string, int](), nil)}
+		batches[name] = backends[name]
+	}
+	b, err := NewBatch(batches)
+	require.NoError(t, err)
+
+	kvs := map[string]int{}
+	keys := []string{}
+	for i := range 30 {
+		k := fmt.Sprint("key", i)
+		kvs[k] = i
+		keys = append(keys, k)
+	}
+	require.NoError(t, b.Set(ctx, kvs))
+	require.NoError(t, b.Del(ctx, keys[:10]))
+
+	var barrier sync.WaitGroup
+	barrier.Add(len(backends))
+	for _, backend := range backends {
+		backend.barrier = &barrier
+	}
+
+	got, err := b.Get(ctx, keys)
+	require.NoError(t, err)
+	for _, k := range keys[10:] {
+		assert.Equal(t, kvs[k], got[k])
+	}
+	assert.Len(t, got, 20)
+
+	// One batch per backend, of its keys only.
+	for name, backend := range backends {
+		require.Len(t, backend.batches, 1, name)
+		for _, k := range backend.batches[0] {
+			assert.Equal(t, name, b.Backend(k))
+		}
+		backend.barrier = nil
+	}
+
+	backends["b"].err = errors.New("connection refused")
+	_, err = b.Get(ctx, keys)
+	require.ErrorIs(t, err, backends["b"].err)
+	assert.Contains(t, err.Error(), `backend "b"`)
+
+	got, err = b.Get(ctx, nil)
+	require.NoError(t, err)
+	assert.Empty(t, got)
+}
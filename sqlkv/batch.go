@@ -0,0 +1,121 @@
+package sqlkv
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+)
+
+type batchKV[K comparable, V any] struct {
+	store
+}
+
+// NewBatch returns a kv.BatchKV on table in db. Batches are split into
+// statements of at most the chunk size keys.
+func NewBatch[K comparable, V any](db *sql.DB, dialect Dialect, table Table, opts ...Option) (*batchKV[K, V], error) {
+	s, err := newStore(db, dialect, table, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &batchKV[K, V]{store: s}, nil
+}
+
+// Get returns the values of the keys found; missing keys are left out of the result.
+func (b *batchKV[K, V]) Get(ctx context.Context, keys []K) (map[K]V, error) {
+	result := make(map[K]V, len(keys))
+	for chunk := range slices.Chunk(keys, b.opts.chunkSize) {
+		query := fmt.Sprintf("SELECT %s, %s FROM %s WHERE %s IN (%s)",
+			b.table.KeyColumn, b.table.ValueColumn, b.table.Name, b.table.KeyColumn,
+			placeholders(b.dialect, len(chunk)))
+
+		if err := b.query(ctx, query, args(chunk), result); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (b *batchKV[K, V]) query(ctx context.Context, query string, args []any, result map[K]V) error {
+	rows, err := b.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			k K
+			v V
+		)
+		if err = rows.Scan(&k, &v); err != nil {
+			return err
+		}
+		result[k] = v
+	}
+	return rows.Err()
+}
+
+// Set upserts all pairs in a single transaction.
+func (b *batchKV[K, V]) Set(ctx context.Context, kvs map[K]V) error {
+	if len(kvs) == 0 {
+		return nil
+	}
+
+	keys := make([]K, 0, len(kvs))
+	for k := range kvs {
+		keys = append(keys, k)
+	}
+
+	return b.tx(ctx, func(tx *sql.Tx) error {
+		for chunk := range slices.Chunk(keys, b.opts.chunkSize) {
+			values := make([]any, 0, 2*len(chunk))
+			for _, k := range chunk {
+				values = append(values, k, kvs[k])
+			}
+			if _, err := tx.ExecContext(ctx, b.dialect.Upsert(b.table, len(chunk)), values...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Del deletes all keys in a single transaction.
+func (b *batchKV[K, V]) Del(ctx context.Context, keys []K) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	return b.tx(ctx, func(tx *sql.Tx) error {
+		for chunk := range slices.Chunk(keys, b.opts.chunkSize) {
+			query := fmt.Sprintf("DELETE FROM %s WHERE %s IN (%s)",
+				b.table.Name, b.table.KeyColumn, placeholders(b.dialect, len(chunk)))
+			if _, err := tx.ExecContext(ctx, query, args(chunk)...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// tx runs fn in a transaction, committed if fn succeeds.
+func (b *batchKV[K, V]) tx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := b.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err = fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func args[K any](keys []K) []any {
+	args := make([]any, len(keys))
+	for i, k := range keys {
+		args[i] = k
+	}
+	return args
+}
@@ -0,0 +1,79 @@
+package sqlkv
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Dialect writes the statements that differ between databases.
+type Dialect interface {
+	// Placeholder returns the bind parameter of the n-th argument, counting from 1.
+	Placeholder(n int) string
+
+	// Upsert returns a statement that inserts rows key/value pairs, replacing
+	// the value of the keys already present. The arguments are the key and
+	// the value of each row, in order.
+	Upsert(t Table, rows int) string
+}
+
+// The dialects of the common databases.
+var (
+	MySQL    Dialect = mysql{}
+	Postgres Dialect = postgres{}
+	SQLite   Dialect = sqlite{}
+)
+
+type mysql struct{}
+
+func (mysql) Placeholder(int) string { return "?" }
+
+func (d mysql) Upsert(t Table, rows int) string {
+	return insert(d, t, rows) +
+		fmt.Sprintf(" ON DUPLICATE KEY UPDATE %s = VALUES(%s)", t.ValueColumn, t.ValueColumn)
+}
+
+type postgres struct{}
+
+func (postgres) Placeholder(n int) string { return fmt.Sprintf("$%d", n) }
+
+func (d postgres) Upsert(t Table, rows int) string {
+	return insert(d, t, rows) + onConflict(t)
+}
+
+type sqlite struct{}
+
+func (sqlite) Placeholder(int) string { return "?" }
+
+func (d sqlite) Upsert(t Table, rows int) string {
+	return insert(d, t, rows) + onConflict(t)
+}
+
+// insert returns an INSERT statement of rows key/value pairs.
+func insert(d Dialect, t Table, rows int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "INSERT INTO %s (%s, %s) VALUES ", t.Name, t.KeyColumn, t.ValueColumn)
+	for i := range rows {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "(%s, %s)", d.Placeholder(2*i+1), d.Placeholder(2*i+2))
+	}
+	return b.String()
+}
+
+// onConflict is the upsert clause shared by Postgres and SQLite.
+func onConflict(t Table) string {
+	return fmt.Sprintf(" ON CONFLICT (%s) DO UPDATE SET %s = excluded.%s", t.KeyColumn, t.ValueColumn, t.ValueColumn)
+}
+
+// placeholders returns n bind parameters separated by commas, starting at the first.
+func placeholders(d Dialect, n int) string {
+	var b strings.Builder
+	for i := range n {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(d.Placeholder(i + 1))
+	}
+	return b.String()
+}
@@ -0,0 +1,125 @@
+// Package sqlkv implements kv.KV and kv.BatchKV on a database/sql table
+// with a key column and a value column.
+//
+// Keys and values are passed to the driver as they are, so they must be
+// types the driver supports, or implement driver.Valuer and sql.Scanner.
+package sqlkv
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	kv "github.com/chenyanchen/kv"
+)
+
+const defaultChunkSize = 256
+
+// Table maps the store to a table. The key column must be the primary key,
+// or have a unique index, for upserts to replace values.
+//
+// The names are written into the statements as they are: they must be
+// trusted, and quoted if the database needs it.
+type Table struct {
+	Name        string
+	KeyColumn   string
+	ValueColumn string
+}
+
+func (t Table) validate() error {
+	if t.Name == "" || t.KeyColumn == "" || t.ValueColumn == "" {
+		return errors.New("table name, key column and value column are required")
+	}
+	return nil
+}
+
+// Option configures the stores.
+type Option func(*options)
+
+type options struct {
+	chunkSize int
+}
+
+// WithChunkSize returns an Option that sets the maximum number of keys per
+// statement of a batch operation. Defaults to 256.
+func WithChunkSize(n int) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.chunkSize = n
+		}
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{chunkSize: defaultChunkSize}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// store holds what the KV and the BatchKV share.
+type store struct {
+	db      *sql.DB
+	dialect Dialect
+	table   Table
+	opts    options
+}
+
+func newStore(db *sql.DB, dialect Dialect, table Table, opts []Option) (store, error) {
+	if db == nil {
+		return store{}, errors.New("db is nil")
+	}
+	if dialect == nil {
+		return store{}, errors.New("dialect is nil")
+	}
+	if err := table.validate(); err != nil {
+		return store{}, err
+	}
+	return store{db: db, dialect: dialect, table: table, opts: newOptions(opts)}, nil
+}
+
+type sqlKV[K comparable, V any] struct {
+	store
+
+	getQuery string
+	setQuery string
+	delQuery string
+}
+
+// New returns a kv.KV on table in db.
+func New[K comparable, V any](db *sql.DB, dialect Dialect, table Table, opts ...Option) (*sqlKV[K, V], error) {
+	s, err := newStore(db, dialect, table, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqlKV[K, V]{
+		store: s,
+		getQuery: fmt.Sprintf("SELECT %s FROM %s WHERE %s = %s",
+			table.ValueColumn, table.Name, table.KeyColumn, dialect.Placeholder(1)),
+		setQuery: dialect.Upsert(table, 1),
+		delQuery: fmt.Sprintf("DELETE FROM %s WHERE %s = %s",
+			table.Name, table.KeyColumn, dialect.Placeholder(1)),
+	}, nil
+}
+
+func (s *sqlKV[K, V]) Get(ctx context.Context, k K) (V, error) {
+	var v V
+	err := s.db.QueryRowContext(ctx, s.getQuery, k).Scan(&v)
+	if errors.Is(err, sql.ErrNoRows) {
+		return v, kv.ErrNotFound
+	}
+	return v, err
+}
+
+func (s *sqlKV[K, V]) Set(ctx context.Context, k K, v V) error {
+	_, err := s.db.ExecContext(ctx, s.setQuery, k, v)
+	return err
+}
+
+func (s *sqlKV[K, V]) Del(ctx context.Context, k K) error {
+	_, err := s.db.ExecContext(ctx, s.delQuery, k)
+	return err
+}
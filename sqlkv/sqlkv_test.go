@@ -0,0 +1,137 @@
+package sqlkv
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+
+	kv "github.com/chenyanchen/kv"
+)
+
+var usersTable = Table{Name: "users", KeyColumn: "id", ValueColumn: "name"}
+
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "kv.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, err = db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT NOT NULL)")
+	require.NoError(t, err)
+	return db
+}
+
+func TestSQLKV(t *testing.T) {
+	ctx := context.Background()
+
+	s, err := New[int64, string](openDB(t), SQLite, usersTable)
+	require.NoError(t, err)
+
+	_, err = s.Get(ctx, 1)
+	require.ErrorIs(t, err, kv.ErrNotFound)
+
+	require.NoError(t, s.Set(ctx, 1, "alice"))
+	require.NoError(t, s.Set(ctx, 1, "bob"))
+
+	v, err := s.Get(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "bob", v)
+
+	require.NoError(t, s.Del(ctx, 1))
+	require.NoError(t, s.Del(ctx, 1))
+	_, err = s.Get(ctx, 1)
+	require.ErrorIs(t, err, kv.ErrNotFound)
+}
+
+func TestNew_Invalid(t *testing.T) {
+	db := openDB(t)
+
+	_, err := New[int64, string](nil, SQLite, usersTable)
+	require.Error(t, err)
+	_, err = New[int64, string](db, nil, usersTable)
+	require.Error(t, err)
+	_, err = NewBatch[int64, string](db, SQLite, Table{Name: "users"})
+	require.Error(t, err)
+}
+
+func TestBatchKV(t *testing.T) {
+	ctx := context.Background()
+
+	// A chunk size that splits the batches unevenly.
+	b, err := NewBatch[int64, string](openDB(t), SQLite, usersTable, WithChunkSize(7))
+	require.NoError(t, err)
+
+	kvs := make(map[int64]string)
+	keys := make([]int64, 0, 50)
+	for i := range int64(50) {
+		kvs[i] = fmt.Sprint("user", i)
+		keys = append(keys, i)
+	}
+	require.NoError(t, b.Set(ctx, kvs))
+
+	kvs[0] = "updated"
+	require.NoError(t, b.Set(ctx, map[int64]string{0: "updated"}))
+
+	got, err := b.Get(ctx, append(keys, 100))
+	require.NoError(t, err)
+	assert.Equal(t, kvs, got)
+
+	require.NoError(t, b.Del(ctx, keys[:20]))
+	got, err = b.Get(ctx, keys)
+	require.NoError(t, err)
+	assert.Len(t, got, 30)
+
+	got, err = b.Get(ctx, nil)
+	require.NoError(t, err)
+	assert.Empty(t, got)
+	require.NoError(t, b.Set(ctx, nil))
+	require.NoError(t, b.Del(ctx, nil))
+}
+
+func TestBatchKV_Rollback(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+
+	_, err := db.Exec("CREATE TABLE strict (id INTEGER PRIMARY KEY, name TEXT NOT NULL CHECK (name != ''))")
+	require.NoError(t, err)
+
+	b, err := NewBatch[int64, string](db, SQLite,
+		Table{Name: "strict", KeyColumn: "id", ValueColumn: "name"}, WithChunkSize(1))
+	require.NoError(t, err)
+
+	require.Error(t, b.Set(ctx, map[int64]string{1: "a", 2: "b", 3: ""}))
+
+	got, err := b.Get(ctx, []int64{1, 2, 3})
+	require.NoError(t, err)
+	assert.Empty(t, got, "a failed batch must not be applied partially")
+}
+
+func TestDialect_Upsert(t *testing.T) {
+	tests := []struct {
+		dialect Dialect
+		want    string
+	}{
+		{
+			dialect: MySQL,
+			want:    "INSERT INTO users (id, name) VALUES (?, ?), (?, ?) ON DUPLICATE KEY UPDATE name = VALUES(name)",
+		}, {
+			dialect: Postgres,
+			want:    "INSERT INTO users (id, name) VALUES ($1, $2), ($3, $4) ON CONFLICT (id) DO UPDATE SET name = excluded.name",
+		}, {
+			dialect: SQLite,
+			want:    "INSERT INTO users (id, name) VALUES (?, ?), (?, ?) ON CONFLICT (id) DO UPDATE SET name = excluded.name",
+		},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.dialect.Upsert(usersTable, 2))
+	}
+
+	assert.Equal(t, "$1, $2, $3", placeholders(Postgres, 3))
+	assert.Equal(t, "?, ?, ?", placeholders(MySQL, 3))
+}
@@ -0,0 +1,99 @@
+package synckv
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Checkpoint records the progress of a run, to resume it.
+type Checkpoint[K comparable] interface {
+	// Load returns the last key done, and false if there is none.
+	Load() (K, bool, error)
+	// Save records k as the last key done.
+	Save(k K) error
+	// Reset forgets the last key done, once a run is complete.
+	Reset() error
+}
+
+// MemoryCheckpoint is a Checkpoint in memory, to resume a run in the same
+// process, e.g. after its context expired.
+type MemoryCheckpoint[K comparable] struct {
+	mu  sync.Mutex
+	key K
+	ok  bool
+}
+
+func (c *MemoryCheckpoint[K]) Load() (K, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.key, c.ok, nil
+}
+
+func (c *MemoryCheckpoint[K]) Save(k K) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.key, c.ok = k, true
+	return nil
+}
+
+func (c *MemoryCheckpoint[K]) Reset() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var k K
+	c.key, c.ok = k, false
+	return nil
+}
+
+// FileCheckpoint is a Checkpoint in a JSON file, to resume a run after a
+// restart. The file is replaced atomically on Save, and removed on Reset.
+type FileCheckpoint[K comparable] struct {
+	Path string
+}
+
+func (c FileCheckpoint[K]) Load() (K, bool, error) {
+	var k K
+	data, err := os.ReadFile(c.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return k, false, nil
+	}
+	if err != nil {
+		return k, false, err
+	}
+	if err = json.Unmarshal(data, &k); err != nil {
+		return k, false, err
+	}
+	return k, true, nil
+}
+
+func (c FileCheckpoint[K]) Save(k K) error {
+	data, err := json.Marshal(k)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(c.Path), ".checkpoint-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), c.Path)
+}
+
+func (c FileCheckpoint[K]) Reset() error {
+	err := os.Remove(c.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,132 @@
+package synckv
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	kv "github.com/chenyanchen/kv"
+)
+
+// MaxDepth is the maximum depth of a Tree, of 2^MaxDepth buckets.
+const MaxDepth = 24
+
+// Tree is a Merkle tree summarizing the content of a store. Its leaves
+// are buckets of keys by hash, holding a hash of their entries, and every
+// other node holds the hash of its two children.
+//
+// Two stores with the same root very likely have the same content;
+// otherwise Diff finds the buckets that differ by only walking down the
+// nodes that differ. A tree is small and encodes to JSON, so that it can
+// be built next to a remote store and sent instead of its values.
+type Tree struct {
+	Depth int
+	// Nodes are in heap order: the children of node i are nodes 2i+1 and
+	// 2i+2, and the last 2^Depth nodes are the leaves.
+	Nodes []uint64
+}
+
+// BuildTree returns the tree of store, which must implement Keyer, with
+// 2^depth buckets. Keys and values are encoded with the marshal function
+// of the options, see WithMarshal.
+func BuildTree[K comparable, V any](ctx context.Context, store kv.KV[K, V], depth int, opts ...Option[K, V]) (*Tree, error) {
+	if depth < 0 || depth > MaxDepth {
+		return nil, fmt.Errorf("depth %d out of [0, %d]", depth, MaxDepth)
+	}
+	keys, ok := store.(Keyer[K])
+	if !ok {
+		return nil, errors.New("store does not implement Keyer")
+	}
+	o := newOptions(opts)
+
+	leaves := 1 << depth
+	t := &Tree{Depth: depth, Nodes: make([]uint64, 2*leaves-1)}
+	for k := range keys.Keys() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		v, err := store.Get(ctx, k)
+		if errors.Is(err, kv.ErrNotFound) {
+			continue // deleted meanwhile
+		}
+		if err != nil {
+			return nil, fmt.Errorf("key %v: %w", k, err)
+		}
+
+		kb, err := o.marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		vb, err := o.marshal(v)
+		if err != nil {
+			return nil, err
+		}
+
+		// Entries add up, so that the hash of a bucket does not depend on
+		// the order of its keys.
+		t.Nodes[leaves-1+t.bucket(kb)] += entryHash(kb, vb)
+	}
+
+	var buf [16]byte
+	for i := leaves - 2; i >= 0; i-- {
+		binary.BigEndian.PutUint64(buf[:8], t.Nodes[2*i+1])
+		binary.BigEndian.PutUint64(buf[8:], t.Nodes[2*i+2])
+		sum := sha256.Sum256(buf[:])
+		t.Nodes[i] = binary.BigEndian.Uint64(sum[:8])
+	}
+	return t, nil
+}
+
+// Root returns the hash of the whole tree.
+func (t *Tree) Root() uint64 {
+	return t.Nodes[0]
+}
+
+// Diff returns the buckets whose content differs between t and other,
+// in order.
+func (t *Tree) Diff(other *Tree) ([]int, error) {
+	if t == nil || other == nil {
+		return nil, errors.New("tree is nil")
+	}
+	if t.Depth != other.Depth || len(t.Nodes) != len(other.Nodes) || len(t.Nodes) != 2<<t.Depth-1 {
+		return nil, errors.New("trees of different depths")
+	}
+
+	leaves := 1 << t.Depth
+	var diff []int
+	var walk func(i int)
+	walk = func(i int) {
+		if t.Nodes[i] == other.Nodes[i] {
+			return
+		}
+		if i >= leaves-1 {
+			diff = append(diff, i-(leaves-1))
+			return
+		}
+		walk(2*i + 1)
+		walk(2*i + 2)
+	}
+	walk(0)
+	return diff, nil
+}
+
+// bucket returns the bucket of a key encoded as data.
+func (t *Tree) bucket(data []byte) int {
+	if t.Depth == 0 {
+		return 0
+	}
+	sum := sha256.Sum256(data)
+	return int(binary.BigEndian.Uint64(sum[:8]) >> (64 - t.Depth))
+}
+
+func entryHash(k, v []byte) uint64 {
+	h := sha256.New()
+	var n [binary.MaxVarintLen64]byte
+	h.Write(n[:binary.PutUvarint(n[:], uint64(len(k)))])
+	h.Write(k)
+	h.Write(v)
+	return binary.BigEndian.Uint64(h.Sum(nil)[:8])
+}
@@ -0,0 +1,422 @@
+// Package synckv reconciles a target store with a source store, such as
+// a cache that drifted from its database.
+//
+// Run walks the keys of the source, compares the values of the two
+// stores, and copies the missing and changed values to the target,
+// optionally deleting the keys of the target not in the source. The
+// differences are reported to a callback, and a dry run only reports
+// them. Keys are visited in order, so that a checkpoint can resume an
+// interrupted run.
+//
+// For large stores, the Merkle trees of the two stores, see BuildTree,
+// narrow a run to the keys of the buckets whose content differs.
+package synckv
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"reflect"
+	"slices"
+	"time"
+
+	kv "github.com/chenyanchen/kv"
+)
+
+// Keyer is implemented by stores whose keys can be listed, such as the
+// cachekv stores.
+type Keyer[K comparable] interface {
+	Keys() iter.Seq[K]
+}
+
+// DiffKind is the kind of a difference between the stores.
+type DiffKind int
+
+const (
+	// Missing is a key of the source missing from the target.
+	Missing DiffKind = iota + 1
+	// Changed is a key whose values differ.
+	Changed
+	// Extra is a key of the target missing from the source.
+	Extra
+)
+
+func (d DiffKind) String() string {
+	switch d {
+	case Missing:
+		return "missing"
+	case Changed:
+		return "changed"
+	case Extra:
+		return "extra"
+	default:
+		return fmt.Sprintf("DiffKind(%d)", int(d))
+	}
+}
+
+// Diff is a difference between the stores. Source or Target is the zero
+// value if the key is missing from the store.
+type Diff[K comparable, V any] struct {
+	Kind   DiffKind
+	Key    K
+	Source V
+	Target V
+}
+
+// Stats counts the work of a run.
+type Stats struct {
+	Scanned int // keys compared
+	Missing int
+	Changed int
+	Extra   int
+	Written int // sets and deletes of the target
+}
+
+// Option configures a run, or the building of a Tree.
+type Option[K comparable, V any] func(*options[K, V])
+
+type options[K comparable, V any] struct {
+	delete     bool
+	dryRun     bool
+	rate       float64
+	equal      func(a, b V) bool
+	compare    func(a, b K) int
+	marshal    func(any) ([]byte, error)
+	onDiff     func(Diff[K, V])
+	onProgress func(Stats)
+
+	checkpoint      Checkpoint[K]
+	checkpointEvery int
+
+	source, target *Tree
+}
+
+// WithDelete returns an Option that deletes the keys of the target not
+// in the source. The target must implement Keyer.
+func WithDelete[K comparable, V any]() Option[K, V] {
+	return func(o *options[K, V]) {
+		o.delete = true
+	}
+}
+
+// WithDryRun returns an Option that only reports the differences,
+// leaving the target as it is.
+func WithDryRun[K comparable, V any]() Option[K, V] {
+	return func(o *options[K, V]) {
+		o.dryRun = true
+	}
+}
+
+// WithRateLimit returns an Option that compares at most perSecond keys a
+// second, to spare the stores.
+func WithRateLimit[K comparable, V any](perSecond float64) Option[K, V] {
+	return func(o *options[K, V]) {
+		if perSecond > 0 {
+			o.rate = perSecond
+		}
+	}
+}
+
+// WithEqual returns an Option that sets how values are compared.
+// Defaults to reflect.DeepEqual.
+func WithEqual[K comparable, V any](equal func(a, b V) bool) Option[K, V] {
+	return func(o *options[K, V]) {
+		if equal != nil {
+			o.equal = equal
+		}
+	}
+}
+
+// WithCompare returns an Option that sets the order of the keys. Keys of
+// string and integer types are ordered by default; other keys need an
+// order to checkpoint.
+func WithCompare[K comparable, V any](compare func(a, b K) int) Option[K, V] {
+	return func(o *options[K, V]) {
+		if compare != nil {
+			o.compare = compare
+		}
+	}
+}
+
+// WithMarshal returns an Option that sets how keys and values are
+// encoded to be hashed in a Tree. It must encode equal values the same.
+// Defaults to json.Marshal.
+func WithMarshal[K comparable, V any](marshal func(any) ([]byte, error)) Option[K, V] {
+	return func(o *options[K, V]) {
+		if marshal != nil {
+			o.marshal = marshal
+		}
+	}
+}
+
+// WithDiffHandler returns an Option that sets the function called with
+// every difference found.
+func WithDiffHandler[K comparable, V any](fn func(Diff[K, V])) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.onDiff = fn
+	}
+}
+
+// WithProgress returns an Option that sets the function called with the
+// stats of the run after every key.
+func WithProgress[K comparable, V any](fn func(Stats)) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.onProgress = fn
+	}
+}
+
+// WithCheckpoint returns an Option that resumes the run after the key
+// saved in cp, and saves the last key done every n keys. The checkpoint
+// is reset once the run is complete.
+func WithCheckpoint[K comparable, V any](cp Checkpoint[K], every int) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.checkpoint = cp
+		o.checkpointEvery = max(every, 1)
+	}
+}
+
+// WithTrees returns an Option that only compares the keys of the buckets
+// that differ between the trees of the source and of the target. The
+// trees must be built with the same depth and marshal function.
+func WithTrees[K comparable, V any](source, target *Tree) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.source, o.target = source, target
+	}
+}
+
+func newOptions[K comparable, V any](opts []Option[K, V]) options[K, V] {
+	o := options[K, V]{
+		equal:   func(a, b V) bool { return reflect.DeepEqual(a, b) },
+		compare: defaultCompare[K](),
+		marshal: json.Marshal,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Run reconciles target with source, which must implement Keyer.
+// It stops at the first error of a store.
+func Run[K comparable, V any](ctx context.Context, source, target kv.KV[K, V], opts ...Option[K, V]) (Stats, error) {
+	var stats Stats
+	if source == nil || target == nil {
+		return stats, errors.New("store is nil")
+	}
+	o := newOptions(opts)
+
+	keys, err := o.keys(source, target)
+	if err != nil {
+		return stats, err
+	}
+
+	if o.checkpoint != nil {
+		if o.compare == nil {
+			var k K
+			return stats, fmt.Errorf("keys of type %T need WithCompare to checkpoint", k)
+		}
+		after, ok, err := o.checkpoint.Load()
+		if err != nil {
+			return stats, fmt.Errorf("load checkpoint: %w", err)
+		}
+		if ok {
+			i, found := slices.BinarySearchFunc(keys, after, o.compare)
+			if found {
+				i++
+			}
+			keys = keys[i:]
+		}
+	}
+
+	limit := newLimiter(o.rate)
+	for i, k := range keys {
+		if err := limit.wait(ctx); err != nil {
+			return stats, err
+		}
+		if err := o.sync(ctx, source, target, k, &stats); err != nil {
+			return stats, fmt.Errorf("key %v: %w", k, err)
+		}
+
+		stats.Scanned++
+		if o.onProgress != nil {
+			o.onProgress(stats)
+		}
+		if o.checkpoint != nil && (i+1)%o.checkpointEvery == 0 {
+			if err := o.checkpoint.Save(k); err != nil {
+				return stats, fmt.Errorf("save checkpoint: %w", err)
+			}
+		}
+	}
+
+	if o.checkpoint != nil {
+		if err := o.checkpoint.Reset(); err != nil {
+			return stats, fmt.Errorf("reset checkpoint: %w", err)
+		}
+	}
+	return stats, nil
+}
+
+// keys returns the keys to compare, in order if there is one.
+func (o *options[K, V]) keys(source, target kv.KV[K, V]) ([]K, error) {
+	sourceKeys, ok := source.(Keyer[K])
+	if !ok {
+		return nil, errors.New("source does not implement Keyer")
+	}
+	seen := make(map[K]struct{})
+	for k := range sourceKeys.Keys() {
+		seen[k] = struct{}{}
+	}
+	if o.delete {
+		targetKeys, ok := target.(Keyer[K])
+		if !ok {
+			return nil, errors.New("target does not implement Keyer, which WithDelete needs")
+		}
+		for k := range targetKeys.Keys() {
+			seen[k] = struct{}{}
+		}
+	}
+
+	var buckets map[int]struct{}
+	if o.source != nil || o.target != nil {
+		diff, err := o.source.Diff(o.target)
+		if err != nil {
+			return nil, err
+		}
+		buckets = make(map[int]struct{}, len(diff))
+		for _, b := range diff {
+			buckets[b] = struct{}{}
+		}
+	}
+
+	keys := make([]K, 0, len(seen))
+	for k := range seen {
+		if buckets != nil {
+			data, err := o.marshal(k)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := buckets[o.source.bucket(data)]; !ok {
+				continue
+			}
+		}
+		keys = append(keys, k)
+	}
+	if o.compare != nil {
+		slices.SortFunc(keys, o.compare)
+	}
+	return keys, nil
+}
+
+// sync compares k in the stores, and repairs the target.
+func (o *options[K, V]) sync(ctx context.Context, source, target kv.KV[K, V], k K, stats *Stats) error {
+	sv, err := source.Get(ctx, k)
+	sourceFound := err == nil
+	if err != nil && !errors.Is(err, kv.ErrNotFound) {
+		return fmt.Errorf("source: %w", err)
+	}
+	tv, err := target.Get(ctx, k)
+	targetFound := err == nil
+	if err != nil && !errors.Is(err, kv.ErrNotFound) {
+		return fmt.Errorf("target: %w", err)
+	}
+
+	d := Diff[K, V]{Key: k, Source: sv, Target: tv}
+	switch {
+	case sourceFound && !targetFound:
+		d.Kind = Missing
+		stats.Missing++
+	case sourceFound && !o.equal(sv, tv):
+		d.Kind = Changed
+		stats.Changed++
+	case !sourceFound && targetFound && o.delete:
+		d.Kind = Extra
+		stats.Extra++
+	default:
+		return nil
+	}
+
+	if o.onDiff != nil {
+		o.onDiff(d)
+	}
+	if o.dryRun {
+		return nil
+	}
+
+	if d.Kind == Extra {
+		err = target.Del(ctx, k)
+	} else {
+		err = target.Set(ctx, k, sv)
+	}
+	if err != nil {
+		return fmt.Errorf("target: %w", err)
+	}
+	stats.Written++
+	return nil
+}
+
+// defaultCompare returns the order of keys of string and integer types,
+// or nil.
+func defaultCompare[K comparable]() func(a, b K) int {
+	var k K
+	switch any(k).(type) {
+	case string:
+		return ordered[K, string]
+	case int:
+		return ordered[K, int]
+	case int64:
+		return ordered[K, int64]
+	case int32:
+		return ordered[K, int32]
+	case uint:
+		return ordered[K, uint]
+	case uint64:
+		return ordered[K, uint64]
+	case uint32:
+		return ordered[K, uint32]
+	default:
+		return nil
+	}
+}
+
+func ordered[K comparable, T cmp.Ordered](a, b K) int {
+	return cmp.Compare(any(a).(T), any(b).(T))
+}
+
+// limiter spaces calls to wait to a rate per second.
+type limiter struct {
+	interval time.Duration
+	next     time.Time
+}
+
+func newLimiter(perSecond float64) *limiter {
+	if perSecond <= 0 {
+		return &limiter{}
+	}
+	return &limiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+func (l *limiter) wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if l.interval == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	if d := l.next.Sub(now); d > 0 {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+		now = l.next
+	}
+	l.next = now.Add(l.interval)
+	return nil
+}
@@ -0,0 +1,199 @@
+package synckv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	kv "github.com/chenyanchen/kv"
+	"github.com/chenyanchen/kv/cachekv"
+)
+
+// newStores returns a source of n keys, and a target with a missing
+// key, a changed key and an extra key.
+func newStores(t *testing.T, n int) (source, target keysKV) {
+	t.Helper()
+	ctx := context.Background()
+	source, target = cachekv.NewRWMutex[string, int](), cachekv.NewRWMutex[string, int]()
+	for i := range n {
+		k := fmt.Sprintf("k%03d", i)
+		require.NoError(t, source.Set(ctx, k, i))
+		require.NoError(t, target.Set(ctx, k, i))
+	}
+	require.NoError(t, target.Del(ctx, "k001"))
+	require.NoError(t, target.Set(ctx, "k002", -2))
+	require.NoError(t, target.Set(ctx, "extra", 1))
+	return source, target
+}
+
+type keysKV interface {
+	kv.KV[string, int]
+	Keyer[string]
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	source, target := newStores(t, 10)
+
+	var diffs []Diff[string, int]
+	stats, err := Run[string, int](ctx, source, target,
+		WithDiffHandler[string, int](func(d Diff[string, int]) { diffs = append(diffs, d) }))
+	require.NoError(t, err)
+	assert.Equal(t, Stats{Scanned: 10, Missing: 1, Changed: 1, Written: 2}, stats)
+	assert.Equal(t, []Diff[string, int]{
+		{Kind: Missing, Key: "k001", Source: 1},
+		{Kind: Changed, Key: "k002", Source: 2, Target: -2},
+	}, diffs)
+
+	for i := range 10 {
+		v, err := target.Get(ctx, fmt.Sprintf("k%03d", i))
+		require.NoError(t, err)
+		assert.Equal(t, i, v)
+	}
+	_, err = target.Get(ctx, "extra")
+	require.NoError(t, err, "kept without WithDelete")
+
+	stats, err = Run[string, int](ctx, source, target, WithDelete[string, int]())
+	require.NoError(t, err)
+	assert.Equal(t, Stats{Scanned: 11, Extra: 1, Written: 1}, stats)
+	_, err = target.Get(ctx, "extra")
+	require.ErrorIs(t, err, kv.ErrNotFound)
+
+	_, err = Run[string, int](ctx, struct{ kv.KV[string, int] }{source}, target)
+	require.Error(t, err, "the source must list its keys")
+}
+
+func TestRun_DryRun(t *testing.T) {
+	ctx := context.Background()
+	source, target := newStores(t, 10)
+
+	var kinds []DiffKind
+	stats, err := Run[string, int](ctx, source, target,
+		WithDryRun[string, int](),
+		WithDelete[string, int](),
+		WithDiffHandler[string, int](func(d Diff[string, int]) { kinds = append(kinds, d.Kind) }))
+	require.NoError(t, err)
+	assert.Equal(t, Stats{Scanned: 11, Missing: 1, Changed: 1, Extra: 1}, stats)
+	assert.ElementsMatch(t, []DiffKind{Missing, Changed, Extra}, kinds)
+	assert.Equal(t, "extra", Extra.String())
+
+	_, err = target.Get(ctx, "k001")
+	require.ErrorIs(t, err, kv.ErrNotFound, "the target is left as it is")
+}
+
+func TestRun_RateLimitAndProgress(t *testing.T) {
+	ctx := context.Background()
+	source, target := newStores(t, 10)
+
+	var progress []int
+	start := time.Now()
+	_, err := Run[string, int](ctx, source, target,
+		WithRateLimit[string, int](200),
+		WithProgress[string, int](func(s Stats) { progress = append(progress, s.Scanned) }))
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+	assert.Equal(t, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, progress)
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = Run[string, int](ctx, source, target, WithRateLimit[string, int](200))
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+// failingKV fails the sets of a key once.
+type failingKV struct {
+	keysKV
+	key string
+}
+
+func (f *failingKV) Set(ctx context.Context, k string, v int) error {
+	if k == f.key {
+		f.key = ""
+		return errors.New("write failed")
+	}
+	return f.keysKV.Set(ctx, k, v)
+}
+
+func TestRun_Checkpoint(t *testing.T) {
+	ctx := context.Background()
+	checkpoints := map[string]Checkpoint[string]{
+		"memory": &MemoryCheckpoint[string]{},
+		"file":   FileCheckpoint[string]{Path: filepath.Join(t.TempDir(), "checkpoint.json")},
+	}
+	for name, cp := range checkpoints {
+		t.Run(name, func(t *testing.T) {
+			source, target := newStores(t, 10)
+			require.NoError(t, target.Del(ctx, "k006"))
+			failing := &failingKV{keysKV: target, key: "k006"}
+
+			stats, err := Run[string, int](ctx, source, failing, WithCheckpoint[string, int](cp, 2))
+			require.Error(t, err)
+			assert.Equal(t, 6, stats.Scanned)
+			k, ok, err := cp.Load()
+			require.NoError(t, err)
+			require.True(t, ok)
+			assert.Equal(t, "k005", k)
+
+			stats, err = Run[string, int](ctx, source, failing, WithCheckpoint[string, int](cp, 2))
+			require.NoError(t, err)
+			assert.Equal(t, Stats{Scanned: 4, Missing: 1, Written: 1}, stats, "resumed after k005")
+			_, ok, err = cp.Load()
+			require.NoError(t, err)
+			assert.False(t, ok, "reset once complete")
+		})
+	}
+
+	source := cachekv.NewRWMutex[key, int]()
+	_, err := Run[key, int](ctx, source, source, WithCheckpoint[key, int](&MemoryCheckpoint[key]{}, 1))
+	require.Error(t, err, "struct keys need an order")
+	_, err = Run[key, int](ctx, source, source,
+		WithCheckpoint[key, int](&MemoryCheckpoint[key]{}, 1),
+		WithCompare[key, int](func(a, b key) int { return a.id - b.id }))
+	require.NoError(t, err)
+}
+
+type key struct{ id int }
+
+func TestTree(t *testing.T) {
+	ctx := context.Background()
+	source, target := newStores(t, 1000)
+
+	st, err := BuildTree[string, int](ctx, source, 8)
+	require.NoError(t, err)
+	tt, err := BuildTree[string, int](ctx, target, 8)
+	require.NoError(t, err)
+	assert.NotEqual(t, st.Root(), tt.Root())
+
+	diff, err := st.Diff(tt)
+	require.NoError(t, err)
+	assert.NotEmpty(t, diff)
+	assert.LessOrEqual(t, len(diff), 3, "the buckets of k001, k002 and extra")
+
+	stats, err := Run[string, int](ctx, source, target, WithDelete[string, int](), WithTrees[string, int](st, tt))
+	require.NoError(t, err)
+	assert.Less(t, stats.Scanned, 100, "only the keys of the differing buckets")
+	assert.Equal(t, 1, stats.Missing)
+	assert.Equal(t, 1, stats.Changed)
+	assert.Equal(t, 1, stats.Extra)
+
+	tt, err = BuildTree[string, int](ctx, target, 8)
+	require.NoError(t, err)
+	assert.Equal(t, st.Root(), tt.Root(), "in sync")
+	diff, err = st.Diff(tt)
+	require.NoError(t, err)
+	assert.Empty(t, diff)
+
+	// Trees must match.
+	other, err := BuildTree[string, int](ctx, target, 4)
+	require.NoError(t, err)
+	_, err = st.Diff(other)
+	require.Error(t, err)
+	_, err = BuildTree[string, int](ctx, target, MaxDepth+1)
+	require.Error(t, err)
+}
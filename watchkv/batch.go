@@ -0,0 +1,63 @@
+package watchkv
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+
+	kv "github.com/chenyanchen/kv"
+)
+
+type batchKV[K comparable, V any] struct {
+	watcher[K, V]
+	store kv.BatchKV[K, V]
+}
+
+// NewBatch returns a kv.BatchKV publishing the writes to store that
+// succeed, an event per key, as a contiguous run. A failed write publishes
+// nothing, though it may have been applied in part.
+func NewBatch[K comparable, V any](store kv.BatchKV[K, V], opts ...Option) (*batchKV[K, V], error) {
+	if store == nil {
+		return nil, errors.New("store is nil")
+	}
+	return &batchKV[K, V]{
+		watcher: watcher[K, V]{hub: newHub[K, V](newOptions(opts))},
+		store:   store,
+	}, nil
+}
+
+func (b *batchKV[K, V]) Get(ctx context.Context, keys []K) (map[K]V, error) {
+	return b.store.Get(ctx, keys)
+}
+
+func (b *batchKV[K, V]) Set(ctx context.Context, kvs map[K]V) error {
+	keys := slices.Collect(maps.Keys(kvs))
+	unlock := b.hub.lock(keys...)
+	defer unlock()
+
+	if err := b.store.Set(ctx, kvs); err != nil {
+		return err
+	}
+	events := make([]Event[K, V], 0, len(kvs))
+	for _, k := range keys {
+		events = append(events, Event[K, V]{Op: OpSet, Key: k, Value: kvs[k]})
+	}
+	b.hub.publish(events...)
+	return nil
+}
+
+func (b *batchKV[K, V]) Del(ctx context.Context, keys []K) error {
+	unlock := b.hub.lock(keys...)
+	defer unlock()
+
+	if err := b.store.Del(ctx, keys); err != nil {
+		return err
+	}
+	events := make([]Event[K, V], 0, len(keys))
+	for _, k := range keys {
+		events = append(events, Event[K, V]{Op: OpDel, Key: k})
+	}
+	b.hub.publish(events...)
+	return nil
+}
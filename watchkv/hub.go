@@ -0,0 +1,199 @@
+package watchkv
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"hash/maphash"
+	"slices"
+	"sync"
+)
+
+// stripes is the number of locks ordering the writes of the same key.
+const stripes = 64
+
+// hub assigns sequence numbers to the events, keeps the latest in a ring
+// buffer, and delivers them to the subscribers.
+type hub[K comparable, V any] struct {
+	opts options
+
+	// locks order the writes of a key with their events.
+	locks [stripes]sync.Mutex
+	seed  maphash.Seed
+
+	mu   sync.Mutex
+	seq  uint64
+	ring []Event[K, V]
+	subs map[*subscriber[K, V]]struct{}
+}
+
+func newHub[K comparable, V any](o options) *hub[K, V] {
+	return &hub[K, V]{
+		opts: o,
+		seed: maphash.MakeSeed(),
+		ring: make([]Event[K, V], o.history),
+		subs: make(map[*subscriber[K, V]]struct{}),
+	}
+}
+
+// lock locks the stripes of keys, in order, and returns their unlock.
+func (h *hub[K, V]) lock(keys ...K) (unlock func()) {
+	idx := make([]int, len(keys))
+	for i, k := range keys {
+		idx[i] = int(maphash.Comparable(h.seed, k) % stripes)
+	}
+	slices.SortFunc(idx, cmp.Compare)
+	idx = slices.Compact(idx)
+
+	for _, i := range idx {
+		h.locks[i].Lock()
+	}
+	return func() {
+		for _, i := range idx {
+			h.locks[i].Unlock()
+		}
+	}
+}
+
+// publish numbers events, records them and delivers them to the
+// subscribers, as a contiguous run.
+func (h *hub[K, V]) publish(events ...Event[K, V]) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, e := range events {
+		h.seq++
+		e.Seq = h.seq
+		if len(h.ring) > 0 {
+			h.ring[h.seq%uint64(len(h.ring))] = e
+		}
+		for s := range h.subs {
+			if s.match(e.Key) && !s.push(e, h.opts.buffer, h.opts.overflow) {
+				delete(h.subs, s)
+			}
+		}
+	}
+}
+
+// subscribe registers a subscriber for the events after seq, replaying
+// those still in the ring buffer.
+func (h *hub[K, V]) subscribe(ctx context.Context, seq uint64, fromNow bool, filter Filter[K]) (<-chan Event[K, V], error) {
+	h.mu.Lock()
+	if fromNow {
+		seq = h.seq
+	}
+	if seq > h.seq {
+		h.mu.Unlock()
+		return nil, fmt.Errorf("watchkv: sequence %d is ahead of %d", seq, h.seq)
+	}
+	if h.seq-seq > uint64(len(h.ring)) {
+		h.mu.Unlock()
+		return nil, fmt.Errorf("%w: sequence %d, the history starts after %d", ErrCompacted, seq, h.seq-uint64(len(h.ring)))
+	}
+
+	s := &subscriber[K, V]{filter: filter, wake: make(chan struct{}, 1)}
+	for n := seq + 1; n <= h.seq; n++ {
+		if e := h.ring[n%uint64(len(h.ring))]; s.match(e.Key) {
+			s.backlog = append(s.backlog, e)
+		}
+	}
+	h.subs[s] = struct{}{}
+	h.mu.Unlock()
+
+	out := make(chan Event[K, V])
+	go func() {
+		defer close(out)
+		defer h.unsubscribe(s)
+		s.deliver(ctx, out)
+	}()
+	return out, nil
+}
+
+func (h *hub[K, V]) unsubscribe(s *subscriber[K, V]) {
+	h.mu.Lock()
+	delete(h.subs, s)
+	h.mu.Unlock()
+}
+
+// subscriber queues the events of a watch until they are received.
+type subscriber[K comparable, V any] struct {
+	filter Filter[K]
+	wake   chan struct{}
+
+	mu sync.Mutex
+	// backlog holds the events replayed from the ring buffer, delivered
+	// before queue, the live events, which alone are bounded.
+	backlog []Event[K, V]
+	queue   []Event[K, V]
+	// disconnected is set when the queue overflowed with Disconnect.
+	disconnected bool
+}
+
+func (s *subscriber[K, V]) match(k K) bool {
+	return s.filter == nil || s.filter(k)
+}
+
+// push queues e, applying overflow to a full queue, and returns false
+// once the subscriber is disconnected.
+func (s *subscriber[K, V]) push(e Event[K, V], buffer int, overflow Overflow) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.queue) >= buffer {
+		switch overflow {
+		case DropOldest:
+			s.queue = s.queue[1:]
+		case DropNewest:
+			return true
+		default:
+			s.disconnected = true
+			s.notify()
+			return false
+		}
+	}
+	s.queue = append(s.queue, e)
+	s.notify()
+	return true
+}
+
+// notify wakes deliver up. It must be called with s.mu held.
+func (s *subscriber[K, V]) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// deliver sends the queued events to out, until ctx is done, or the
+// queue is drained after a disconnection.
+func (s *subscriber[K, V]) deliver(ctx context.Context, out chan<- Event[K, V]) {
+	for {
+		s.mu.Lock()
+		if len(s.backlog) == 0 && len(s.queue) == 0 {
+			disconnected := s.disconnected
+			s.mu.Unlock()
+			if disconnected {
+				return
+			}
+			select {
+			case <-s.wake:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+		var e Event[K, V]
+		if len(s.backlog) > 0 {
+			e, s.backlog = s.backlog[0], s.backlog[1:]
+		} else {
+			e, s.queue = s.queue[0], s.queue[1:]
+		}
+		s.mu.Unlock()
+
+		select {
+		case out <- e:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
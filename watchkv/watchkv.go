@@ -0,0 +1,206 @@
+// Package watchkv publishes the writes of a store as events, for watchers
+// reacting to changes, such as invalidating derived caches or pushing
+// updates to clients.
+//
+// Events are numbered by a sequence, in the order they are published,
+// and the latest are kept in a ring buffer, so that a watcher may resume
+// after the last event it received. Writes of the same key are published
+// in the order they are applied.
+package watchkv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	kv "github.com/chenyanchen/kv"
+)
+
+// ErrCompacted is returned by WatchFrom when the events after the
+// sequence are no longer in the history.
+var ErrCompacted = errors.New("watchkv: events compacted")
+
+// Op is the operation of an event.
+type Op uint8
+
+const (
+	// OpSet is a key set to a value.
+	OpSet Op = iota + 1
+	// OpDel is a key deleted.
+	OpDel
+)
+
+func (op Op) String() string {
+	switch op {
+	case OpSet:
+		return "set"
+	case OpDel:
+		return "del"
+	default:
+		return fmt.Sprintf("Op(%d)", uint8(op))
+	}
+}
+
+// Event is a write of a store. Value is the zero value for OpDel.
+type Event[K comparable, V any] struct {
+	Seq   uint64
+	Op    Op
+	Key   K
+	Value V
+}
+
+// Filter selects the keys whose events a watcher receives. A nil Filter
+// selects them all.
+type Filter[K comparable] func(k K) bool
+
+// Prefix returns a Filter selecting the keys starting with prefix.
+func Prefix[K ~string](prefix string) Filter[K] {
+	return func(k K) bool { return strings.HasPrefix(string(k), prefix) }
+}
+
+// Overflow is what happens to the events of a watcher not receiving them
+// as fast as they are published, once its buffer is full.
+type Overflow uint8
+
+const (
+	// Disconnect closes the channel of the watcher after the events
+	// buffered, so that it never misses events silently: it may resume
+	// with WatchFrom after the last event it received.
+	Disconnect Overflow = iota
+	// DropOldest drops the oldest event buffered for the new one.
+	DropOldest
+	// DropNewest drops the new event.
+	DropNewest
+)
+
+const (
+	defaultBuffer  = 64
+	defaultHistory = 1024
+)
+
+// Option configures a watched store.
+type Option func(*options)
+
+type options struct {
+	buffer   int
+	overflow Overflow
+	history  int
+}
+
+// WithBuffer returns an Option that sets how many events are buffered for
+// each watcher. Defaults to 64.
+func WithBuffer(n int) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.buffer = n
+		}
+	}
+}
+
+// WithOverflow returns an Option that sets what happens to a watcher when
+// its buffer is full. Defaults to Disconnect. The watchers missing events
+// see gaps in their sequence.
+func WithOverflow(overflow Overflow) Option {
+	return func(o *options) {
+		o.overflow = overflow
+	}
+}
+
+// WithHistory returns an Option that sets how many of the latest events
+// are kept for WatchFrom. Defaults to 1024, and 0 keeps none.
+func WithHistory(n int) Option {
+	return func(o *options) {
+		if n >= 0 {
+			o.history = n
+		}
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{buffer: defaultBuffer, history: defaultHistory}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// watcher implements the watches of the stores.
+type watcher[K comparable, V any] struct {
+	hub *hub[K, V]
+}
+
+// Watch returns the events published from now on, of the keys selected by
+// filter. The channel is closed when ctx is done, or on overflow with
+// Disconnect.
+func (w watcher[K, V]) Watch(ctx context.Context, filter Filter[K]) <-chan Event[K, V] {
+	events, _ := w.hub.subscribe(ctx, 0, true, filter)
+	return events
+}
+
+// WatchFrom is like Watch, but starts after the event numbered seq,
+// replaying the events since from the history. It returns ErrCompacted
+// if they are no longer all in it.
+func (w watcher[K, V]) WatchFrom(ctx context.Context, seq uint64, filter Filter[K]) (<-chan Event[K, V], error) {
+	return w.hub.subscribe(ctx, seq, false, filter)
+}
+
+// Seq returns the sequence of the last event published, 0 before any. A
+// watcher reading the store may note it first, and watch from it.
+func (w watcher[K, V]) Seq() uint64 {
+	w.hub.mu.Lock()
+	defer w.hub.mu.Unlock()
+	return w.hub.seq
+}
+
+type watchKV[K comparable, V any] struct {
+	watcher[K, V]
+	store kv.KV[K, V]
+}
+
+// New returns a kv.KV publishing the writes to store that succeed. A
+// failed write publishes nothing.
+func New[K comparable, V any](store kv.KV[K, V], opts ...Option) (*watchKV[K, V], error) {
+	if store == nil {
+		return nil, errors.New("store is nil")
+	}
+	return &watchKV[K, V]{
+		watcher: watcher[K, V]{hub: newHub[K, V](newOptions(opts))},
+		store:   store,
+	}, nil
+}
+
+func (w *watchKV[K, V]) Get(ctx context.Context, k K) (V, error) {
+	return w.store.Get(ctx, k)
+}
+
+func (w *watchKV[K, V]) Set(ctx context.Context, k K, v V) error {
+	unlock := w.hub.lock(k)
+	defer unlock()
+
+	if err := w.store.Set(ctx, k, v); err != nil {
+		return err
+	}
+	w.hub.publish(Event[K, V]{Op: OpSet, Key: k, Value: v})
+	return nil
+}
+
+func (w *watchKV[K, V]) Del(ctx context.Context, k K) error {
+	unlock := w.hub.lock(k)
+	defer unlock()
+
+	if err := w.store.Del(ctx, k); err != nil {
+		return err
+	}
+	w.hub.publish(Event[K, V]{Op: OpDel, Key: k})
+	return nil
+}
+
+// Batch returns a kv.BatchKV on store, the batch API of the same store,
+// publishing to the watchers of w.
+func (w *watchKV[K, V]) Batch(store kv.BatchKV[K, V]) (*batchKV[K, V], error) {
+	if store == nil {
+		return nil, errors.New("store is nil")
+	}
+	return &batchKV[K, V]{watcher: w.watcher, store: store}, nil
+}
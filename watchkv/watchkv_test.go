@@ -0,0 +1,264 @@
+package watchkv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	kv "github.com/chenyanchen/kv"
+	"github.com/chenyanchen/kv/cachekv"
+)
+
+// receive returns the next n events of ch.
+func receive[K comparable, V any](t *testing.T, ch <-chan Event[K, V], n int) []Event[K, V] {
+	t.Helper()
+	var events []Event[K, V]
+	for range n {
+		select {
+		case e, ok := <-ch:
+			require.True(t, ok, "closed after %d events", len(events))
+			events = append(events, e)
+		case <-time.After(time.Second):
+			t.Fatalf("%d events received, want %d", len(events), n)
+		}
+	}
+	return events
+}
+
+// drain returns the events of ch until it is closed.
+func drain[K comparable, V any](t *testing.T, ch <-chan Event[K, V]) []Event[K, V] {
+	t.Helper()
+	var events []Event[K, V]
+	for {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				return events
+			}
+			events = append(events, e)
+		case <-time.After(time.Second):
+			t.Fatal("not closed")
+		}
+	}
+}
+
+func TestWatchKV(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w, err := New[string, int](cachekv.NewRWMutex[string, int]())
+	require.NoError(t, err)
+
+	all := w.Watch(ctx, nil)
+	users := w.Watch(ctx, Prefix[string]("user:"))
+	tens := w.Watch(ctx, func(k string) bool { return strings.HasSuffix(k, "0") })
+
+	require.NoError(t, w.Set(ctx, "user:1", 1))
+	require.NoError(t, w.Set(ctx, "post:10", 10))
+	require.NoError(t, w.Del(ctx, "user:1"))
+	v, err := w.Get(ctx, "post:10")
+	require.NoError(t, err)
+	assert.Equal(t, 10, v)
+
+	assert.Equal(t, []Event[string, int]{
+		{Seq: 1, Op: OpSet, Key: "user:1", Value: 1},
+		{Seq: 2, Op: OpSet, Key: "post:10", Value: 10},
+		{Seq: 3, Op: OpDel, Key: "user:1"},
+	}, receive(t, all, 3))
+	assert.Equal(t, []Event[string, int]{
+		{Seq: 1, Op: OpSet, Key: "user:1", Value: 1},
+		{Seq: 3, Op: OpDel, Key: "user:1"},
+	}, receive(t, users, 2))
+	assert.Equal(t, []Event[string, int]{
+		{Seq: 2, Op: OpSet, Key: "post:10", Value: 10},
+	}, receive(t, tens, 1))
+	assert.Equal(t, uint64(3), w.Seq())
+	assert.Equal(t, "del", OpDel.String())
+
+	// Failed writes publish nothing.
+	failing, err := New[string, int](errKV{err: errors.New("disk full")})
+	require.NoError(t, err)
+	require.Error(t, failing.Set(ctx, "a", 1))
+	assert.Zero(t, failing.Seq())
+
+	// The channels are closed with ctx.
+	cancel()
+	assert.Empty(t, drain(t, all))
+
+	_, err = New[string, int](nil)
+	require.Error(t, err)
+}
+
+func TestWatchKV_WatchFrom(t *testing.T) {
+	ctx := context.Background()
+	w, err := New[string, int](cachekv.NewRWMutex[string, int](), WithHistory(3))
+	require.NoError(t, err)
+
+	for i := range 5 {
+		require.NoError(t, w.Set(ctx, fmt.Sprint("k", i), i))
+	}
+
+	// Resumes after seq 3, the events 4 and 5 replayed before the live ones.
+	ch, err := w.WatchFrom(ctx, 3, nil)
+	require.NoError(t, err)
+	require.NoError(t, w.Set(ctx, "k5", 5))
+	events := receive(t, ch, 3)
+	for i, e := range events {
+		assert.Equal(t, uint64(4+i), e.Seq)
+		assert.Equal(t, fmt.Sprint("k", 3+i), e.Key)
+	}
+
+	ch, err = w.WatchFrom(ctx, 3, func(k string) bool { return k == "k4" })
+	require.NoError(t, err)
+	assert.Equal(t, "k4", receive(t, ch, 1)[0].Key)
+
+	// Seq 6 is the last, 3 the oldest in history.
+	_, err = w.WatchFrom(ctx, 6, nil)
+	require.NoError(t, err)
+	_, err = w.WatchFrom(ctx, 2, nil)
+	require.ErrorIs(t, err, ErrCompacted)
+	_, err = w.WatchFrom(ctx, 7, nil)
+	require.Error(t, err)
+
+	// Without history, only from the last event.
+	w, err = New[string, int](cachekv.NewRWMutex[string, int](), WithHistory(0))
+	require.NoError(t, err)
+	require.NoError(t, w.Set(ctx, "a", 1))
+	_, err = w.WatchFrom(ctx, 1, nil)
+	require.NoError(t, err)
+	_, err = w.WatchFrom(ctx, 0, nil)
+	require.ErrorIs(t, err, ErrCompacted)
+}
+
+func TestWatchKV_Overflow(t *testing.T) {
+	ctx := context.Background()
+	seqs := func(events []Event[string, int]) []uint64 {
+		var seqs []uint64
+		for _, e := range events {
+			seqs = append(seqs, e.Seq)
+		}
+		return seqs
+	}
+
+	// The watcher does not receive while 10 events are published. It may
+	// hold one event besides its buffer of 2.
+	publish := func(opts ...Option) (*watchKV[string, int], <-chan Event[string, int], context.CancelFunc) {
+		w, err := New[string, int](cachekv.NewRWMutex[string, int](), append(opts, WithBuffer(2))...)
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(ctx)
+		ch := w.Watch(ctx, nil)
+		for i := range 10 {
+			require.NoError(t, w.Set(ctx, "k", i))
+		}
+		return w, ch, cancel
+	}
+
+	t.Run("disconnect", func(t *testing.T) {
+		w, ch, cancel := publish()
+		defer cancel()
+		events := drain(t, ch)
+		require.NotEmpty(t, events)
+		assert.LessOrEqual(t, len(events), 3)
+		assert.Equal(t, uint64(1), events[0].Seq)
+
+		// Resume after the last event received.
+		ch, err := w.WatchFrom(ctx, events[len(events)-1].Seq, nil)
+		require.NoError(t, err)
+		rest := receive(t, ch, 10-len(events))
+		assert.Equal(t, uint64(10), rest[len(rest)-1].Seq)
+	})
+
+	t.Run("drop oldest", func(t *testing.T) {
+		_, ch, cancel := publish(WithOverflow(DropOldest))
+		defer cancel()
+		var got []uint64
+		for len(got) == 0 || got[len(got)-1] != 10 {
+			got = append(got, receive(t, ch, 1)[0].Seq)
+		}
+		assert.Equal(t, []uint64{9, 10}, got[len(got)-2:], "the latest events")
+		assert.LessOrEqual(t, len(got), 3)
+	})
+
+	t.Run("drop newest", func(t *testing.T) {
+		_, ch, cancel := publish(WithOverflow(DropNewest))
+		defer cancel()
+		got := seqs(receive(t, ch, 2))
+		assert.Equal(t, []uint64{1, 2}, got, "the first events")
+	})
+}
+
+func TestWatchKV_Order(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := cachekv.NewRWMutex[string, int]()
+	w, err := New[string, int](store, WithBuffer(1000))
+	require.NoError(t, err)
+	ch := w.Watch(ctx, nil)
+
+	const writers = 8
+	var wg sync.WaitGroup
+	for i := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 50 {
+				_ = w.Set(ctx, "k", i*100+j)
+			}
+		}()
+	}
+	wg.Wait()
+
+	events := receive(t, ch, writers*50)
+	v, err := store.Get(ctx, "k")
+	require.NoError(t, err)
+	assert.Equal(t, v, events[len(events)-1].Value, "the last event is the value of the store")
+}
+
+func TestBatchKV(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := cachekv.NewRWMutex[string, int]()
+	w, err := New[string, int](store)
+	require.NoError(t, err)
+	b, err := w.Batch(cachekv.NewBatch[string, int](store, nil))
+	require.NoError(t, err)
+
+	ch := b.Watch(ctx, Prefix[string]("a"))
+	require.NoError(t, w.Set(ctx, "a0", 0))
+	require.NoError(t, b.Set(ctx, map[string]int{"a1": 1, "a2": 2, "b1": 1}))
+	require.NoError(t, b.Del(ctx, []string{"a1", "b1"}))
+	got, err := b.Get(ctx, []string{"a1", "a2"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"a2": 2}, got)
+
+	events := receive(t, ch, 4)
+	assert.Equal(t, "a0", events[0].Key, "one stream for both")
+	assert.ElementsMatch(t, []string{"a1", "a2"}, []string{events[1].Key, events[2].Key})
+	assert.Equal(t, Event[string, int]{Seq: 5, Op: OpDel, Key: "a1"}, events[3])
+
+	b, err = NewBatch[string, int](cachekv.NewBatch[string, int](store, nil), WithHistory(10))
+	require.NoError(t, err)
+	require.NoError(t, b.Set(ctx, map[string]int{"x": 1, "y": 2}))
+	ch, err = b.WatchFrom(ctx, 0, nil)
+	require.NoError(t, err)
+	assert.Len(t, receive(t, ch, 2), 2)
+
+	_, err = NewBatch[string, int](nil)
+	require.Error(t, err)
+	_, err = w.Batch(nil)
+	require.Error(t, err)
+}
+
+type errKV struct{ err error }
+
+func (s errKV) Get(context.Context, string) (int, error) { return 0, s.err }
+func (s errKV) Set(context.Context, string, int) error   { return s.err }
+func (s errKV) Del(context.Context, string) error        { return s.err }
+
+var _ kv.BatchKV[string, int] = (*batchKV[string, int])(nil)